@@ -0,0 +1,134 @@
+package bloomFilter
+
+import(
+	"runtime" //for sizing the worker pool
+	"slices" //for ordering the buckets to set
+	"sync" //for the worker pool and buffer reuse
+)
+
+//batches smaller than this are hashed on the calling goroutine,
+//spinning up workers costs more than it saves
+const parallelBatchThreshold = 1024
+
+//index buffers kept between batches so large batches
+//don't allocate a fresh one each time
+var batchIndexPool = sync.Pool{
+	New: func() interface{} {
+		return new( []int )
+	},
+}
+
+//picks how many workers to hash a batch of the given size with
+func batchWorkers( items int ) int {
+	if items < parallelBatchThreshold{
+		return 1
+	}
+
+	return runtime.GOMAXPROCS(0)
+}
+
+//splits items into workers contiguous chunks and runs work on each chunk
+//concurrently. work is handed the start and end of its chunk
+func runBatch( items, workers int, work func( start, end int ) ) {
+	if workers < 1{
+		workers = 1
+	}
+	if workers > items{
+		workers = items
+	}
+
+	if workers <= 1{
+		work( 0, items )
+		return
+	}
+
+	chunk:= ( items + workers - 1 ) / workers
+
+	var wg sync.WaitGroup
+	for start := 0; start < items; start+= chunk {
+		end:= start + chunk
+		if end > items{
+			end = items
+		}
+
+		wg.Add(1)
+		go func( start, end int ) {
+			defer wg.Done()
+			work( start, end )
+		}( start, end )
+	}
+	wg.Wait()
+}
+
+//adds every item of the batch to the filter.
+//
+//hashing is spread across GOMAXPROCS workers for large batches. Once every
+//index is known they are sorted and set in order, walking IntBuckets once
+//instead of jumping around it for every item.
+func (aBloomFilter *BloomFilter) AddBatch( data [][]byte ) {
+	aBloomFilter.AddBatchWorkers( data, batchWorkers( len(data) ) )
+}
+
+//AddBatch with an explicit amount of hashing workers, 1 keeps everything
+//on the calling goroutine
+func (aBloomFilter *BloomFilter) AddBatchWorkers( data [][]byte, workers int ) {
+	if len(data) == 0{
+		return
+	}
+
+	hashIterations:= aBloomFilter.HashIterations
+
+	//grab a buffer big enough for every index in the batch
+	pooled:= batchIndexPool.Get().(*[]int)
+	needed:= len(data) * hashIterations
+	if cap(*pooled) < needed{
+		*pooled = make( []int, needed )
+	}
+	indices:= (*pooled)[:needed]
+
+	runBatch( len(data), workers, func( start, end int ) {
+		for i := start; i < end; i++ {
+			iterator:= aBloomFilter.newIterator( data[i] )
+			for j := i*hashIterations; j < (i+1)*hashIterations; j++ {
+				indices[j] = iterator.next()
+			}
+		}
+	})
+
+	slices.Sort(indices)
+
+	for i,anIndex:= range indices{
+		//duplicates are common for repeated keys, no need to set twice
+		if i > 0 && indices[i-1] == anIndex{
+			continue
+		}
+		aBloomFilter.Set(anIndex)
+	}
+
+	batchIndexPool.Put(pooled)
+}
+
+//checks the membership of every item of the batch.
+//the result holds the membership of each item at the same position.
+//
+//hashing is spread across GOMAXPROCS workers for large batches
+func (aBloomFilter *BloomFilter) CheckBatch( data [][]byte ) []bool {
+	return aBloomFilter.CheckBatchWorkers( data, batchWorkers( len(data) ) )
+}
+
+//CheckBatch with an explicit amount of hashing workers, 1 keeps everything
+//on the calling goroutine
+func (aBloomFilter *BloomFilter) CheckBatchWorkers( data [][]byte, workers int ) []bool {
+	membership:= make( []bool, len(data) )
+	if len(data) == 0{
+		return membership
+	}
+
+	runBatch( len(data), workers, func( start, end int ) {
+		for i := start; i < end; i++ {
+			membership[i] = aBloomFilter.CheckMembership( data[i] )
+		}
+	})
+
+	return membership
+}
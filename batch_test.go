@@ -0,0 +1,112 @@
+package bloomFilter
+
+import (
+
+	"testing"
+
+)
+
+//a batch must leave the filter exactly as adding each item in turn would
+func TestAddBatch(t *testing.T) {
+	randomKeys:= testKeys()
+	testBytes:= make([][]byte, 3000)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key( randomKeys.Intn(256) )
+	}
+	//repeats in a batch are fine
+	testBytes = append( testBytes, testBytes[:10]... )
+
+	sequential:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	sequential.BuildBuckets()
+	for i := range testBytes {
+		sequential.Add(testBytes[i])
+	}
+
+	for _,workers:= range []int{ 1, 4 } {
+		batched:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+		batched.BuildBuckets()
+		batched.AddBatchWorkers( testBytes, workers )
+
+		for i := range sequential.IntBuckets {
+			if sequential.IntBuckets[i] != batched.IntBuckets[i]{
+				t.Fatal("Batched filter differs from sequential filter with workers", workers)
+			}
+		}
+	}
+
+	//and through the default path
+	batched:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	batched.BuildBuckets()
+	batched.AddBatch( testBytes )
+	batched.AddBatch( nil )
+	for i := range sequential.IntBuckets {
+		if sequential.IntBuckets[i] != batched.IntBuckets[i]{
+			t.Fatal("Batched filter differs from sequential filter")
+		}
+	}
+}
+
+func TestCheckBatch(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	workingFilter.BuildBuckets()
+
+	testBytes:= make([][]byte, 4000)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		if i%2 == 0{
+			workingFilter.Add(testBytes[i])
+		}
+	}
+
+	for _,workers:= range []int{ 1, 4 } {
+		membership:= workingFilter.CheckBatchWorkers( testBytes, workers )
+
+		for i := range testBytes {
+			if membership[i] != workingFilter.CheckMembership(testBytes[i]){
+				t.Fatal("Batched check differs from CheckMembership with workers", workers, i)
+			}
+		}
+	}
+
+	if len( workingFilter.CheckBatch(nil) ) != 0{
+		t.Error("Empty batch returned memberships")
+	}
+}
+
+//the same 1000 item batch through AddBatch and through Add one at a time
+func BenchmarkAddBatchStandardHash(b *testing.B) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:4}
+	workingFilter.BuildBuckets()
+
+	batch:= make([][]byte, 1000)
+	for i := range batch {
+		batch[i] = randomKeys.Key(16)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		workingFilter.AddBatch(batch)
+	}
+}
+
+func BenchmarkAddLoopStandardHash(b *testing.B) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:4}
+	workingFilter.BuildBuckets()
+
+	batch:= make([][]byte, 1000)
+	for i := range batch {
+		batch[i] = randomKeys.Key(16)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _,data:= range batch {
+			workingFilter.Add(data)
+		}
+	}
+}
@@ -0,0 +1,549 @@
+//Package bench runs configurable workloads against every filter in goFilter.
+//
+//a workload describes the keys, the mix of adds and checks, how many goroutines
+//issue them and how full the filter is before timing starts. Running it against
+//a variant gives throughput, latency percentiles, allocations and the false
+//positive rate actually observed, all of which marshal to JSON.
+//
+//every key is generated before the clock starts so the cost of producing
+//keys never shows up in the numbers.
+package bench
+
+import(
+	"errors" //for rejecting nonsense workloads
+	"math" //for key size distributions
+	"os" //for the durable filter's files
+	"path/filepath" //for naming them
+	"runtime" //for counting allocations
+	"slices" //for latency percentiles
+	"sync" //for running goroutines at once
+	"time" //for, well, timing
+
+	bloomFilter "github.com/Everlag/goFilter"
+)
+
+//how the lengths of generated keys are spread between the minimum and maximum
+const(
+	//every length between Min and Max is equally likely
+	UniformKeys = "uniform"
+
+	//every key is Max bytes long
+	FixedKeys = "fixed"
+
+	//mostly short keys with a long tail up to Max, as real identifiers tend to be
+	ExponentialKeys = "exponential"
+)
+
+//the sizes of generated keys, in bytes. Every key is at least 1 byte long,
+//see keySource
+type KeySizes struct{
+	Min int
+	Max int
+
+	//one of UniformKeys, FixedKeys or ExponentialKeys
+	Distribution string
+}
+
+//a workload to run against a filter
+type Workload struct{
+	Name string
+
+	//timed operations, split evenly over the goroutines
+	Operations int
+
+	//fraction of the timed operations that are CheckMembership, the rest are Add
+	ReadRatio float64
+
+	//goroutines issuing operations at once
+	Concurrency int
+
+	//items the filters are sized for, see DataDepth, and the most keys the
+	//exact variant confirms. Defaults to Operations, at most that many are added
+	//while timing. See PrefillRatio for filling the filters up to it first
+	Capacity int
+
+	//fraction of Capacity added before timing starts
+	PrefillRatio float64
+
+	Keys KeySizes
+
+	//constants for the filters under test. DataDepth defaults to the smallest
+	//that holds Capacity items, see depthFor
+	HashIterations int
+	DataDepth int
+
+	//keys never added that are checked after timing to measure the false positive rate
+	Probes int
+
+	//seeds key generation, the same seed gives the same keys
+	Seed int64
+}
+
+//what a workload fills in when left zeroed
+func (aWorkload Workload) withDefaults() Workload {
+	if aWorkload.Name == ""{
+		aWorkload.Name = "default"
+	}
+	if aWorkload.Operations == 0{
+		aWorkload.Operations = 100000
+	}
+	if aWorkload.Concurrency == 0{
+		aWorkload.Concurrency = 1
+	}
+	if aWorkload.Keys.Distribution == ""{
+		aWorkload.Keys.Distribution = UniformKeys
+	}
+	if aWorkload.Keys.Min == 0{
+		aWorkload.Keys.Min = 1
+	}
+	if aWorkload.Keys.Max == 0{
+		aWorkload.Keys.Max = 255
+	}
+	if aWorkload.Capacity == 0{
+		aWorkload.Capacity = aWorkload.Operations
+	}
+	if aWorkload.HashIterations == 0{
+		aWorkload.HashIterations = 10
+	}
+	if aWorkload.DataDepth == 0{
+		aWorkload.DataDepth = depthFor( aWorkload.Capacity, aWorkload.HashIterations )
+	}
+	if aWorkload.Probes == 0{
+		aWorkload.Probes = 100000
+	}
+
+	return aWorkload
+}
+
+//the smallest DataDepth, at most 4, with the buckets for capacity items at
+//the given hash iterations. That's k*capacity/ln 2 buckets, the size at which
+//k hashes give the lowest false positive rate
+func depthFor( capacity, hashIterations int ) int {
+	buckets:= float64(hashIterations) * float64(capacity) / math.Ln2
+
+	depth:= 1
+	for depth < 4 && math.Ldexp( 1, 8*depth ) < buckets {
+		depth++
+	}
+
+	return depth
+}
+
+//checks the workload makes sense once defaults are applied
+func (aWorkload Workload) validate() error {
+	switch{
+	case aWorkload.Operations < 0 || aWorkload.Concurrency < 1 || aWorkload.Capacity < 0 || aWorkload.Probes < 0:
+		return errors.New("bench: counts in a workload can't be negative")
+	case aWorkload.ReadRatio < 0 || aWorkload.ReadRatio > 1 || aWorkload.PrefillRatio < 0:
+		return errors.New("bench: ReadRatio must be between 0 and 1 and PrefillRatio positive")
+	case aWorkload.Keys.Min < 1 || aWorkload.Keys.Max < aWorkload.Keys.Min:
+		return errors.New("bench: key sizes must satisfy 1 <= Min <= Max")
+	case aWorkload.Keys.Distribution != UniformKeys && aWorkload.Keys.Distribution != FixedKeys &&
+		aWorkload.Keys.Distribution != ExponentialKeys:
+		return errors.New("bench: unknown key size distribution " + aWorkload.Keys.Distribution)
+	}
+
+	return nil
+}
+
+//anything the harness can drive.
+//
+//targets with a Close() error method are closed once the run is done, an
+//error from it fails the run
+type Target interface{
+	Add( data []byte )
+	CheckMembership( data []byte ) bool
+}
+
+//a filter variant the harness knows how to build
+type Variant struct{
+	Name string
+
+	//whether the target can be used from many goroutines at once.
+	//targets that can't are wrapped in a mutex for concurrent workloads
+	ConcurrentSafe bool
+
+	Build func( aWorkload Workload ) (Target, error)
+}
+
+//latency percentiles of the timed operations, in nanoseconds
+type Latency struct{
+	P50 int64
+	P90 int64
+	P99 int64
+	P999 int64
+	Max int64
+}
+
+//the outcome of running a workload against a variant
+type Result struct{
+	Workload string
+	Variant string
+
+	//set when a variant that isn't safe for concurrent use had to be wrapped in a mutex
+	Locked bool
+
+	Operations int
+	Concurrency int
+	Seconds float64
+	OperationsPerSecond float64
+
+	Latency Latency
+
+	//heap allocations during the timed operations
+	AllocationsPerOperation float64
+	BytesPerOperation float64
+
+	//the share of probes, keys never added, the filter claimed to contain
+	Probes int
+	MeasuredFPR float64
+}
+
+//generates keys according to the workload's key sizes.
+//
+//every key's first byte is a marker, counted in its length, so added
+//keys and probes can never be equal whatever their random contents
+type keySource struct{
+	random *bloomFilter.KeyGenerator
+	sizes KeySizes
+}
+
+//a seeded source of randomness for keys
+func newRandom( seed int64 ) *bloomFilter.KeyGenerator {
+	return bloomFilter.NewKeyGenerator( uint64(seed) )
+}
+
+//key markers
+const(
+	addedKey = 0x00
+	probeKey = 0xff
+)
+
+func (aSource *keySource) next( marker byte ) []byte {
+	length:= aSource.sizes.Max
+
+	switch aSource.sizes.Distribution{
+	case UniformKeys:
+		length = aSource.sizes.Min + aSource.random.Intn( aSource.sizes.Max - aSource.sizes.Min + 1 )
+	case ExponentialKeys:
+		spread:= float64( aSource.sizes.Max - aSource.sizes.Min )
+		length = aSource.sizes.Min + int( math.Min( aSource.random.ExpFloat64() * spread / 8, spread ) )
+	}
+
+	key:= make( []byte, length )
+	key[0] = marker
+	aSource.random.Fill( key[1:] )
+
+	return key
+}
+
+//the timed operations for one goroutine
+type operation struct{
+	key []byte
+	read bool
+}
+
+//runs the workload against the variant
+func Run( aWorkload Workload, aVariant Variant ) (result Result, err error) {
+	aWorkload = aWorkload.withDefaults()
+
+	result = Result{ Workload: aWorkload.Name, Variant: aVariant.Name,
+		Operations: aWorkload.Operations, Concurrency: aWorkload.Concurrency, Probes: aWorkload.Probes }
+
+	err = aWorkload.validate()
+	if err!=nil{
+		return result, err
+	}
+
+	target, err:= aVariant.Build(aWorkload)
+	if err!=nil{
+		return result, err
+	}
+	if closer, ok:= target.(interface{ Close() error }); ok{
+		defer func() {
+			if closeErr:= closer.Close(); err == nil{
+				err = closeErr
+			}
+		}()
+	}
+
+	if !aVariant.ConcurrentSafe && aWorkload.Concurrency > 1{
+		target = &lockedTarget{ target: target }
+		result.Locked = true
+	}
+
+	keys:= &keySource{ random: newRandom(aWorkload.Seed), sizes: aWorkload.Keys }
+
+	//fill the filter ahead of time, keeping the keys around for reads to hit
+	prefill:= int( float64(aWorkload.Capacity) * aWorkload.PrefillRatio )
+	added:= make( [][]byte, 0, prefill + aWorkload.Operations )
+	for i := 0; i < prefill; i++ {
+		key:= keys.next(addedKey)
+		target.Add(key)
+		added = append( added, key )
+	}
+
+	//plan every operation up front. Reads look up keys planned to be added
+	//so far, which another goroutine may not have got to yet
+	plans:= make( [][]operation, aWorkload.Concurrency )
+	perGoroutine:= aWorkload.Operations / aWorkload.Concurrency
+	for worker := range plans {
+		count:= perGoroutine
+		if worker < aWorkload.Operations % aWorkload.Concurrency{
+			count++
+		}
+
+		plans[worker] = make( []operation, count )
+		for i := range plans[worker] {
+			if keys.random.Float64() < aWorkload.ReadRatio && len(added) > 0{
+				plans[worker][i] = operation{ key: added[ keys.random.Intn(len(added)) ], read: true }
+				continue
+			}
+
+			key:= keys.next(addedKey)
+			added = append( added, key )
+			plans[worker][i] = operation{ key: key }
+		}
+	}
+
+	latencies:= make( [][]int64, aWorkload.Concurrency )
+	for worker := range latencies {
+		latencies[worker] = make( []int64, len(plans[worker]) )
+	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+
+	var wg sync.WaitGroup
+	start:= time.Now()
+	for worker := range plans {
+		wg.Add(1)
+		go func( worker int ) {
+			defer wg.Done()
+			for i,anOperation:= range plans[worker] {
+				operationStart:= time.Now()
+				if anOperation.read{
+					target.CheckMembership(anOperation.key)
+				}else{
+					target.Add(anOperation.key)
+				}
+				latencies[worker][i] = int64( time.Since(operationStart) )
+			}
+		}( worker )
+	}
+	wg.Wait()
+	elapsed:= time.Since(start)
+
+	runtime.ReadMemStats(&after)
+
+	result.Seconds = elapsed.Seconds()
+	if aWorkload.Operations > 0{
+		result.OperationsPerSecond = float64(aWorkload.Operations) / elapsed.Seconds()
+		result.AllocationsPerOperation = float64( after.Mallocs - before.Mallocs ) / float64(aWorkload.Operations)
+		result.BytesPerOperation = float64( after.TotalAlloc - before.TotalAlloc ) / float64(aWorkload.Operations)
+	}
+
+	result.Latency = percentiles( slices.Concat(latencies...) )
+
+	//probes are marked differently to every added key so any hit is a false positive
+	var positives int
+	for i := 0; i < aWorkload.Probes; i++ {
+		if target.CheckMembership( keys.next(probeKey) ){
+			positives++
+		}
+	}
+	if aWorkload.Probes > 0{
+		result.MeasuredFPR = float64(positives) / float64(aWorkload.Probes)
+	}
+
+	return result, nil
+}
+
+//runs the workload against every variant in turn
+func RunAll( aWorkload Workload, variants []Variant ) ([]Result, error) {
+	results:= make( []Result, 0, len(variants) )
+
+	for _,aVariant:= range variants {
+		result, err:= Run( aWorkload, aVariant )
+		if err!=nil{
+			return results, err
+		}
+
+		results = append( results, result )
+	}
+
+	return results, nil
+}
+
+//picks the percentiles out of the latencies, sorting them in the process
+func percentiles( latencies []int64 ) Latency {
+	if len(latencies) == 0{
+		return Latency{}
+	}
+
+	slices.Sort(latencies)
+
+	at:= func( percentile float64 ) int64 {
+		return latencies[ int( percentile * float64( len(latencies) - 1 ) ) ]
+	}
+
+	return Latency{ P50: at(0.5), P90: at(0.9), P99: at(0.99), P999: at(0.999), Max: latencies[ len(latencies) - 1 ] }
+}
+
+//serializes a target that isn't safe for concurrent use
+type lockedTarget struct{
+	lock sync.Mutex
+	target Target
+}
+
+func (aTarget *lockedTarget) Add( data []byte ) {
+	aTarget.lock.Lock()
+	aTarget.target.Add(data)
+	aTarget.lock.Unlock()
+}
+
+func (aTarget *lockedTarget) CheckMembership( data []byte ) bool {
+	aTarget.lock.Lock()
+	defer aTarget.lock.Unlock()
+
+	return aTarget.target.CheckMembership(data)
+}
+
+//every filter variant in the package
+func Variants() []Variant {
+	return []Variant{
+		{ Name: "bloom", Build: func( aWorkload Workload ) (Target, error) {
+			aFilter:= &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations, DataDepth: aWorkload.DataDepth }
+			aFilter.BuildBuckets()
+			return aFilter, nil
+		}},
+
+		{ Name: "concurrent", ConcurrentSafe: true, Build: func( aWorkload Workload ) (Target, error) {
+			aFilter:= &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations, DataDepth: aWorkload.DataDepth }
+			aFilter.BuildBuckets()
+			return bloomFilter.NewConcurrentFilter(aFilter), nil
+		}},
+
+		//a plain filter on atomic words, without the concurrent filter's AddIfAbsent locks
+		{ Name: "atomic-store", ConcurrentSafe: true, Build: func( aWorkload Workload ) (Target, error) {
+			aFilter:= &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations, DataDepth: aWorkload.DataDepth }
+			aFilter.BuildOn( bloomFilter.NewAtomicStore( 1 << uint( 8*aWorkload.DataDepth ) ) )
+			return aFilter, nil
+		}},
+
+		//each shard gets the workload's DataDepth so this uses shardCount times the memory
+		{ Name: "sharded", ConcurrentSafe: true, Build: func( aWorkload Workload ) (Target, error) {
+			return bloomFilter.NewShardedFilter( 16, aWorkload.HashIterations, aWorkload.DataDepth )
+		}},
+
+		//cells are a byte each, so depth stops at 3
+		{ Name: "stable", Build: func( aWorkload Workload ) (Target, error) {
+			aFilter:= &bloomFilter.StableBloomFilter{ HashIterations: aWorkload.HashIterations,
+				DataDepth: min( aWorkload.DataDepth, 3 ), Max: 3, Decrements: 10 }
+			aFilter.BuildCells()
+			return aFilter, nil
+		}},
+
+		//every add waits on an fsync of the log, concurrent adds share them.
+		//the snapshot and log go in a temporary directory removed afterwards
+		{ Name: "durable", ConcurrentSafe: true, Build: func( aWorkload Workload ) (Target, error) {
+			directory, err:= os.MkdirTemp( "", "filterbench" )
+			if err!=nil{
+				return nil, err
+			}
+
+			aFilter:= &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations, DataDepth: aWorkload.DataDepth }
+			aFilter.BuildBuckets()
+
+			durable, err:= bloomFilter.OpenDurableFilter( filepath.Join( directory, "filter" ), aFilter, bloomFilter.DurableOptions{} )
+			if err!=nil{
+				os.RemoveAll(directory)
+				return nil, err
+			}
+
+			return &durableTarget{ filter: durable, directory: directory }, nil
+		}},
+
+		//one replica's adds, the cost over a plain filter is counting them in its version
+		{ Name: "gfilter", Build: func( aWorkload Workload ) (Target, error) {
+			aFilter:= &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations, DataDepth: aWorkload.DataDepth }
+			aFilter.BuildBuckets()
+			return bloomFilter.NewGFilter( "bench", aFilter ), nil
+		}},
+
+		//pages are allocated as they're first set, going dense once half are
+		{ Name: "sparse", Build: func( aWorkload Workload ) (Target, error) {
+			return bloomFilter.NewSparseFilter( &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations,
+				DataDepth: aWorkload.DataDepth }, 0.5 ), nil
+		}},
+
+		//set buckets as Roaring containers, going dense from 1/16 fill
+		{ Name: "roaring", Build: func( aWorkload Workload ) (Target, error) {
+			return bloomFilter.NewRoaringFilter( &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations,
+				DataDepth: aWorkload.DataDepth }, 1.0/16 ), nil
+		}},
+
+		//an exact layer as large as the workload's capacity, in a map
+		{ Name: "exact", Build: func( aWorkload Workload ) (Target, error) {
+			aFilter:= &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations, DataDepth: aWorkload.DataDepth }
+			aFilter.BuildBuckets()
+			return bloomFilter.NewExactFilter( aFilter, bloomFilter.MapHashes, aWorkload.Capacity ), nil
+		}},
+
+		{ Name: "typed-string", Build: func( aWorkload Workload ) (Target, error) {
+			aFilter:= &bloomFilter.BloomFilter{ HashIterations: aWorkload.HashIterations, DataDepth: aWorkload.DataDepth }
+			aFilter.BuildBuckets()
+			return stringTarget{ bloomFilter.NewFilter[string]( aFilter, bloomFilter.StringEncoder{} ) }, nil
+		}},
+	}
+}
+
+//drives a typed string filter with the generated keys.
+//the conversion from bytes is counted, it's what a caller holding bytes pays
+type stringTarget struct{
+	filter *bloomFilter.Filter[string]
+}
+
+func (aTarget stringTarget) Add( data []byte ) {
+	aTarget.filter.Add( string(data) )
+}
+
+func (aTarget stringTarget) CheckMembership( data []byte ) bool {
+	return aTarget.filter.CheckMembership( string(data) )
+}
+
+//drives a durable filter, keeping the first error an add returns for Close
+type durableTarget struct{
+	filter *bloomFilter.DurableFilter
+	directory string
+
+	lock sync.Mutex
+	err error
+}
+
+func (aTarget *durableTarget) Add( data []byte ) {
+	err:= aTarget.filter.Add(data)
+	if err!=nil{
+		aTarget.lock.Lock()
+		if aTarget.err == nil{
+			aTarget.err = err
+		}
+		aTarget.lock.Unlock()
+	}
+}
+
+func (aTarget *durableTarget) CheckMembership( data []byte ) bool {
+	return aTarget.filter.CheckMembership(data)
+}
+
+//closes the filter and removes its files
+func (aTarget *durableTarget) Close() error {
+	err:= aTarget.filter.Close()
+	os.RemoveAll(aTarget.directory)
+
+	if aTarget.err != nil{
+		return aTarget.err
+	}
+	return err
+}
@@ -0,0 +1,118 @@
+package bench
+
+import (
+
+	"testing"
+	"encoding/json"
+
+)
+
+//runs a small mixed workload against every variant
+func TestRunAll(t *testing.T) {
+	aWorkload:= Workload{
+		Name: "test",
+		Operations: 2000,
+		ReadRatio: 0.5,
+		Concurrency: 2,
+		Capacity: 1000,
+		PrefillRatio: 0.5,
+		Keys: KeySizes{ Min: 4, Max: 64, Distribution: ExponentialKeys },
+		HashIterations: 4,
+		DataDepth: 2,
+		Probes: 2000,
+		Seed: 7,
+	}
+
+	results, err:= RunAll( aWorkload, Variants() )
+	if err!=nil{
+		t.Fatal("Failed to run the workload", err)
+	}
+
+	if len(results) != len( Variants() ){
+		t.Fatal("Missing results", len(results))
+	}
+
+	for _,aResult:= range results {
+		if aResult.Operations != 2000 || aResult.OperationsPerSecond <= 0{
+			t.Error("Result has no throughput", aResult.Variant, aResult)
+		}
+		if aResult.Latency.P50 > aResult.Latency.P99 || aResult.Latency.P99 > aResult.Latency.Max{
+			t.Error("Latency percentiles are out of order", aResult.Variant, aResult.Latency)
+		}
+		//2500 items in 65536 buckets with 4 hashes is about a 0.2% rate
+		if aResult.MeasuredFPR > 0.05{
+			t.Error("Measured false positive rate is far too high", aResult.Variant, aResult.MeasuredFPR)
+		}
+	}
+
+	if _, err:= json.Marshal(results); err!=nil{
+		t.Error("Results don't marshal", err)
+	}
+}
+
+func TestWorkloadValidation(t *testing.T) {
+	bad:= []Workload{
+		{ ReadRatio: 2 },
+		{ Keys: KeySizes{ Min: 10, Max: 5 } },
+		{ Keys: KeySizes{ Min: -1, Max: 5 } },
+		{ Keys: KeySizes{ Distribution: "zipf" } },
+		{ Concurrency: -1 },
+	}
+
+	for _,aWorkload:= range bad {
+		if _, err:= Run( aWorkload, Variants()[0] ); err==nil{
+			t.Error("Nonsense workload was accepted", aWorkload)
+		}
+	}
+}
+
+//filters are sized from Capacity, which defaults to the operations
+func TestWorkloadSizing(t *testing.T) {
+	defaulted:= Workload{ Operations: 1000 }.withDefaults()
+	//14427 buckets wanted
+	if defaulted.Capacity != 1000 || defaulted.DataDepth != 2 || defaulted.Keys.Min != 1{
+		t.Error("Workload defaults are wrong", defaulted.Capacity, defaulted.DataDepth, defaulted.Keys.Min)
+	}
+
+	//20.2 million buckets wanted, more than depth 3 holds
+	if sized:= ( Workload{ Capacity: 2000000, HashIterations: 7 } ).withDefaults(); sized.DataDepth != 4{
+		t.Error("Workload was sized wrong", sized.DataDepth)
+	}
+	if explicit:= ( Workload{ Capacity: 2000000, DataDepth: 1 } ).withDefaults(); explicit.DataDepth != 1{
+		t.Error("Workload's own DataDepth was replaced", explicit.DataDepth)
+	}
+
+	//every key added fits in the exact layer, so no probe is a false positive
+	var exact Variant
+	for _,aVariant:= range Variants() {
+		if aVariant.Name == "exact"{
+			exact = aVariant
+		}
+	}
+	result, err:= Run( Workload{ Operations: 2000, DataDepth: 1, Probes: 5000, Seed: 3 }, exact )
+	if err!=nil{
+		t.Fatal("Failed to run the exact variant", err)
+	}
+	if result.MeasuredFPR != 0{
+		t.Error("Exact variant had false positives with its default capacity", result.MeasuredFPR)
+	}
+}
+
+//the same seed has to give the same keys
+func TestKeySource(t *testing.T) {
+	for _,distribution:= range []string{ UniformKeys, FixedKeys, ExponentialKeys } {
+		sizes:= KeySizes{ Min: 1, Max: 32, Distribution: distribution }
+		first:= &keySource{ random: newRandom(3), sizes: sizes }
+		second:= &keySource{ random: newRandom(3), sizes: sizes }
+
+		for i := 0; i < 100; i++ {
+			a, b:= first.next(addedKey), second.next(addedKey)
+			if string(a) != string(b){
+				t.Fatal("Seeded key sources disagree", distribution)
+			}
+			if len(a) < 1 || len(a) > 32 || ( distribution == FixedKeys && len(a) != 32 ){
+				t.Fatal("Key is outside the configured sizes", distribution, len(a))
+			}
+		}
+	}
+}
@@ -0,0 +1,110 @@
+//Command filterbench runs benchmark workloads against goFilter's filters
+//and prints the results as JSON.
+//
+//a single workload can be described with flags:
+//
+//	filterbench -ops 1000000 -read-ratio 0.9 -concurrency 8 -prefill 0.5 -capacity 1000000
+//
+//or many at once from a JSON file holding an array of bench.Workload:
+//
+//	filterbench -workloads workloads.json -variants bloom,sharded
+package main
+
+import(
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/Everlag/goFilter/bench"
+)
+
+func main() {
+	var aWorkload bench.Workload
+
+	flag.StringVar( &aWorkload.Name, "name", "cli", "name reported for the workload" )
+	flag.IntVar( &aWorkload.Operations, "ops", 100000, "timed operations" )
+	flag.Float64Var( &aWorkload.ReadRatio, "read-ratio", 0, "fraction of operations that are membership checks" )
+	flag.IntVar( &aWorkload.Concurrency, "concurrency", 1, "goroutines issuing operations" )
+	flag.IntVar( &aWorkload.Capacity, "capacity", 0, "items the filters are sized for, 0 for -ops" )
+	flag.Float64Var( &aWorkload.PrefillRatio, "prefill", 0, "fraction of capacity added before timing" )
+	flag.IntVar( &aWorkload.Keys.Min, "key-min", 1, "smallest key in bytes, at least 1" )
+	flag.IntVar( &aWorkload.Keys.Max, "key-max", 255, "largest key in bytes" )
+	flag.StringVar( &aWorkload.Keys.Distribution, "key-dist", bench.UniformKeys, "uniform, fixed or exponential key sizes" )
+	flag.IntVar( &aWorkload.HashIterations, "k", 10, "hash iterations of the filters" )
+	flag.IntVar( &aWorkload.DataDepth, "depth", 0, "DataDepth of the filters, 0 for the smallest holding -capacity" )
+	flag.IntVar( &aWorkload.Probes, "probes", 100000, "keys never added checked to measure the false positive rate" )
+	flag.Int64Var( &aWorkload.Seed, "seed", 1, "seed for key generation" )
+
+	workloadFile:= flag.String( "workloads", "", "JSON file of workloads, replaces the workload flags" )
+	variantNames:= flag.String( "variants", "all", "comma separated variants to run, or all" )
+
+	flag.Parse()
+
+	workloads:= []bench.Workload{ aWorkload }
+	if *workloadFile != ""{
+		data, err:= os.ReadFile(*workloadFile)
+		if err!=nil{
+			fail(err)
+		}
+
+		workloads = nil
+		err = json.Unmarshal( data, &workloads )
+		if err!=nil{
+			fail(err)
+		}
+	}
+
+	variants, err:= pickVariants(*variantNames)
+	if err!=nil{
+		fail(err)
+	}
+
+	var results []bench.Result
+	for _,aWorkload:= range workloads {
+		workloadResults, err:= bench.RunAll( aWorkload, variants )
+		if err!=nil{
+			fail(err)
+		}
+
+		results = append( results, workloadResults... )
+	}
+
+	encoder:= json.NewEncoder(os.Stdout)
+	encoder.SetIndent( "", "  " )
+	err = encoder.Encode(results)
+	if err!=nil{
+		fail(err)
+	}
+}
+
+//picks the named variants out of everything the bench package knows
+func pickVariants( names string ) ([]bench.Variant, error) {
+	all:= bench.Variants()
+	if names == "all"{
+		return all, nil
+	}
+
+	var picked []bench.Variant
+	for _,aName:= range strings.Split( names, "," ) {
+		found:= false
+		for _,aVariant:= range all {
+			if aVariant.Name == strings.TrimSpace(aName){
+				picked = append( picked, aVariant )
+				found = true
+			}
+		}
+
+		if !found{
+			return nil, fmt.Errorf( "unknown variant %q", aName )
+		}
+	}
+
+	return picked, nil
+}
+
+func fail( err error ) {
+	fmt.Fprintln( os.Stderr, "filterbench:", err )
+	os.Exit(1)
+}
@@ -0,0 +1,277 @@
+package bloomFilter
+
+import(
+	"errors" //for operations a BitStore can't support
+	"iter" //for walking a store's words
+	"math/bits" //for finding set words
+	"sync/atomic" //for the AtomicStore
+)
+
+//returned by operations that read or write IntBuckets a word at a time in ways a
+//BitStore can't, such as ApplyDelta overwriting words, for filters built on a store
+var ErrNeedsIntBuckets = errors.New("bloomFilter: filter is built on a BitStore rather than IntBuckets")
+
+//where a filter built with BuildOn keeps its buckets, instead of IntBuckets.
+//
+//a store holds Len bits, all unset to begin with unless the store says otherwise.
+//Indices passed to SetBit and GetBit are always below Len. Implementations decide
+//whether they're safe for concurrent use, a filter on a store is only as safe as
+//the store is. Every implementation passes the conformance suite in the tests.
+type BitStore interface{
+	//sets the bit
+	SetBit( index int )
+
+	//whether the bit is set
+	GetBit( index int ) bool
+
+	//the amount of bits held, a multiple of 64
+	Len() int
+
+	//the bits as 64 bit words, bit i of word w being bit w*64 + i. Every
+	//word with a set bit is yielded, in order. Words with none may be skipped
+	Words() iter.Seq2[int, uint64]
+
+	//unsets every bit
+	Clear()
+}
+
+//a BitStore of plain words on the heap, what IntBuckets does without a store
+type HeapStore struct{
+	words []uint64
+}
+
+//a heap store of at least the given amount of bits, rounded up to whole words
+func NewHeapStore( length int ) *HeapStore {
+	return &HeapStore{ words: make( []uint64, (length + 63) / 64 ) }
+}
+
+func (aStore *HeapStore) SetBit( index int ) {
+	aStore.words[index/64]|= 1 << (uint(index)%64)
+}
+
+func (aStore *HeapStore) GetBit( index int ) bool {
+	return aStore.words[index/64] & ( 1 << (uint(index)%64) ) != 0
+}
+
+func (aStore *HeapStore) Len() int {
+	return 64*len(aStore.words)
+}
+
+func (aStore *HeapStore) Words() iter.Seq2[int, uint64] {
+	return sliceWords(aStore.words)
+}
+
+func (aStore *HeapStore) Clear() {
+	clear(aStore.words)
+}
+
+//yields every nonzero word of a slice
+func sliceWords( words []uint64 ) iter.Seq2[int, uint64] {
+	return func( yield func( int, uint64 ) bool ) {
+		for i,aWord:= range words {
+			if aWord != 0 && !yield( i, aWord ){
+				return
+			}
+		}
+	}
+}
+
+//a BitStore safe for concurrent use, every bit set and read atomically.
+//a filter on one can be added to and checked from many goroutines, though
+//unlike a ConcurrentFilter its AddIfAbsent may see a racing add as absent
+type AtomicStore struct{
+	words []uint64
+}
+
+//an atomic store of at least the given amount of bits, rounded up to whole words
+func NewAtomicStore( length int ) *AtomicStore {
+	return &AtomicStore{ words: make( []uint64, (length + 63) / 64 ) }
+}
+
+func (aStore *AtomicStore) SetBit( index int ) {
+	atomic.OrUint64( &aStore.words[index/64], 1 << (uint(index)%64) )
+}
+
+func (aStore *AtomicStore) GetBit( index int ) bool {
+	return atomic.LoadUint64( &aStore.words[index/64] ) & ( 1 << (uint(index)%64) ) != 0
+}
+
+func (aStore *AtomicStore) Len() int {
+	return 64*len(aStore.words)
+}
+
+//each word is read atomically, bits set while walking may or may not be seen
+func (aStore *AtomicStore) Words() iter.Seq2[int, uint64] {
+	return func( yield func( int, uint64 ) bool ) {
+		for i := range aStore.words {
+			aWord:= atomic.LoadUint64( &aStore.words[i] )
+			if aWord != 0 && !yield( i, aWord ){
+				return
+			}
+		}
+	}
+}
+
+//each word is cleared atomically, bits set meanwhile may or may not survive
+func (aStore *AtomicStore) Clear() {
+	for i := range aStore.words {
+		atomic.StoreUint64( &aStore.words[i], 0 )
+	}
+}
+
+//words per page of a PagedStore, and so of a SparseFilter, 4KB of them
+const SparsePageWords = 512
+
+//a BitStore allocating its words a page at a time, on the first SetBit inside
+//each. GetBit of a page never set allocates nothing. See SparseFilter.
+//
+//once enough of the pages are allocated the store moves them all into one dense
+//array, so no more need allocating, see NewPagedStore
+type PagedStore struct{
+	words int
+
+	//nil until something in them is set
+	pages [][]uint64
+	allocated int
+
+	//every page, once the store is dense
+	dense []uint64
+
+	//the share of pages allocated at which the store goes dense, 0 for never
+	denseAt float64
+}
+
+//a paged store of at least the given amount of bits, rounded up to whole
+//words. Once at least denseAt of the pages are allocated the store goes dense,
+//as Densify. 0 keeps it paged however full it gets
+func NewPagedStore( length int, denseAt float64 ) *PagedStore {
+	words:= (length + 63) / 64
+
+	return &PagedStore{ words: words, denseAt: denseAt,
+		pages: make( [][]uint64, (words + SparsePageWords - 1) / SparsePageWords ) }
+}
+
+//the range of words held by a page, the last page may be short
+func (aStore *PagedStore) pageBounds( page int ) (int, int) {
+	start:= page*SparsePageWords
+	return start, min( start + SparsePageWords, aStore.words )
+}
+
+//a page, allocating it if this is the first time it's needed
+func (aStore *PagedStore) page( page int ) []uint64 {
+	if aStore.pages[page] != nil{
+		return aStore.pages[page]
+	}
+
+	start, end:= aStore.pageBounds(page)
+	aStore.pages[page] = make( []uint64, end - start )
+	aStore.allocated++
+
+	aStore.checkDensity()
+
+	return aStore.pages[page]
+}
+
+//goes dense if enough pages are allocated
+func (aStore *PagedStore) checkDensity() {
+	if aStore.denseAt > 0 && float64(aStore.allocated) >= aStore.denseAt*float64( len(aStore.pages) ){
+		aStore.Densify()
+	}
+}
+
+//moves every page into one array of words, as BuildBuckets allocates, so
+//no more pages need allocating. Once most pages are allocated the page table
+//saves nothing. Does nothing to a store that's already dense
+func (aStore *PagedStore) Densify() {
+	if aStore.dense != nil{
+		return
+	}
+
+	aStore.dense = make( []uint64, aStore.words )
+	for i := range aStore.pages {
+		start, end:= aStore.pageBounds(i)
+		copy( aStore.dense[start:end], aStore.pages[i] )
+		aStore.pages[i] = aStore.dense[start:end:end]
+	}
+
+	aStore.allocated = len(aStore.pages)
+}
+
+//whether the store has gone dense, see Densify
+func (aStore *PagedStore) IsDense() bool {
+	return aStore.dense != nil
+}
+
+//how many pages the store spans and how many of them are allocated,
+//every one of them once it's dense
+func (aStore *PagedStore) Pages() (pages, allocated int) {
+	return len(aStore.pages), aStore.allocated
+}
+
+func (aStore *PagedStore) SetBit( index int ) {
+	word:= index / 64
+
+	aPage:= aStore.page( word / SparsePageWords )
+	aPage[word % SparsePageWords]|= 1 << ( uint(index) % 64 )
+}
+
+//never allocates
+func (aStore *PagedStore) GetBit( index int ) bool {
+	word:= index / 64
+
+	aPage:= aStore.pages[word / SparsePageWords]
+	if aPage == nil{
+		return false
+	}
+
+	return aPage[word % SparsePageWords] & ( 1 << ( uint(index) % 64 ) ) != 0
+}
+
+func (aStore *PagedStore) Len() int {
+	return 64*aStore.words
+}
+
+//skips pages never allocated
+func (aStore *PagedStore) Words() iter.Seq2[int, uint64] {
+	return func( yield func( int, uint64 ) bool ) {
+		for i,aPage:= range aStore.pages {
+			start, _:= aStore.pageBounds(i)
+			for j,aWord:= range aPage {
+				if aWord != 0 && !yield( start + j, aWord ){
+					return
+				}
+			}
+		}
+	}
+}
+
+//frees every page, a dense store stays dense
+func (aStore *PagedStore) Clear() {
+	if aStore.dense != nil{
+		clear(aStore.dense)
+		return
+	}
+
+	clear(aStore.pages)
+	aStore.allocated = 0
+}
+
+//the amount of set bits, summed over the words a store yields
+func storePopCount( aStore BitStore ) int {
+	set:= 0
+	for _,aWord:= range aStore.Words() {
+		set+= bits.OnesCount64(aWord)
+	}
+
+	return set
+}
+
+//a store's words as a slice, zero where it skipped them
+func storeWords( aStore BitStore ) []uint64 {
+	words:= make( []uint64, aStore.Len() / 64 )
+	for i,aWord:= range aStore.Words() {
+		words[i] = aWord
+	}
+
+	return words
+}
@@ -0,0 +1,270 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bytes"
+	"errors"
+	"path/filepath"
+	"slices"
+	"sync"
+
+)
+
+//every BitStore, with a constructor for a store of the given amount of bits
+var bitStores = []struct{
+	name string
+	newStore func( t *testing.T, length int ) BitStore
+}{
+	{"heap", func( t *testing.T, length int ) BitStore { return NewHeapStore(length) }},
+	{"atomic", func( t *testing.T, length int ) BitStore { return NewAtomicStore(length) }},
+	{"paged", func( t *testing.T, length int ) BitStore { return NewPagedStore( length, 0 ) }},
+	{"paged dense", func( t *testing.T, length int ) BitStore { return NewPagedStore( length, 0.5 ) }},
+	{"mmap", func( t *testing.T, length int ) BitStore {
+		aStore, err:= OpenMmapStore( filepath.Join( t.TempDir(), "store" ), length )
+		if errors.Is( err, errors.ErrUnsupported ){
+			t.Skip("No mmap here")
+		}
+		if err!=nil{
+			t.Fatal("Failed to open a mapped store", err)
+		}
+		t.Cleanup(func() { aStore.Close() })
+
+		return aStore
+	}},
+}
+
+//the conformance suite every BitStore has to pass
+func TestBitStores(t *testing.T) {
+	for _,aCase:= range bitStores {
+		t.Run( aCase.name, func( t *testing.T ) {
+			newStore:= func( length int ) BitStore { return aCase.newStore( t, length ) }
+
+			testBitStore( t, newStore )
+			testStoreFilter( t, newStore )
+		})
+	}
+}
+
+func testBitStore( t *testing.T, newStore func( length int ) BitStore ) {
+	for _,length:= range []int{ 64, 200, 3*64*SparsePageWords + 1 } {
+		aStore:= newStore(length)
+		if aStore.Len() != (length + 63) / 64 * 64{
+			t.Fatal("Store holds the wrong amount of bits", length, aStore.Len())
+		}
+
+		//the ends, both sides of word and page boundaries and a few between
+		set:= []int{ 0, 63, aStore.Len() - 1, length / 2, length / 3 }
+		if length > 64{
+			set = append( set, 64 )
+		}
+		if length > 64*SparsePageWords{
+			set = append( set, 64*SparsePageWords - 1, 64*SparsePageWords )
+		}
+		for i := range aStore.Len() {
+			if aStore.GetBit(i){
+				t.Fatal("New store has a bit set", length, i)
+			}
+		}
+		for _,anIndex:= range set {
+			aStore.SetBit(anIndex)
+		}
+		aStore.SetBit( set[0] )
+
+		expected:= make( []uint64, aStore.Len() / 64 )
+		for _,anIndex:= range set {
+			expected[anIndex/64]|= 1 << (uint(anIndex)%64)
+		}
+		for i := range aStore.Len() {
+			if aStore.GetBit(i) != ( expected[i/64] & (1 << (uint(i)%64)) != 0 ){
+				t.Fatal("Store has the wrong bit", length, i)
+			}
+		}
+
+		//every nonzero word in order, skipped ones being zero
+		last:= -1
+		for i,aWord:= range aStore.Words() {
+			if i <= last || aWord != expected[i]{
+				t.Fatal("Store yielded the wrong word", length, i, aWord)
+			}
+			last = i
+		}
+		heap:= BloomFilter{ IntBuckets: expected }
+		if !slices.Equal( storeWords(aStore), expected ) || storePopCount(aStore) != heap.popCount(){
+			t.Fatal("Store's words are wrong", length)
+		}
+
+		yielded:= 0
+		for range aStore.Words() {
+			yielded++
+			break
+		}
+		if yielded != 1{
+			t.Error("Store kept yielding after being told to stop", length)
+		}
+
+		aStore.Clear()
+		for _,anIndex:= range set {
+			if aStore.GetBit(anIndex){
+				t.Fatal("Cleared store kept a bit", length, anIndex)
+			}
+		}
+		for _,aWord:= range aStore.Words() {
+			if aWord != 0{
+				t.Fatal("Cleared store yielded a set word", length)
+			}
+		}
+		aStore.SetBit(length - 1)
+		if !aStore.GetBit(length - 1){
+			t.Error("Cleared store can't be set again", length)
+		}
+	}
+}
+
+//a filter built on the store behaves exactly like one on IntBuckets
+func testStoreFilter( t *testing.T, newStore func( length int ) BitStore ) {
+	randomKeys:= testKeys()
+	keys:= deltaKeys( randomKeys, 2000 )
+
+	heap:= BloomFilter{HashIterations: 4, DataDepth: 2}
+	heap.BuildBuckets()
+	onStore:= BloomFilter{HashIterations: 4, DataDepth: 2}
+	onStore.BuildOn( newStore(1 << 16) )
+	if onStore.Validate()!=nil || onStore.IntBuckets != nil{
+		t.Fatal("Filter built on a store is invalid")
+	}
+
+	for i,aKey:= range keys {
+		if onStore.AddIfAbsent(aKey) != heap.AddIfAbsent(aKey){
+			t.Fatal("Filter on a store saw an item differently", i)
+		}
+		heap.Add(aKey)
+		onStore.Add(aKey)
+	}
+	for i,aKey:= range keys {
+		if !onStore.CheckMembership(aKey){
+			t.Fatal("Filter on a store lost an item", i)
+		}
+	}
+	if !slices.Equal( onStore.words(), heap.IntBuckets ) || onStore.Stats() != heap.Stats(){
+		t.Fatal("Filter on a store set other buckets")
+	}
+
+	comparison, err:= onStore.Compare(&heap)
+	if err!=nil || comparison.Jaccard < 0.99{
+		t.Error("Filter on a store compared wrongly", comparison, err)
+	}
+	folded, _, err:= onStore.Fold(2)
+	heapFolded, _, _:= heap.Fold(2)
+	if err!=nil || !slices.Equal( folded.IntBuckets, heapFolded.IntBuckets ){
+		t.Error("Filter on a store folded wrongly", err)
+	}
+
+	fileName:= filepath.Join( t.TempDir(), "storeFilter.json" )
+	if err:= onStore.Serialize( fileName, true ); err!=nil{
+		t.Fatal("Failed to serialize a filter on a store", err)
+	}
+	retrieved, err:= RetrieveFilter( fileName, true )
+	if err!=nil || !slices.Equal( retrieved.IntBuckets, heap.IntBuckets ){
+		t.Fatal("Filter on a store came back wrongly", err)
+	}
+
+	//deltas go out from a store but can't come back into one
+	onStore.TrackChanges()
+	replica:= cloneFilter(&heap)
+	more:= deltaKeys( randomKeys, 100 )
+	for _,aKey:= range more {
+		onStore.Add(aKey)
+		heap.Add(aKey)
+	}
+	var delta bytes.Buffer
+	if err:= onStore.WriteDelta(&delta); err!=nil{
+		t.Fatal("Failed to write a delta from a store", err)
+	}
+	if err:= replica.ApplyDelta( bytes.NewReader( delta.Bytes() ) ); err!=nil || !slices.Equal( replica.IntBuckets, heap.IntBuckets ){
+		t.Fatal("Delta from a store applied wrongly", err)
+	}
+	if err:= onStore.ApplyDelta( bytes.NewReader( delta.Bytes() ) ); err != ErrNeedsIntBuckets{
+		t.Error("Applied a delta to a store", err)
+	}
+
+	//replicas merge into a store a bit at a time
+	other:= BloomFilter{HashIterations: 4, DataDepth: 2}
+	other.BuildBuckets()
+	for _,aKey:= range deltaKeys( randomKeys, 100 ) {
+		other.Add(aKey)
+		heap.Add(aKey)
+	}
+	merged:= NewGFilter( "a", &onStore )
+	if err:= merged.Merge( NewGFilter( "b", &other ) ); err!=nil{
+		t.Fatal("Failed to merge into a store", err)
+	}
+	if !slices.Equal( merged.Filter.words(), heap.IntBuckets ){
+		t.Error("Merging into a store set the wrong buckets")
+	}
+
+	merged.Filter.BuildBuckets()
+	if merged.Filter.popCount() != 0 || merged.Filter.Store() == nil{
+		t.Error("Rebuilding a filter on a store didn't clear it")
+	}
+}
+
+//many goroutines add to a filter on an AtomicStore without losing anything
+func TestAtomicStoreConcurrent(t *testing.T) {
+	randomKeys:= testKeys()
+	keys:= deltaKeys( randomKeys, 4000 )
+
+	aFilter:= BloomFilter{HashIterations: 4, DataDepth: 2}
+	aFilter.BuildOn( NewAtomicStore(1 << 16) )
+
+	var group sync.WaitGroup
+	for worker := range 4 {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for i := worker; i < len(keys); i+= 4 {
+				aFilter.Add( keys[i] )
+				aFilter.CheckMembership( keys[i] )
+			}
+		}()
+	}
+	group.Wait()
+
+	for i,aKey:= range keys {
+		if !aFilter.CheckMembership(aKey){
+			t.Fatal("Concurrent adds lost an item", i)
+		}
+	}
+}
+
+func TestBuildOnRejects(t *testing.T) {
+	panics:= func( name string, build func() ) {
+		defer func() {
+			if recover() == nil{
+				t.Error("Didn't panic", name)
+			}
+		}()
+		build()
+	}
+
+	panics( "wrong size", func() {
+		aFilter:= BloomFilter{HashIterations: 4, DataDepth: 2}
+		aFilter.BuildOn( NewHeapStore(1 << 15) )
+	})
+	panics( "bad constants", func() {
+		aFilter:= BloomFilter{HashIterations: 0, DataDepth: 2}
+		aFilter.BuildOn( NewHeapStore(1 << 16) )
+	})
+	panics( "concurrent filter", func() {
+		aFilter:= BloomFilter{HashIterations: 4, DataDepth: 2}
+		aFilter.BuildOn( NewHeapStore(1 << 16) )
+		NewConcurrentFilter(&aFilter)
+	})
+
+	//Guava's bits are rounded up to whole words, as BuildBuckets does
+	guava:= BloomFilter{HashIterations: 4, Strategy: Murmur128Mitz64, Size: 1000}
+	guava.BuildOn( NewHeapStore(1024) )
+	if guava.Size != 1024 || guava.Validate()!=nil{
+		t.Error("Guava filter on a store was sized wrongly", guava.Size)
+	}
+}
@@ -10,10 +10,11 @@ import(
 	"fmt" //for yelling at people who use obscene data depth!
 	"crypto/sha256" //for hashing... you know.... an important part of bloom filters
 	"math/big" //for dealing with integer exponentiation. Yes, it is harder than it sounds in go
-	"bytes" //for getting indices
-	"encoding/binary" //similarly, for converting bytes to ints for indices!
+	"bytes" //for buffering compressed data
+	"encoding/binary" //for converting bytes to ints for indices!
 
-	"math" //for estimating the accuracy of the given filter and setting buckets
+	"math" //for estimating the accuracy of the given filter
+	"math/bits" //for counting set buckets
 
 	"encoding/json" //for serialization
 	
@@ -22,35 +23,151 @@ import(
 	"io/ioutil"
 	"io"
 
+	"errors" //for rejecting untrusted files
+	"os" //for reading files no further than MaxSerializedSize
+
 	//for benchmarking, used by external programs
-	"crypto/rand"
 	"time"
 )
 
-//takes the data to be hashed and a count of times to hash said data.
-//uses sha256 for speed.
-func hash(data []byte, iterations int) [][]byte {
-	aHasher:= sha256.New()
+//the family of hashes a filter turns data into indices with
+type HashStrategy uint8
+
+const(
+	//chained sha256 truncated to DataDepth bytes, see indexIterator.
+	//the original strategy and the zero value
+	SHA256Chain HashStrategy = iota
+
+	//Guava's MURMUR128_MITZ_64. The two halves h1 and h2 of the data's
+	//murmur3 x64 128 hash give index i as (h1 + i*h2) modulo the buckets, with
+	//the sign bit cleared first. Filters using it have Size buckets, any
+	//multiple of 64, rather than a power of two. See ReadGuavaFilter
+	Murmur128Mitz64
+
+	//RedisBloom's 64 bit double hashing. a is MurmurHash64A of the data seeded
+	//with 0xc6a4a7935bd1e995 and b is MurmurHash64A of the data seeded with a,
+	//index i is (a + i*b) modulo the buckets. Filters using it have Size buckets,
+	//whatever RedisBloom sized the layer to. See ScalableFilter
+	RedisMurmur64A
+)
+
+//the seed RedisBloom starts its first MurmurHash64A with
+const redisHashSeed = 0xc6a4a7935bd1e995
+
+//walks the chain of hashes a filter uses for some data, one index at a time.
+//
+//the first hash is the sha256 of the data, every hash after that is the sha256
+//of the hash before it. iterations of sha256 upon the same data provide a random
+//distribution while only using a single hash function.
+//
+//sha256.Sum256 keeps its digest on the stack and the current hash lives in the
+//iterator itself, so walking the chain never touches the heap. That's what keeps
+//Add and CheckMembership allocation free.
+//
+//a nonzero seed changes the first link to the sha256 of the seed followed by the
+//sha256 of the data. Differently seeded filters then pick unrelated buckets for
+//the same data, at the cost of one more, short, hash per item.
+type indexIterator struct{
+	//the most recent hash in the chain
+	sum [sha256.Size]byte
+
+	//the data being hashed, only needed for the first hash
+	data []byte
+
+	//bytes of each hash used for an index
+	dataDepth int
+
+	//anded with each index, keeps indices inside a folded filter
+	mask int
+
+	//mixed into the first link when nonzero
+	seed uint64
+
+	started bool
+
+	//which family of hashes is walked. Everything above is for SHA256Chain
+	strategy HashStrategy
+
+	//for the double hashing strategies, the running h1 + i*h2, the h2
+	//added each step and the amount of buckets indices are reduced modulo
+	combined, step, buckets uint64
+}
+
+//sets up an iterator over the indices of the given data
+func newIndexIterator( data []byte, dataDepth int, seed uint64 ) indexIterator {
+	return indexIterator{ data: data, dataDepth: dataDepth, mask: -1, seed: seed }
+}
+
+//hashes the next link in the chain and returns its index
+func (anIterator *indexIterator) next() int {
+	if anIterator.strategy != SHA256Chain{
+		if !anIterator.started{
+			anIterator.startDouble()
+		}else{
+			anIterator.combined+= anIterator.step
+		}
+
+		return int( anIterator.value() % anIterator.buckets )
+	}
+
+	if !anIterator.started{
+		return anIterator.startFrom( sha256.Sum256( anIterator.data ) )
+	}
+
+	anIterator.sum = sha256.Sum256( anIterator.sum[:] )
+
+	return anIterator.index()
+}
+
+//hashes the data into the two values the double hashing strategies combine
+func (anIterator *indexIterator) startDouble() {
+	switch anIterator.strategy{
+	case Murmur128Mitz64:
+		//the seed is 0 for anything Guava wrote
+		anIterator.combined, anIterator.step = murmur3Sum128( anIterator.data, uint32(anIterator.seed) )
+	case RedisMurmur64A:
+		anIterator.combined = murmurHash64A( anIterator.data, redisHashSeed )
+		anIterator.step = murmurHash64A( anIterator.data, anIterator.combined )
+	}
+
+	anIterator.started = true
+}
 
-	var hashes [][]byte
-	var aHash []byte
+//the current link as a 64 bit value, the most any filter's index is taken from.
+//the leading 8 bytes of the hash for SHA256Chain, the non negative
+//h1 + i*h2 for Murmur128Mitz64 and plain a + i*b for RedisMurmur64A
+func (anIterator *indexIterator) value() uint64 {
+	switch anIterator.strategy{
+	case Murmur128Mitz64:
+		return anIterator.combined & math.MaxInt64
+	case RedisMurmur64A:
+		return anIterator.combined
+	}
 
-	for i:= 0;i<iterations;i++{
+	return binary.LittleEndian.Uint64( anIterator.sum[:8] )
+}
 
-		//get the hash
-		aHasher.Write(data)
-		aHash = aHasher.Sum( nil )
+//starts the chain from an already computed sha256 of the data
+//and returns the first index
+func (anIterator *indexIterator) startFrom( dataSum [sha256.Size]byte ) int {
+	anIterator.sum = dataSum
+	anIterator.started = true
 
-		//work with the hash
-		hashes = append(hashes, aHash)
-		data = aHash
+	if anIterator.seed != 0{
+		//a stack buffer rather than a hash.Hash, keeps seeding allocation free
+		var seeded [8 + sha256.Size]byte
+		binary.LittleEndian.PutUint64( seeded[:8], anIterator.seed )
+		copy( seeded[8:], dataSum[:] )
 
-		//clean the hasher before the next iteration!
-		aHasher.Reset()
+		anIterator.sum = sha256.Sum256( seeded[:] )
 	}
 
-	//return the set of hashes!
-	return hashes
+	return anIterator.index()
+}
+
+//the index of the current link
+func (anIterator *indexIterator) index() int {
+	return bytesToInt( anIterator.sum[:anIterator.dataDepth] ) & anIterator.mask
 }
 
 //takes a base and the exponent.
@@ -64,28 +181,16 @@ func intExponent(base, exponent int) int {
 
 //assumes that all input is <=8 bytes
 //
-//will append zeroes if required. Silently fails if given a greater than
-//64 bits
+//will append zeroes if required. Silently uses the first 64 bits if given more.
+//decodes straight from a stack array rather than going through a reader
+//so it doesn't allocate
 func bytesToInt( someBytes []byte ) int {
-	var value uint64
-
-
-
 	//make sure the buffer is the proper size for an int64
 	//therefore, 8 bytes!
-	for len(someBytes)<8{
-		someBytes = append(someBytes, byte(0) )
-	}
-
+	var buf [8]byte
+	copy( buf[:], someBytes )
 
-	buf:= bytes.NewReader( someBytes )
-	err:= binary.Read( buf, binary.LittleEndian, &value )
-	if err!=nil{
-		fmt.Println("Failure to convert bytes to int, that's bad.")
-		panic(err)
-	}
-
-	return int(value)
+	return int( binary.LittleEndian.Uint64( buf[:] ) )
 }
 
 //define a bloom filter using sha256, this is a basic bloom array.
@@ -105,16 +210,69 @@ type BloomFilter struct{
 			//we initialize the filter
 	DataDepth int
 
+	//how many times the filter has been halved by Fold.
+		//each fold drops the top bit of every index, so the filter
+		//has 2^(DataDepth*8 - Folds) buckets
+	Folds int
+
+	//how data is turned into indices, SHA256Chain unless the filter
+	//came from, or is going to, Guava or RedisBloom
+	Strategy HashStrategy
+
+	//the amount of buckets for strategies that don't derive it from DataDepth,
+	//DataDepth is then 0. Always a multiple of 64 for Murmur128Mitz64
+	Size int
+
+	//mixed into the first hash of every item when nonzero, see indexIterator.
+		//filters only agree on where an item's bits are when their seeds match.
+		//0 is the original unseeded chain, so older files keep working
+	Seed uint64
+
 	//we keep the actual data here, by using arrays of int64s and bitwise
 	// operations, we can cut the memory used vs a straight array of bools
 	// to 1/8. this is the difference between half a gig of usage vs 4 gig!
 	IntBuckets []uint64
 
+	//a bit for each of IntBuckets changed since the last delta,
+	//nil unless TrackChanges was called
+	dirty []uint64
+
+	//where the buckets are kept instead of IntBuckets, nil unless BuildOn was called
+	store BitStore
+
 }
 
 //builds the buckets for bloom filter.
 	//essentially a reset switch
 func (aBloomFilter *BloomFilter) BuildBuckets() {
+	//every word is new, the next delta has to carry them all
+	if aBloomFilter.dirty!=nil{
+		defer aBloomFilter.markAllDirty()
+	}
+
+	//a store keeps its size, it only needs emptying
+	if aBloomFilter.store!=nil{
+		aBloomFilter.store.Clear()
+		return
+	}
+
+	//sized by Size rather than DataDepth
+	if aBloomFilter.Strategy != SHA256Chain{
+		if aBloomFilter.Size < 1{
+			panic("filters not using SHA256Chain need a Size")
+		}
+
+		words:= (aBloomFilter.Size + 63) / 64
+		aBloomFilter.IntBuckets = make( []uint64, words )
+
+		//Guava rounds its bits up to whole words, RedisBloom only its bytes
+		if aBloomFilter.Strategy == Murmur128Mitz64{
+			aBloomFilter.Size = words*64
+		}
+
+		return
+	}
+
 	//make sure DataDepth is never, ever, ever,ever,ever,ever,ever above 4.
 	//that means it'll attempt to use 2^(5*8) bytes which is big. REALLY DAMN BIG
 	if aBloomFilter.DataDepth > 4{
@@ -125,8 +283,7 @@ func (aBloomFilter *BloomFilter) BuildBuckets() {
 	//determine the total amount of buckets to build
 		//this is defined by 2 to the power of the DataDepth * 8
 
-	//for the love of god, don't look at that function, it will cause sufferring.
-	possibleBuckets:= intExponent( 2, aBloomFilter.DataDepth*8 )
+	possibleBuckets:= aBloomFilter.bucketCount()
 
 	//set up the int bucket
 		//it is initialized to a 0 value at each integer.
@@ -138,6 +295,152 @@ func (aBloomFilter *BloomFilter) BuildBuckets() {
 
 }
 
+//the amount of buckets, that is bits, the filter has.
+	//this is defined by 2 to the power of the DataDepth * 8, halved for every fold
+	//a shift rather than intExponent as this sits on the hot path
+func (aBloomFilter *BloomFilter) bucketCount() int {
+	if aBloomFilter.Strategy != SHA256Chain{
+		return aBloomFilter.Size
+	}
+
+	return 1 << uint( aBloomFilter.DataDepth*8 - aBloomFilter.Folds )
+}
+
+//the amount of IntBuckets needed to hold every bucket
+func (aBloomFilter *BloomFilter) wordCount() int {
+	return (aBloomFilter.bucketCount() + 63) / 64
+}
+
+//builds the filter on the given store rather than IntBuckets, which are left nil.
+//Set and Get then go through the store, so the buckets can live in shared memory,
+//a mapped file or anywhere else a BitStore puts them.
+//
+//the store has to hold exactly wordCount words of bits. Anything already set in it
+//is kept, so a persisted store picks up where it left off. BuildBuckets afterwards
+//clears the store rather than allocating IntBuckets.
+//
+//panics if the constants are invalid or the store is the wrong size
+func (aBloomFilter *BloomFilter) BuildOn( aStore BitStore ) {
+	//as BuildBuckets, Guava rounds its bits up to whole words
+	if aBloomFilter.Strategy == Murmur128Mitz64 && aBloomFilter.Size > 0{
+		aBloomFilter.Size = (aBloomFilter.Size + 63) / 64 * 64
+	}
+
+	if aBloomFilter.validateConstants()!=nil{
+		panic("a filter needs valid constants to be built on a store")
+	}
+	if aStore.Len() != 64*aBloomFilter.wordCount(){
+		panic("a store needs exactly the filter's buckets, rounded up to whole words")
+	}
+
+	aBloomFilter.store = aStore
+	aBloomFilter.IntBuckets = nil
+
+	if aBloomFilter.dirty!=nil{
+		aBloomFilter.markAllDirty()
+	}
+}
+
+//the store the filter was built on, nil for one using IntBuckets
+func (aBloomFilter *BloomFilter) Store() BitStore {
+	return aBloomFilter.store
+}
+
+//the amount of words the filter holds, in IntBuckets or its store
+func (aBloomFilter *BloomFilter) heldWords() int {
+	if aBloomFilter.store!=nil{
+		return aBloomFilter.store.Len() / 64
+	}
+
+	return len(aBloomFilter.IntBuckets)
+}
+
+//the filter's buckets as words, IntBuckets themselves or a copy out of its store.
+//for reading only, writes to a copy would be lost
+func (aBloomFilter *BloomFilter) words() []uint64 {
+	if aBloomFilter.store!=nil{
+		return storeWords(aBloomFilter.store)
+	}
+
+	return aBloomFilter.IntBuckets
+}
+
+//sets up an iterator over the data's indices in this filter
+func (aBloomFilter *BloomFilter) newIterator( data []byte ) indexIterator {
+	iterator:= newIndexIterator( data, aBloomFilter.DataDepth, aBloomFilter.Seed )
+
+	if aBloomFilter.Strategy != SHA256Chain{
+		iterator.strategy = aBloomFilter.Strategy
+		iterator.buckets = uint64( aBloomFilter.Size )
+		return iterator
+	}
+
+	iterator.mask = aBloomFilter.bucketCount() - 1
+
+	return iterator
+}
+
+//the amount of buckets currently set
+func (aBloomFilter *BloomFilter) popCount() int {
+	if aBloomFilter.store!=nil{
+		return storePopCount(aBloomFilter.store)
+	}
+
+	var setBuckets int
+
+	for _,anInt:= range aBloomFilter.IntBuckets{
+		setBuckets+= bits.OnesCount64(anInt)
+	}
+
+	return setBuckets
+}
+
+//estimates the chance a CheckMembership for data never added returns true.
+//
+//that's the chance every one of the HashIterations buckets is set, which at the
+//current fill is (set / buckets)^k
+func (aBloomFilter *BloomFilter) EstimateFalsePositiveRate() float64 {
+	fill:= float64( aBloomFilter.popCount() ) / float64( aBloomFilter.bucketCount() )
+
+	return math.Pow( fill, float64(aBloomFilter.HashIterations) )
+}
+
+//a snapshot of how full a filter is and what that means for its accuracy
+type FilterStats struct{
+	//total buckets and how many of them are set
+	Buckets int
+	SetBuckets int
+
+	//SetBuckets / Buckets
+	FillRatio float64
+
+	//items the filter appears to hold, see EstimateCardinality.
+	//infinite once every bucket is set
+	EstimatedItems float64
+
+	//see EstimateFalsePositiveRate
+	EstimatedFPR float64
+}
+
+//reports how full the filter is along with its estimated
+//item count and false positive rate
+func (aBloomFilter *BloomFilter) Stats() FilterStats {
+	var stats FilterStats
+
+	stats.Buckets = aBloomFilter.bucketCount()
+	stats.SetBuckets = aBloomFilter.popCount()
+	stats.FillRatio = float64(stats.SetBuckets) / float64(stats.Buckets)
+	stats.EstimatedFPR = math.Pow( stats.FillRatio, float64(aBloomFilter.HashIterations) )
+
+	estimate, err:= aBloomFilter.EstimateCardinality()
+	if err!=nil{
+		estimate = math.Inf(1)
+	}
+	stats.EstimatedItems = estimate
+
+	return stats
+}
+
 //literally BuildBuckets in that it wipes the filter
 //while maintaining its constants!
 //Why does this exist? For convention mostly
@@ -154,29 +457,42 @@ func (aBloomFilter *BloomFilter) Set(index int) {
 	integerToUse:= uint(index / 64) //as we are using 64 bits per integer
 
 	//now that we have the integer to use, we need the bit to use
-	bitToUse:= uint8( math.Mod( float64(index), 64 ))
+	bitToUse:= uint(index) % 64
 
-	// set the bit using the following scheme where x is the int modified and position is a unsigned int.
-	//	x = x | 1<<position
-	aBloomFilter.IntBuckets[integerToUse] = aBloomFilter.IntBuckets[integerToUse] | 1<< bitToUse
+	if aBloomFilter.store!=nil{
+		aBloomFilter.store.SetBit(index)
+	}else{
+		// set the bit using the following scheme where x is the int modified and position is a unsigned int.
+		//	x = x | 1<<position
+		aBloomFilter.IntBuckets[integerToUse] = aBloomFilter.IntBuckets[integerToUse] | 1<< bitToUse
+	}
+
+	//marking unconditionally is cheaper than checking the bit was unset
+	if aBloomFilter.dirty!=nil{
+		aBloomFilter.dirty[integerToUse/64]|= 1 << (integerToUse%64)
+	}
 }
 
 //returns whether the given bucket is filled or not
 func (aBloomFilter *BloomFilter) Get(index int) bool {
 
+	if aBloomFilter.store!=nil{
+		return aBloomFilter.store.GetBit(index)
+	}
+
 	//using bitwise operations, get the integer in the array to use
 	//go will just perform an division which rounds down into a integer,
 	//perfect for our purposes
 	integerToUse:= index / 64 //as we are using 64 bits per integer
 
 	//now that we have the integer to use, we need the bit to use
-	bitToUse:= math.Mod( float64(index), 64 )
+	bitToUse:= uint(index) % 64
 
 	//find if the bit is set to one by determining if the bit being set to true
 	//results in the same integer using the following scheme
 	//	bit := x & (1 << 63)
 
-	bit:= (aBloomFilter.IntBuckets[integerToUse] & (1<< uint8( bitToUse))) >> uint8(bitToUse)
+	bit:= (aBloomFilter.IntBuckets[integerToUse] & (1<< bitToUse)) >> bitToUse
 
 	if bit== 0{
 		return false
@@ -191,24 +507,26 @@ func (aBloomFilter *BloomFilter) Get(index int) bool {
 //
 //not exported for good reason!
 func (aBloomFilter *BloomFilter) getIndices( data []byte) []int {
+	indices:= make( []int, aBloomFilter.HashIterations )
 
-	var hashes [][]byte
-
-	//Get the hashes
-	hashes = hash( data, aBloomFilter.HashIterations )
+	iterator:= aBloomFilter.newIterator(data)
+	for i := range indices {
+		indices[i] = iterator.next()
+	}
 
-	//Convert each truncated hash(of size DataDepth in bytes) to an index into the bucket array
-		//allocate all the working arrays now to prevent reallocation later.
-	indices := make( []int, aBloomFilter.HashIterations)
-	workingBytes := make( []byte, aBloomFilter.DataDepth )
-	for i,aHash:= range hashes{
+	return indices
+}
 
-		//truncate the hash to the first BloomFilter.DataDepth bytes
-		workingBytes = aHash[0:aBloomFilter.DataDepth]
+//the actual index derivation behind getIndices. Pulled out so the other
+//structures in the package can share the same hashing and truncation scheme
+//without pretending to be a BloomFilter.
+func indicesOf( data []byte, hashIterations, dataDepth int, seed uint64 ) []int {
 
-		//get the index and append it to the indices. 
-		indices[i] = bytesToInt(workingBytes)
+	indices:= make( []int, hashIterations )
 
+	iterator:= newIndexIterator( data, dataDepth, seed )
+	for i := range indices {
+		indices[i] = iterator.next()
 	}
 
 	return indices
@@ -216,28 +534,28 @@ func (aBloomFilter *BloomFilter) getIndices( data []byte) []int {
 
 //takes an array of bytes and adds it to the given bloom filter.
 //very simple to use when the bloom array was set up properly
+//
+//walks the indices directly instead of collecting them, this doesn't allocate
 func (aBloomFilter *BloomFilter) Add( data []byte ) {
 
-	//get the indices for the filter's buckets!
-	indices:= aBloomFilter.getIndices(data)
-
-	for _,anIndex:= range indices{
-		aBloomFilter.Set(anIndex)
+	iterator:= aBloomFilter.newIterator(data)
+	for i := 0; i < aBloomFilter.HashIterations; i++ {
+		aBloomFilter.Set( iterator.next() )
 	}
 
 }
 
 //takes an array of bytes and checks its membership in the filter.
 //returns a bool of membership
+//
+//like Add this doesn't allocate. It also stops hashing at the first unset bucket
 func (aBloomFilter *BloomFilter) CheckMembership( data []byte) bool {
 
-	//get the indices for the filter's buckets
-	indices:= aBloomFilter.getIndices(data)
-
 	//check if each index is true.
 	// the moment we hit a negative then the membership fails
-	for _, anIndex:=range indices{
-		if !aBloomFilter.Get(anIndex){
+	iterator:= aBloomFilter.newIterator(data)
+	for i := 0; i < aBloomFilter.HashIterations; i++ {
+		if !aBloomFilter.Get( iterator.next() ){
 			return false
 		}
 	}
@@ -248,13 +566,155 @@ func (aBloomFilter *BloomFilter) CheckMembership( data []byte) bool {
 
 }
 
+//adds the data to the filter and reports whether it was already a member.
+//
+//the same as calling CheckMembership then Add but the data is only hashed once.
+//every bucket is set regardless so the filter ends up the same either way
+func (aBloomFilter *BloomFilter) AddIfAbsent( data []byte ) (wasPresent bool) {
+
+	wasPresent = true
+
+	iterator:= aBloomFilter.newIterator(data)
+	for i := 0; i < aBloomFilter.HashIterations; i++ {
+		anIndex:= iterator.next()
+
+		if !aBloomFilter.Get(anIndex){
+			wasPresent = false
+			aBloomFilter.Set(anIndex)
+		}
+	}
+
+	return wasPresent
+}
+
 //serializes a bloom filter into a retrievable format for later usage
 //
-//takes the given name to use for the file and if to compress the file using gzip
+//takes the given name to use for the file and if to compress the file using gzip.
+//a filter built on a store is written with its buckets as IntBuckets, and retrieved as such
 func (aBloomFilter *BloomFilter) Serialize(fileName string, compress bool) error {
-	//uses json for portability
+	return writeSerialized( fileName, aBloomFilter.written(), compress )
+}
+
+//the filter as it's serialized. One built on a store is copied with the
+//store's buckets as IntBuckets, as the store itself isn't written
+func (aBloomFilter *BloomFilter) written() *BloomFilter {
+	if aBloomFilter.store==nil{
+		return aBloomFilter
+	}
+
+	written:= *aBloomFilter
+	written.IntBuckets, written.store = aBloomFilter.words(), nil
 
-	marshaled, err:= json.Marshal(aBloomFilter)
+	return &written
+}
+
+//attempts to deserialize a file into a bloom filter.
+//the counterpart to the above Serialize.
+//
+//the file is treated as untrusted, anything that fails Validate
+//is rejected with ErrCorrupt rather than panicking later on
+func RetrieveFilter(fileName string, compressed bool) (BloomFilter, error) {
+
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return BloomFilter{}, err
+	}
+
+	return parseFilter( data, compressed )
+}
+
+//the parsing half of RetrieveFilter
+func parseFilter(data []byte, compressed bool) (BloomFilter, error) {
+
+	var aBloomFilter BloomFilter
+
+	err:= decodeSerialized( data, compressed, &aBloomFilter )
+	if err!=nil{
+		return BloomFilter{}, err
+	}
+
+	err = aBloomFilter.Validate()
+	if err!=nil{
+		return BloomFilter{}, err
+	}
+
+	return aBloomFilter, nil
+}
+
+//checks the invariants every other method relies on:
+//HashIterations between 1 and MaxHashIterations and, for SHA256Chain, DataDepth
+//between 1 and 4, at least 64 buckets left after folding and exactly enough
+//IntBuckets to hold them, or a store of exactly that size. A Murmur128Mitz64 filter instead needs a Size that's a
+//whole, nonzero, amount of IntBuckets, no DataDepth or Folds and a 32 bit Seed.
+//A RedisMurmur64A filter needs a nonzero Size filling its last IntBucket at least
+//partly, no DataDepth or Folds and no Seed.
+//
+//returns ErrCorrupt if any of them is broken
+func (aBloomFilter *BloomFilter) Validate() error {
+	err:= aBloomFilter.validateConstants()
+	if err!=nil{
+		return err
+	}
+	if aBloomFilter.store!=nil{
+		if aBloomFilter.IntBuckets != nil || aBloomFilter.store.Len() != 64*aBloomFilter.wordCount(){
+			return ErrCorrupt
+		}
+		return nil
+	}
+	if len(aBloomFilter.IntBuckets) != aBloomFilter.wordCount(){
+		return ErrCorrupt
+	}
+
+	return nil
+}
+
+//everything Validate checks but the amount of IntBuckets,
+//for filters keeping their buckets somewhere else
+func (aBloomFilter *BloomFilter) validateConstants() error {
+	if aBloomFilter.HashIterations < 1 || aBloomFilter.HashIterations > MaxHashIterations{
+		return ErrCorrupt
+	}
+
+	switch aBloomFilter.Strategy{
+	case SHA256Chain:
+		if aBloomFilter.Size != 0{
+			return ErrCorrupt
+		}
+	case Murmur128Mitz64:
+		if aBloomFilter.DataDepth != 0 || aBloomFilter.Folds != 0 || aBloomFilter.Seed > math.MaxUint32{
+			return ErrCorrupt
+		}
+		if aBloomFilter.Size < 64 || aBloomFilter.Size % 64 != 0{
+			return ErrCorrupt
+		}
+		return nil
+	case RedisMurmur64A:
+		if aBloomFilter.DataDepth != 0 || aBloomFilter.Folds != 0 || aBloomFilter.Seed != 0{
+			return ErrCorrupt
+		}
+		if aBloomFilter.Size < 1{
+			return ErrCorrupt
+		}
+		return nil
+	default:
+		return ErrCorrupt
+	}
+
+	if aBloomFilter.DataDepth < 1 || aBloomFilter.DataDepth > 4{
+		return ErrCorrupt
+	}
+	if aBloomFilter.Folds < 0 || aBloomFilter.DataDepth*8 - aBloomFilter.Folds < 6{
+		return ErrCorrupt
+	}
+
+	return nil
+}
+
+//writes any of the package's structures to the given file.
+//uses json for portability with optional gzip compression on top
+func writeSerialized(fileName string, value interface{}, compress bool) error {
+
+	marshaled, err:= json.Marshal(value)
 	if err!=nil{
 		return err
 	}
@@ -283,64 +743,78 @@ func (aBloomFilter *BloomFilter) Serialize(fileName string, compress bool) error
 
 }
 
-//attempts to deserialize a file into a bloom filter.
-//the counterpart to the above Serialize.
-func RetrieveFilter(fileName string, compressed bool) (BloomFilter, error) {
+//returned when a serialized structure, or what it decompresses to,
+//is larger than MaxSerializedSize
+var ErrTooLarge = errors.New("bloomFilter: serialized data is larger than MaxSerializedSize")
 
-	var aBloomFilter BloomFilter
+//returned when a serialized structure decodes but breaks the invariants
+//its methods rely on, such as having the wrong amount of buckets
+var ErrCorrupt = errors.New("bloomFilter: serialized data is malformed")
 
-	//retrieve the file
-	data, err:= ioutil.ReadFile(fileName)
+//the most bytes read from a serialized file, and separately the most a
+//compressed file may decompress to. Anything larger is refused with ErrTooLarge.
+//
+//the default fits a saturated DataDepth 4 filter, around 1.4GB of JSON.
+//lower it when files come from somewhere you don't trust
+var MaxSerializedSize int64 = 1 << 31
+
+//the most hash iterations a retrieved structure may have.
+//every Add and CheckMembership costs that many hashes, so an untrusted
+//file could otherwise make each call take arbitrarily long
+var MaxHashIterations = 1 << 16
+
+//reads a file written by writeSerialized, no further than MaxSerializedSize
+func readSerialized(fileName string) ([]byte, error) {
+
+	file, err:= os.Open(fileName)
 	if err!=nil{
-		return aBloomFilter, err
+		return nil, err
 	}
+	defer file.Close()
 
-	var workingData []byte
+	return readLimited(file)
+}
 
-	//if compressed, decompress before handing it off to the json umarshaller
-	if compressed==false{
-		workingData = data
-	}else{
-		var actualData bytes.Buffer
+//decodes data read by readSerialized into the given value.
+//compressed data is decompressed no further than MaxSerializedSize
+//so a small file can't expand to fill memory
+func decodeSerialized(data []byte, compressed bool, value interface{}) error {
 
-		var b bytes.Buffer
-		b.Write( data )
-		reader, err:= gzip.NewReader(&b)
+	//if compressed, decompress before handing it off to the json umarshaller
+	if compressed{
+		reader, err:= gzip.NewReader( bytes.NewReader(data) )
 		if err!=nil{
-			return aBloomFilter,err
+			return err
 		}
-		io.Copy(&actualData, reader)
-		reader.Close()
-
-		workingData = actualData.Bytes()
-
 
+		data, err = readLimited(reader)
+		reader.Close()
+		if err!=nil{
+			return err
+		}
 	}
 
+	return json.Unmarshal(data, value)
+}
 
-	err= json.Unmarshal(workingData, &aBloomFilter)
+//reads everything, failing with ErrTooLarge past MaxSerializedSize
+func readLimited(reader io.Reader) ([]byte, error) {
+	data, err:= ioutil.ReadAll( io.LimitReader( reader, MaxSerializedSize + 1 ) )
 	if err!=nil{
-		return aBloomFilter, err
+		return nil, err
 	}
 
-	return aBloomFilter, nil
-}
-
-// gets an array of random bytes from the crypto generator
-func getArrayOfRandBytes(arrayLength int) []byte {
-	workingArray:= make([]byte, arrayLength)
-
-	io.ReadFull(rand.Reader, workingArray)
-
-	return workingArray
-}
+	if int64( len(data) ) > MaxSerializedSize{
+		return nil, ErrTooLarge
+	}
 
-//returns a random integer between 0 and 255.
-func getRandByteInt() int {
-	return int(getArrayOfRandBytes(1)[0])
+	return data, nil
 }
 
 //checks the speed of the add function for given generic filter
+//
+//Deprecated: the bench package runs configurable workloads against every
+//filter variant and reports far more than adds per second.
 func Bench(iterations, DataDepth int) uint {
 
 	//perform expensive setup
@@ -349,10 +823,17 @@ func Bench(iterations, DataDepth int) uint {
 
 	iterationsToRun:= 100000
 
+	//generate the data before timing so the generator isn't benchmarked too
+	keys:= NewKeyGenerator(1)
+	dataToAdd:= make( [][]byte, iterationsToRun )
+	for i := range dataToAdd {
+		dataToAdd[i] = keys.Key( keys.Intn(256) )
+	}
+
 	//start the timer!
 	start:= time.Now()
 	for i := 0; i < iterationsToRun; i++ {
-		workingFilter.Add( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.Add( dataToAdd[i] )
 	}
 
 	elapsed:= time.Since(start)
@@ -6,9 +6,24 @@ import (
 	"fmt"
 	"crypto/sha256"
 	"runtime"
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"flag"
 
 )
 
+//seeds the keys every test and benchmark generates.
+//a failure replays with the same seed, -keyseed runs everything with other keys
+var keySeed = flag.Uint64( "keyseed", 1, "seed for the keys tests and benchmarks generate" )
+
+//a generator for a test or benchmark. Each one starts from the same seed
+//so a single test can be rerun on its own and see the same keys
+func testKeys() *KeyGenerator {
+	return NewKeyGenerator(*keySeed)
+}
+
 //last known to perfectly work form of hash()
 func oldHash(data []byte, iterations int) [][]byte {
 	aHasher:= sha256.New()
@@ -146,6 +161,7 @@ func (aBloomFilter *boolBloomFilter) CheckMembership( data []byte) bool {
 //compares the reduced memory footprint integer method with the
 //naive boolean bucket method
 func TestFilterValidity(t *testing.T) {
+	randomKeys:= testKeys()
 	//initialize the filter
 	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:4}
 	workingFilter.BuildBuckets()
@@ -160,7 +176,7 @@ func TestFilterValidity(t *testing.T) {
 
 	//fill the testing byte array with random cryptographically secure bytes.
 	for i := 0; i < testingLength; i++ {
-		testBytes[i] = getArrayOfRandBytes(8)
+		testBytes[i] = randomKeys.Key(8)
 	
 		//might as well fill the bloom filter in the same loop
 		workingFilter.Add( testBytes[i] )
@@ -175,7 +191,7 @@ func TestFilterValidity(t *testing.T) {
 	//now check for values that are highly unlikely to be in the filter:
 		//this is a false positive test
 	for i := 0; i < testingLength; i++ {
-		randomData:= getArrayOfRandBytes(8)
+		randomData:= randomKeys.Key(8)
 
 		if workingFilter.CheckMembership(randomData)!= naiveFilter.CheckMembership(randomData){
 			fmt.Println( workingFilter.CheckMembership(randomData) , naiveFilter.CheckMembership(randomData))
@@ -211,11 +227,119 @@ func TestFilterValidity(t *testing.T) {
 
 }
 
-func (aBloomFilter *BloomFilter) randomFill( iterations int ) {
+//the iterator has to walk exactly the chain the old hash function built
+func TestIndexIterator(t *testing.T) {
+	randomKeys:= testKeys()
+	for _,dataDepth:= range []int{ 1, 2, 3, 4 } {
+		data:= randomKeys.Key( randomKeys.Intn(256) )
+
+		iterator:= newIndexIterator( data, dataDepth, 0 )
+		for i,aHash:= range oldHash( data, 50 ) {
+			expected:= bytesToInt( aHash[0:dataDepth] )
+
+			if anIndex:= iterator.next(); anIndex != expected{
+				t.Fatal("Iterator index differs from the old hash chain", dataDepth, i, anIndex, expected)
+			}
+		}
+	}
+}
+
+//Add and CheckMembership must never allocate, whatever the hash iterations
+func TestHotPathAllocations(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: moderateHash, DataDepth:2}
+	workingFilter.BuildBuckets()
+
+	data:= randomKeys.Key(32)
+	absent:= randomKeys.Key(32)
+
+	allocations:= testing.AllocsPerRun( 100, func() {
+		workingFilter.Add(data)
+	})
+	if allocations != 0{
+		t.Error("Add allocated", allocations)
+	}
+
+	allocations = testing.AllocsPerRun( 100, func() {
+		workingFilter.CheckMembership(data)
+		workingFilter.CheckMembership(absent)
+	})
+	if allocations != 0{
+		t.Error("CheckMembership allocated", allocations)
+	}
+
+	//seeding mixes in an extra hash, it must not cost an allocation
+	workingFilter.Seed = 42
+	allocations = testing.AllocsPerRun( 100, func() {
+		workingFilter.Add(data)
+		workingFilter.CheckMembership(absent)
+	})
+	if allocations != 0{
+		t.Error("Seeded filter allocated", allocations)
+	}
+}
+
+//the same seed gives the same buckets in any filter, a different
+//seed gives unrelated ones and 0 is the original chain
+func TestSeededFilters(t *testing.T) {
+	randomKeys:= testKeys()
+
+	build:= func( seed uint64 ) *BloomFilter {
+		aFilter:= &BloomFilter{HashIterations: standardHash, DataDepth:2, Seed: seed}
+		aFilter.BuildBuckets()
+		return aFilter
+	}
+	first, second, other, unseeded:= build(7), build(7), build(8), build(0)
+
+	testBytes:= make([][]byte, 500)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		first.Add(testBytes[i])
+		second.Add(testBytes[i])
+		other.Add(testBytes[i])
+		unseeded.Add(testBytes[i])
+	}
+
+	sameBuckets:= func( a, b *BloomFilter ) bool {
+		for i := range a.IntBuckets {
+			if a.IntBuckets[i] != b.IntBuckets[i]{
+				return false
+			}
+		}
+		return true
+	}
+
+	if !sameBuckets( first, second ){
+		t.Error("Filters with the same seed disagree")
+	}
+	if sameBuckets( first, other ) || sameBuckets( first, unseeded ){
+		t.Error("Filters with different seeds agree")
+	}
+	for i := range testBytes {
+		if !other.CheckMembership(testBytes[i]){
+			t.Fatal("Seeded filter lost an item", i)
+		}
+	}
+
+	//0 has to stay exactly the unseeded chain so old files keep working
+	for i,anIndex:= range unseeded.getIndices(testBytes[0]) {
+		expected:= bytesToInt( oldHash( testBytes[0], standardHash )[i][:2] )
+		if anIndex != expected{
+			t.Fatal("Seed 0 changed the hash chain", i)
+		}
+	}
+
+	//seeds have to match to compare
+	if _, err:= first.Compare(other); err != ErrIncompatible{
+		t.Error("Differently seeded filters were compared", err)
+	}
+}
+
+func (aBloomFilter *BloomFilter) randomFill( randomKeys *KeyGenerator, iterations int ) {
 	
 	for i := 0; i < iterations; i++ {
 		
-		aBloomFilter.Add( getArrayOfRandBytes( int(getArrayOfRandBytes(1)[0]) ) )
+		aBloomFilter.Add( randomKeys.Key( randomKeys.Intn(256) ) )
 
 	}
 
@@ -227,11 +351,12 @@ func (aBloomFilter *BloomFilter) randomFill( iterations int ) {
 //single bytes are used to ensure there is at least one collisions of input values
 //to make sure everything operates as usual under those circumstances
 func TestFilterIO( t *testing.T ) {
+	randomKeys:= testKeys()
 	workingFilter:= BloomFilter{HashIterations: largeHash, DataDepth:3}
 	workingFilter.BuildBuckets()
 
 	//get the data to add
-	dataToAdd:= getArrayOfRandBytes(125)
+	dataToAdd:= randomKeys.Key(125)
 
 	//add it via the high level function which uses the low level .Set
 		
@@ -260,9 +385,117 @@ func TestFilterIO( t *testing.T ) {
 
 }
 
+//hand crafted files that decode fine but would panic or misbehave once used
+func TestRetrieveRejectsCorrupt(t *testing.T) {
+	crafted:= []string{
+		//DataDepth 4 needs 2^26 words, not 3
+		`{"HashIterations":3,"DataDepth":4,"IntBuckets":[1,2,3]}`,
+		`{"HashIterations":3,"DataDepth":5,"IntBuckets":[]}`,
+		`{"HashIterations":0,"DataDepth":1,"IntBuckets":[0,0,0,0]}`,
+		`{"HashIterations":-1,"DataDepth":1,"IntBuckets":[0,0,0,0]}`,
+		`{"HashIterations":1000000000,"DataDepth":1,"IntBuckets":[0,0,0,0]}`,
+		`{"HashIterations":3,"DataDepth":1,"Folds":-1,"IntBuckets":[0,0,0,0,0,0,0,0]}`,
+		//folded below 64 buckets
+		`{"HashIterations":3,"DataDepth":1,"Folds":3,"IntBuckets":[]}`,
+		`{"HashIterations":3,"DataDepth":1,"IntBuckets":null}`,
+	}
+
+	for _,aFile:= range crafted {
+		if _, err:= parseFilter( []byte(aFile), false ); err != ErrCorrupt{
+			t.Error("Crafted filter wasn't rejected as corrupt", aFile, err)
+		}
+	}
+
+	valid:= `{"HashIterations":3,"DataDepth":1,"Folds":1,"IntBuckets":[0,0]}`
+	if _, err:= parseFilter( []byte(valid), false ); err!=nil{
+		t.Error("Valid folded filter was rejected", err)
+	}
+}
+
+//files, and what compressed files expand to, stop at MaxSerializedSize
+func TestSerializedSizeLimit(t *testing.T) {
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+	MaxSerializedSize = 1 << 16
+
+	//a megabyte of spaces is valid JSON padding and gzips down to about a kilobyte
+	var bomb bytes.Buffer
+	writer:= gzip.NewWriter(&bomb)
+	writer.Write( bytes.Repeat( []byte(" "), 1 << 20 ) )
+	writer.Write( []byte(`{"HashIterations":3,"DataDepth":1,"IntBuckets":[0,0,0,0]}`) )
+	writer.Close()
+
+	if bomb.Len() > 1 << 16{
+		t.Fatal("The bomb didn't compress under the limit", bomb.Len())
+	}
+	if _, err:= parseFilter( bomb.Bytes(), true ); err != ErrTooLarge{
+		t.Error("Decompression went past MaxSerializedSize", err)
+	}
+
+	fileName:= filepath.Join( t.TempDir(), "large.json" )
+	err:= os.WriteFile( fileName, bytes.Repeat( []byte(" "), 1 << 17 ), 0664 )
+	if err!=nil{
+		t.Fatal("Failed to write the large file", err)
+	}
+	if _, err:= RetrieveFilter( fileName, false ); err != ErrTooLarge{
+		t.Error("Reading went past MaxSerializedSize", err)
+	}
+
+	//corrupt gzip streams are reported rather than silently truncated
+	truncated:= bomb.Bytes()[:bomb.Len()/2]
+	if _, err:= parseFilter( truncated, true ); err==nil{
+		t.Error("Truncated gzip stream was accepted")
+	}
+}
+
+//adds the serialized forms of a structure, plain and compressed, to a fuzz corpus
+func addSerializedSeeds( f *testing.F, serialize func( fileName string, compress bool ) error ) {
+	for _,compress:= range []bool{ false, true } {
+		fileName:= filepath.Join( f.TempDir(), "seed" )
+		err:= serialize( fileName, compress )
+		if err!=nil{
+			f.Fatal("Failed to serialize a seed", err)
+		}
+
+		data, err:= os.ReadFile(fileName)
+		if err!=nil{
+			f.Fatal("Failed to read a seed", err)
+		}
+
+		f.Add( data, compress )
+	}
+}
+
+//anything parseFilter accepts has to be usable without panicking
+func FuzzParseFilter(f *testing.F) {
+	seed:= BloomFilter{HashIterations: 3, DataDepth: 1}
+	seed.BuildBuckets()
+	seed.Add( []byte("seed") )
+	addSerializedSeeds( f, seed.Serialize )
+
+	folded, _, _:= seed.Fold(1)
+	addSerializedSeeds( f, folded.Serialize )
+
+	f.Add( []byte(`{"HashIterations":3,"DataDepth":4,"IntBuckets":[1,2,3]}`), false )
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseFilter( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add(data)
+		if !aFilter.CheckMembership(data){
+			t.Fatal("Parsed filter lost an item")
+		}
+		aFilter.AddIfAbsent( []byte("another") )
+		aFilter.Stats()
+	})
+}
+
 /*
 
 func TestSerialize(t *testing.T) {
+	randomKeys:= testKeys()
 		//initialize the filter
 	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:3}
 	workingFilter.BuildBuckets()
@@ -275,7 +508,7 @@ func TestSerialize(t *testing.T) {
 
 	//fill the testing byte array with random cryptographically secure bytes.
 	for i := 0; i < testingLength; i++ {
-		testBytes[i] = getArrayOfRandBytes(8)
+		testBytes[i] = randomKeys.Key(8)
 		workingFilter.Add( testBytes[i] )
 	}
 
@@ -340,6 +573,7 @@ const(
 
 //checks the speed of the add function for the generated filter
 func BenchmarkAddSpeedLargeHash(b *testing.B) {
+	randomKeys:= testKeys()
 	//fmt.Println("Setting up the filter's benchmark environment")
 
 	//perform expensive setup
@@ -352,13 +586,14 @@ func BenchmarkAddSpeedLargeHash(b *testing.B) {
 
 	//start the timer!
 	for i := 0; i < b.N; i++ {
-		workingFilter.Add( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.Add( randomKeys.Key(randomKeys.Intn(256)) )
 	}
 
 }
 
 //checks the speed of the add function for the generated filter
 func BenchmarkAddSpeedModerateHash(b *testing.B) {
+	randomKeys:= testKeys()
 	//fmt.Println("Setting up the filter's benchmark environment")
 
 	//perform expensive setup
@@ -371,13 +606,14 @@ func BenchmarkAddSpeedModerateHash(b *testing.B) {
 
 	//start the timer!
 	for i := 0; i < b.N; i++ {
-		workingFilter.Add( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.Add( randomKeys.Key(randomKeys.Intn(256)) )
 	}
 
 }
 
 //checks the speed of the add function for the generated filter
 func BenchmarkAddSpeedStandardHash(b *testing.B) {
+	randomKeys:= testKeys()
 	//fmt.Println("Setting up the filter's benchmark environment")
 
 	//perform expensive setup
@@ -390,7 +626,7 @@ func BenchmarkAddSpeedStandardHash(b *testing.B) {
 
 	//start the timer!
 	for i := 0; i < b.N; i++ {
-		workingFilter.Add( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.Add( randomKeys.Key(randomKeys.Intn(256)) )
 	}
 
 }
@@ -398,6 +634,7 @@ func BenchmarkAddSpeedStandardHash(b *testing.B) {
 //checks the speed of the add function for the last known
 //to work perfectly due to naivity filter
 func BenchmarkAddSpeedStandardHashRef(b *testing.B) {
+	randomKeys:= testKeys()
 	//fmt.Println("Setting up the filter's benchmark environment")
 
 	//perform expensive setup
@@ -410,7 +647,7 @@ func BenchmarkAddSpeedStandardHashRef(b *testing.B) {
 
 	//start the timer!
 	for i := 0; i < b.N; i++ {
-		workingFilter.Add( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.Add( randomKeys.Key(randomKeys.Intn(256)) )
 	}
 
 }
@@ -418,6 +655,7 @@ func BenchmarkAddSpeedStandardHashRef(b *testing.B) {
 
 //checks the speed of the checkMembership function for the generated filter
 func BenchmarkCheckSpeedLargeHash(b *testing.B) {
+	randomKeys:= testKeys()
 	//fmt.Println("Setting up the filter's benchmark environment")
 
 	//perform expensive setup
@@ -430,13 +668,14 @@ func BenchmarkCheckSpeedLargeHash(b *testing.B) {
 
 	//start the timer!
 	for i := 0; i < b.N; i++ {
-		workingFilter.CheckMembership( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.CheckMembership( randomKeys.Key(randomKeys.Intn(256)) )
 	}
 
 }
 
 //checks the speed of the checkMembership function for the generated filter
 func BenchmarkCheckSpeedModerateHash(b *testing.B) {
+	randomKeys:= testKeys()
 	//fmt.Println("Setting up the filter's benchmark environment")
 
 	//perform expensive setup
@@ -449,13 +688,14 @@ func BenchmarkCheckSpeedModerateHash(b *testing.B) {
 
 	//start the timer!
 	for i := 0; i < b.N; i++ {
-		workingFilter.CheckMembership( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.CheckMembership( randomKeys.Key(randomKeys.Intn(256)) )
 	}
 
 }
 
 //checks the speed of the checkMembership function for the generated filter
 func BenchmarkCheckSpeedStandardHash(b *testing.B) {
+	randomKeys:= testKeys()
 	//fmt.Println("Setting up the filter's benchmark environment")
 
 	//perform expensive setup
@@ -468,7 +708,7 @@ func BenchmarkCheckSpeedStandardHash(b *testing.B) {
 
 	//start the timer!
 	for i := 0; i < b.N; i++ {
-		workingFilter.CheckMembership( getArrayOfRandBytes(getRandByteInt()) )
+		workingFilter.CheckMembership( randomKeys.Key(randomKeys.Intn(256)) )
 	}
 
 }
\ No newline at end of file
@@ -0,0 +1,146 @@
+package bloomFilter
+
+import(
+	"sync" //for serialising AddIfAbsent callers
+	"sync/atomic" //for setting and reading buckets from many goroutines
+)
+
+//the amount of locks AddIfAbsent callers are spread over
+const absentStripes = 64
+
+//a BloomFilter that is safe to use from many goroutines at once.
+//
+//Add and CheckMembership work on IntBuckets with atomic operations so
+//they never block. AddIfAbsent additionally takes one of a set of locks chosen
+//by the data's first index. Two callers adding the same data always pick the
+//same lock, so exactly one of them sees the data as absent.
+type ConcurrentFilter struct{
+	filter *BloomFilter
+
+	absentLocks [absentStripes]sync.Mutex
+}
+
+//wraps a built filter for concurrent use.
+//
+//the wrapped filter must not be used directly while the wrapper is in use.
+//panics for a filter built on a store, whose words it can't reach. Built on an
+//AtomicStore a plain filter is already safe to add to from many goroutines
+func NewConcurrentFilter( aBloomFilter *BloomFilter ) *ConcurrentFilter {
+	if aBloomFilter.store!=nil{
+		panic("a concurrent filter needs IntBuckets, use an AtomicStore instead")
+	}
+
+	return &ConcurrentFilter{ filter: aBloomFilter }
+}
+
+//sets the given bucket to filled, atomically
+func (aFilter *ConcurrentFilter) Set( index int ) {
+	atomic.OrUint64( &aFilter.filter.IntBuckets[index/64], 1<<(uint(index)%64) )
+	aFilter.markDirty( index/64 )
+}
+
+//marks the word changed for the next delta, after the word was written
+//so WriteDelta can't take the mark and miss the change
+func (aFilter *ConcurrentFilter) markDirty( word int ) {
+	if aFilter.filter.dirty!=nil{
+		atomic.OrUint64( &aFilter.filter.dirty[word/64], 1<<(uint(word)%64) )
+	}
+}
+
+//ors the mask into one of IntBuckets, reporting whether that filled any bucket.
+//
+//merging filters with the same constants word by word gives their union,
+//in any order and as many times over as wanted. Only words it changes are
+//marked for the next delta, so merged changes don't echo back forever
+func (aFilter *ConcurrentFilter) MergeWord( word int, mask uint64 ) bool {
+	if atomic.OrUint64( &aFilter.filter.IntBuckets[word], mask ) & mask == mask{
+		return false
+	}
+
+	aFilter.markDirty(word)
+	return true
+}
+
+//returns whether the given bucket is filled or not, atomically
+func (aFilter *ConcurrentFilter) Get( index int ) bool {
+	return atomic.LoadUint64( &aFilter.filter.IntBuckets[index/64] ) & (1<<(uint(index)%64)) != 0
+}
+
+//takes an array of bytes and adds it to the filter
+func (aFilter *ConcurrentFilter) Add( data []byte ) {
+
+	iterator:= aFilter.filter.newIterator(data)
+	for i := 0; i < aFilter.filter.HashIterations; i++ {
+		aFilter.Set( iterator.next() )
+	}
+
+}
+
+//takes an array of bytes and checks its membership in the filter
+func (aFilter *ConcurrentFilter) CheckMembership( data []byte ) bool {
+
+	iterator:= aFilter.filter.newIterator(data)
+	for i := 0; i < aFilter.filter.HashIterations; i++ {
+		if !aFilter.Get( iterator.next() ){
+			return false
+		}
+	}
+
+	return true
+}
+
+//adds the data to the filter and reports whether it was already a member.
+//
+//when several goroutines call this with the same data at once exactly one
+//of them gets false back, making it safe for deduplicating work
+func (aFilter *ConcurrentFilter) AddIfAbsent( data []byte ) (wasPresent bool) {
+
+	if aFilter.filter.HashIterations < 1{
+		return true
+	}
+
+	iterator:= aFilter.filter.newIterator(data)
+
+	//the first index picks the lock so equal data always contends for the same one
+	anIndex:= iterator.next()
+
+	lock:= &aFilter.absentLocks[ anIndex % absentStripes ]
+	lock.Lock()
+	defer lock.Unlock()
+
+	wasPresent = true
+	for i := 0; i < aFilter.filter.HashIterations; i++ {
+		if i > 0{
+			anIndex = iterator.next()
+		}
+
+		//an or that changed the word means this bucket was ours to set
+		mask:= uint64(1) << (uint(anIndex)%64)
+		if atomic.OrUint64( &aFilter.filter.IntBuckets[anIndex/64], mask ) & mask == 0{
+			wasPresent = false
+			aFilter.markDirty( anIndex/64 )
+		}
+	}
+
+	return wasPresent
+}
+
+//copies the wrapped filter with atomic reads so a consistent enough
+//snapshot can be taken while other goroutines keep adding
+func (aFilter *ConcurrentFilter) Snapshot() BloomFilter {
+	snapshot:= *aFilter.filter
+	snapshot.IntBuckets = make( []uint64, len(aFilter.filter.IntBuckets) )
+	snapshot.dirty = nil
+
+	for i := range snapshot.IntBuckets {
+		snapshot.IntBuckets[i] = atomic.LoadUint64( &aFilter.filter.IntBuckets[i] )
+	}
+
+	return snapshot
+}
+
+//serializes a snapshot of the filter, see BloomFilter.Serialize
+func (aFilter *ConcurrentFilter) Serialize( fileName string, compress bool ) error {
+	snapshot:= aFilter.Snapshot()
+	return snapshot.Serialize( fileName, compress )
+}
@@ -0,0 +1,103 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"sync"
+	"sync/atomic"
+
+)
+
+func TestAddIfAbsent(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:3}
+	workingFilter.BuildBuckets()
+
+	data:= randomKeys.Key(8)
+
+	if workingFilter.AddIfAbsent(data){
+		t.Error("New data reported as present")
+	}
+	if !workingFilter.AddIfAbsent(data){
+		t.Error("Added data reported as absent")
+	}
+	if !workingFilter.CheckMembership(data){
+		t.Error("AddIfAbsent did not add the data")
+	}
+}
+
+//many goroutines race to add the same keys, each key must be
+//reported absent exactly once
+func TestConcurrentAddIfAbsent(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:3}
+	workingFilter.BuildBuckets()
+	concurrentFilter:= NewConcurrentFilter(&workingFilter)
+
+	testBytes:= make([][]byte, 1000)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+	}
+
+	wins:= make([]int32, len(testBytes))
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 8; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range testBytes {
+				if !concurrentFilter.AddIfAbsent(testBytes[i]){
+					atomic.AddInt32( &wins[i], 1 )
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range wins {
+		if wins[i] != 1{
+			t.Fatal("Key was reported absent the wrong amount of times", i, wins[i])
+		}
+	}
+}
+
+//plain adds and checks from many goroutines end up with the same
+//buckets as a filter fed on one goroutine
+func TestConcurrentFilter(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	workingFilter.BuildBuckets()
+	concurrentFilter:= NewConcurrentFilter(&workingFilter)
+
+	sequential:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	sequential.BuildBuckets()
+
+	testBytes:= make([][]byte, 2000)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		sequential.Add(testBytes[i])
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func( worker int ) {
+			defer wg.Done()
+			for i := worker; i < len(testBytes); i+= 4 {
+				concurrentFilter.Add(testBytes[i])
+				if !concurrentFilter.CheckMembership(testBytes[i]){
+					t.Error("Freshly added key is not a member")
+				}
+			}
+		}( worker )
+	}
+	wg.Wait()
+
+	snapshot:= concurrentFilter.Snapshot()
+	for i := range sequential.IntBuckets {
+		if snapshot.IntBuckets[i] != sequential.IntBuckets[i]{
+			t.Fatal("Concurrent filter differs from the sequential filter")
+		}
+	}
+}
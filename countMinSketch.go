@@ -0,0 +1,207 @@
+package bloomFilter
+
+import(
+	"errors" //for refusing to merge mismatched sketches
+	"math" //for sizing from epsilon and delta
+)
+
+//returned when two structures can't be combined or compared as their
+//sizes or hash settings differ
+var ErrIncompatible = errors.New("bloomFilter: structures have different sizes or hash settings")
+
+//a count-min sketch for estimating how many times an item was seen.
+//
+//it answers 'roughly how many times?' where a BloomFilter answers 'have we seen this?'
+//and it hashes exactly like one: each row takes one hash from the same chained
+//sha256 that getIndices uses, truncated the same way, so a key means the same
+//thing to both structures.
+//
+//estimates never undercount. With probability 1 - Delta they overcount by at most
+//Epsilon times the total of all increments.
+//
+// Always call yourCountMinSketch.BuildCounters before doing anything else.
+type CountMinSketch struct{
+	//the acceptable overcount as a fraction of the total count
+	Epsilon float64
+
+	//the probability of exceeding the Epsilon bound
+	Delta float64
+
+	//counters per row, ceil(e / Epsilon). Set by BuildCounters
+	Width int
+
+	//rows, and so hash iterations, ceil(ln(1 / Delta)). Set by BuildCounters
+	Depth int
+
+	//the counters, row after row
+	Counts []uint64
+}
+
+//sizes the sketch from Epsilon and Delta then builds the counters.
+	//essentially a reset switch
+func (aSketch *CountMinSketch) BuildCounters() {
+	if aSketch.Epsilon <= 0 || aSketch.Epsilon >= 1 || aSketch.Delta <= 0 || aSketch.Delta >= 1{
+		panic("Epsilon and Delta must both be between 0 and 1")
+	}
+
+	aSketch.Width = int( math.Ceil( math.E / aSketch.Epsilon ) )
+	aSketch.Depth = int( math.Ceil( math.Log( 1 / aSketch.Delta ) ) )
+
+	aSketch.Counts = make( []uint64, aSketch.Width*aSketch.Depth )
+}
+
+//literally BuildCounters, for convention
+func (aSketch *CountMinSketch) Reset() {
+	aSketch.BuildCounters()
+}
+
+//the amount of bytes of each hash needed to cover a row.
+//mirrors a BloomFilter's DataDepth
+func (aSketch *CountMinSketch) dataDepth() int {
+	depth:= 1
+	for depth < 8 && uint64(aSketch.Width) > uint64(1)<<uint(depth*8){
+		depth++
+	}
+
+	return depth
+}
+
+//gets the position of the data's counter in every row
+func (aSketch *CountMinSketch) getIndices( data []byte ) []int {
+	indices:= indicesOf( data, aSketch.Depth, aSketch.dataDepth(), 0 )
+
+	//bring each index into its row
+	for row,anIndex:= range indices{
+		indices[row] = row*aSketch.Width + anIndex % aSketch.Width
+	}
+
+	return indices
+}
+
+//adds count to every counter of the given data
+func (aSketch *CountMinSketch) Increment( data []byte, count uint64 ) {
+
+	for _,anIndex:= range aSketch.getIndices(data){
+		aSketch.Counts[anIndex]+= count
+	}
+
+}
+
+//adds count using the conservative update rule: counters are only raised as far
+//as the new estimate for the data requires. This keeps counters shared with
+//heavy items from growing needlessly and noticeably tightens estimates.
+//
+//a sketch should be fed exclusively through either Increment or ConservativeIncrement,
+//mixing them is allowed but loses the tighter estimates
+func (aSketch *CountMinSketch) ConservativeIncrement( data []byte, count uint64 ) {
+
+	indices:= aSketch.getIndices(data)
+
+	target:= aSketch.estimateIndices(indices) + count
+
+	for _,anIndex:= range indices{
+		if aSketch.Counts[anIndex] < target{
+			aSketch.Counts[anIndex] = target
+		}
+	}
+
+}
+
+//returns the estimated count of the given data.
+//never less than the true count
+func (aSketch *CountMinSketch) Estimate( data []byte ) uint64 {
+	return aSketch.estimateIndices( aSketch.getIndices(data) )
+}
+
+//the smallest counter among the indices
+func (aSketch *CountMinSketch) estimateIndices( indices []int ) uint64 {
+	estimate:= uint64(math.MaxUint64)
+
+	for _,anIndex:= range indices{
+		if aSketch.Counts[anIndex] < estimate{
+			estimate = aSketch.Counts[anIndex]
+		}
+	}
+
+	return estimate
+}
+
+//adds the counts of another sketch into this one.
+//the result is the sketch of both streams combined.
+//
+//both sketches must have been built with the same Epsilon and Delta
+func (aSketch *CountMinSketch) Merge( other *CountMinSketch ) error {
+	if aSketch.Width != other.Width || aSketch.Depth != other.Depth ||
+		len(aSketch.Counts) != len(other.Counts){
+		return ErrIncompatible
+	}
+
+	for i,aCount:= range other.Counts{
+		aSketch.Counts[i]+= aCount
+	}
+
+	return nil
+}
+
+//serializes a sketch, see BloomFilter.Serialize
+func (aSketch *CountMinSketch) Serialize(fileName string, compress bool) error {
+	return writeSerialized( fileName, aSketch, compress )
+}
+
+//attempts to deserialize a file into a sketch.
+//the counterpart to CountMinSketch.Serialize
+func RetrieveCountMinSketch(fileName string, compressed bool) (CountMinSketch, error) {
+
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return CountMinSketch{}, err
+	}
+
+	return parseCountMinSketch( data, compressed )
+}
+
+//the parsing half of RetrieveCountMinSketch
+func parseCountMinSketch(data []byte, compressed bool) (CountMinSketch, error) {
+
+	var aSketch CountMinSketch
+
+	err:= decodeSerialized( data, compressed, &aSketch )
+	if err!=nil{
+		return CountMinSketch{}, err
+	}
+
+	err = aSketch.Validate()
+	if err!=nil{
+		return CountMinSketch{}, err
+	}
+
+	return aSketch, nil
+}
+
+//checks that Epsilon and Delta are between 0 and 1, that Width and Depth are
+//what BuildCounters would size from them and that there are Width * Depth counters.
+//
+//returns ErrCorrupt if any of them is broken
+func (aSketch *CountMinSketch) Validate() error {
+	if !(aSketch.Epsilon > 0 && aSketch.Epsilon < 1 && aSketch.Delta > 0 && aSketch.Delta < 1){
+		return ErrCorrupt
+	}
+
+	//compared as floats so a tiny Epsilon can't overflow the conversion
+	if float64(aSketch.Width) != math.Ceil( math.E / aSketch.Epsilon ) ||
+		float64(aSketch.Depth) != math.Ceil( math.Log( 1 / aSketch.Delta ) ){
+		return ErrCorrupt
+	}
+	if aSketch.Depth > MaxHashIterations{
+		return ErrCorrupt
+	}
+
+	//Width is at least 3 and Depth at least 1, so a product that overflowed
+	//can't divide back out to Width
+	counters:= aSketch.Width*aSketch.Depth
+	if counters / aSketch.Depth != aSketch.Width || len(aSketch.Counts) != counters{
+		return ErrCorrupt
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"path/filepath"
+
+)
+
+//feeds a skewed stream into a plain and a conservative sketch and checks
+//every estimate against the true counts and the epsilon bound
+func TestCountMinSketchEstimates(t *testing.T) {
+	randomKeys:= testKeys()
+	regular:= CountMinSketch{Epsilon: 0.001, Delta: 0.01}
+	regular.BuildCounters()
+
+	conservative:= CountMinSketch{Epsilon: 0.001, Delta: 0.01}
+	conservative.BuildCounters()
+
+	keys:= make([][]byte, 2000)
+	truth:= make([]uint64, len(keys))
+	var total uint64
+
+	for i := range keys {
+		keys[i] = randomKeys.Key(8)
+
+		//a few heavy keys and a long tail
+		truth[i] = uint64( 1 + 1000 / (i+1) )
+		total+= truth[i]
+
+		regular.Increment( keys[i], truth[i] )
+		conservative.ConservativeIncrement( keys[i], truth[i] )
+	}
+
+	bound:= uint64( regular.Epsilon * float64(total) )
+
+	var overBound int
+	for i := range keys {
+		regularEstimate:= regular.Estimate(keys[i])
+		conservativeEstimate:= conservative.Estimate(keys[i])
+
+		if regularEstimate < truth[i] || conservativeEstimate < truth[i]{
+			t.Fatal("Sketch undercounted", truth[i], regularEstimate, conservativeEstimate)
+		}
+
+		if conservativeEstimate > regularEstimate{
+			t.Error("Conservative update estimated above the regular update", conservativeEstimate, regularEstimate)
+		}
+
+		if regularEstimate - truth[i] > bound{
+			overBound++
+		}
+	}
+
+	//delta is 1% so allow a little slack over that
+	if float64(overBound) > 0.02*float64(len(keys)){
+		t.Error("Too many estimates exceeded the epsilon bound", overBound)
+	}
+}
+
+func TestCountMinSketchMerge(t *testing.T) {
+	randomKeys:= testKeys()
+	first:= CountMinSketch{Epsilon: 0.01, Delta: 0.01}
+	first.BuildCounters()
+	second:= CountMinSketch{Epsilon: 0.01, Delta: 0.01}
+	second.BuildCounters()
+	combined:= CountMinSketch{Epsilon: 0.01, Delta: 0.01}
+	combined.BuildCounters()
+
+	for i := 0; i < 500; i++ {
+		data:= randomKeys.Key(8)
+		if i%2 == 0{
+			first.Increment(data, 3)
+		}else{
+			second.Increment(data, 3)
+		}
+		combined.Increment(data, 3)
+	}
+
+	err:= first.Merge(&second)
+	if err!=nil{
+		t.Fatal("Failed to merge matching sketches", err)
+	}
+
+	for i := range combined.Counts {
+		if first.Counts[i] != combined.Counts[i]{
+			t.Fatal("Merged sketch differs from a sketch fed both streams at counter", i)
+		}
+	}
+
+	mismatched:= CountMinSketch{Epsilon: 0.1, Delta: 0.01}
+	mismatched.BuildCounters()
+	if first.Merge(&mismatched) != ErrIncompatible{
+		t.Error("Merging differently sized sketches did not fail")
+	}
+}
+
+//anything parseCountMinSketch accepts has to be usable without panicking
+func FuzzParseCountMinSketch(f *testing.F) {
+	seed:= CountMinSketch{Epsilon: 0.1, Delta: 0.1}
+	seed.BuildCounters()
+	seed.Increment( []byte("seed"), 3 )
+	addSerializedSeeds( f, seed.Serialize )
+
+	f.Add( []byte(`{"Epsilon":0.1,"Delta":0.1,"Width":28,"Depth":3,"Counts":[1]}`), false )
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aSketch, err:= parseCountMinSketch( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aSketch.Increment( data, 1 )
+		aSketch.ConservativeIncrement( data, 1 )
+		if aSketch.Estimate(data) < 2{
+			t.Fatal("Parsed sketch undercounted")
+		}
+	})
+}
+
+func TestCountMinSketchSerialize(t *testing.T) {
+	randomKeys:= testKeys()
+	workingSketch:= CountMinSketch{Epsilon: 0.01, Delta: 0.05}
+	workingSketch.BuildCounters()
+
+	testBytes:= make([][]byte, 100)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		workingSketch.Increment( testBytes[i], uint64(i) )
+	}
+
+	fileName:= filepath.Join( t.TempDir(), "sketch.json" )
+	err:= workingSketch.Serialize(fileName, true)
+	if err!=nil{
+		t.Fatal("Failed to serialize the sketch!", err)
+	}
+
+	retrieved, err:= RetrieveCountMinSketch(fileName, true)
+	if err!=nil{
+		t.Fatal("Failed to deserialize the sketch!", err)
+	}
+
+	for i := range testBytes {
+		if workingSketch.Estimate(testBytes[i]) != retrieved.Estimate(testBytes[i]){
+			t.Error("Retrieved sketch disagrees with the original", testBytes[i])
+		}
+	}
+}
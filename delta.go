@@ -0,0 +1,368 @@
+package bloomFilter
+
+import(
+	"bufio" //for writing deltas word by word
+	"encoding/binary" //for the delta's little endian words and varints
+	"errors" //for deltas from untracked filters
+	"hash/crc32" //for refusing deltas damaged in transit
+	"io" //for streaming deltas
+	"math/bits" //for walking the dirty bitmap
+	"sync/atomic" //for taking dirty words from a ConcurrentFilter
+)
+
+//returned by WriteDelta when TrackChanges was never called
+var ErrNotTracking = errors.New("bloomFilter: filter isn't tracking changes")
+
+//the first bytes of every delta, versioned so the format can change
+const deltaMagic = "goFilterDelta\x00\x00\x01"
+
+//starts recording which of IntBuckets change so WriteDelta can write just those.
+//
+//nothing counts as changed until the next Add or Set. Every IntBucket changed
+//costs one bit in a bitmap alongside them, 1/64th of the filter. Tracking stays
+//on until BuildBuckets, which marks every word changed as it clears them all.
+//copies of the filter share the bitmap, so only track the one being written to
+func (aBloomFilter *BloomFilter) TrackChanges() {
+	aBloomFilter.dirty = make( []uint64, (aBloomFilter.heldWords() + 63) / 64 )
+}
+
+//marks every word changed, for when they all are
+func (aBloomFilter *BloomFilter) markAllDirty() {
+	aBloomFilter.dirty = make( []uint64, (aBloomFilter.heldWords() + 63) / 64 )
+	for i := range aBloomFilter.heldWords() {
+		aBloomFilter.dirty[i/64]|= 1 << (uint(i)%64)
+	}
+}
+
+//how many IntBuckets have changed since tracking started or the last WriteDelta,
+//what the next delta will carry
+func (aBloomFilter *BloomFilter) ChangedWords() int {
+	changed:= 0
+	for _,aWord:= range aBloomFilter.dirty {
+		changed+= bits.OnesCount64(aWord)
+	}
+
+	return changed
+}
+
+//writes every IntBucket changed since tracking started or the last WriteDelta,
+//which ApplyDelta then copies into a filter holding the same words as this one
+//did before them. A base snapshot and each later delta in order rebuild the
+//filter exactly, including any BuildBuckets in between.
+//
+//the words are only counted as written once the whole delta is, a failed write
+//leaves them for the next delta. The layout, little endian throughout, is:
+//
+//	deltaMagic
+//	HashIterations, DataDepth, Folds, Strategy, Size, Seed, len(IntBuckets)
+//		as uvarints, checked by ApplyDelta
+//	runs of consecutive changed words:
+//		the gap since the last run ended and the run's length as uvarints
+//		the words themselves, 8 bytes each
+//	a run of length 0
+//	the crc32c of everything before it
+//
+//returns ErrNotTracking unless TrackChanges was called
+func (aBloomFilter *BloomFilter) WriteDelta( writer io.Writer ) error {
+	if aBloomFilter.dirty == nil{
+		return ErrNotTracking
+	}
+
+	//a store's words are copied out once rather than a bit at a time
+	words:= aBloomFilter.words()
+	err:= writeDelta( writer, aBloomFilter, func( i int ) uint64 {
+		return aBloomFilter.dirty[i]
+	}, func( i int ) uint64 {
+		return words[i]
+	})
+	if err!=nil{
+		return err
+	}
+
+	clear(aBloomFilter.dirty)
+
+	return nil
+}
+
+//WriteDelta while other goroutines carry on adding, see BloomFilter.WriteDelta.
+//the wrapped filter must have been tracking changes before it was wrapped.
+//
+//each word's change is taken before the word is read, so an add racing the
+//delta is in it or still marked for the next one, never lost
+func (aFilter *ConcurrentFilter) WriteDelta( writer io.Writer ) error {
+	dirty:= aFilter.filter.dirty
+	if dirty == nil{
+		return ErrNotTracking
+	}
+
+	//what was taken goes back if the delta doesn't make it out
+	taken:= make( []uint64, len(dirty) )
+	err:= writeDelta( writer, aFilter.filter, func( i int ) uint64 {
+		taken[i] = atomic.SwapUint64( &dirty[i], 0 )
+		return taken[i]
+	}, func( i int ) uint64 {
+		return atomic.LoadUint64( &aFilter.filter.IntBuckets[i] )
+	})
+	if err!=nil{
+		for i,aWord:= range taken {
+			if aWord != 0{
+				atomic.OrUint64( &dirty[i], aWord )
+			}
+		}
+	}
+
+	return err
+}
+
+//hands every word changed since tracking started or the last call to visit,
+//with its current value, and counts them as taken. For shipping changes in a
+//format of your own, see the replication package. Adds can carry on meanwhile,
+//as with WriteDelta.
+//
+//returns ErrNotTracking unless the wrapped filter was tracking changes
+func (aFilter *ConcurrentFilter) TakeChanges( visit func( word int, value uint64 ) ) error {
+	dirty:= aFilter.filter.dirty
+	if dirty == nil{
+		return ErrNotTracking
+	}
+
+	for i := range dirty {
+		changed:= atomic.SwapUint64( &dirty[i], 0 )
+
+		for changed != 0{
+			anIndex:= i*64 + bits.TrailingZeros64(changed)
+			changed&= changed - 1
+
+			visit( anIndex, atomic.LoadUint64( &aFilter.filter.IntBuckets[anIndex] ) )
+		}
+	}
+
+	return nil
+}
+
+//the constants two filters must share to exchange deltas, in the order a delta's
+//header holds them: HashIterations, DataDepth, Folds, Strategy, Size, Seed and
+//the amount of 64 bit words held, whether in IntBuckets or a store
+func (aBloomFilter *BloomFilter) Constants() [7]uint64 {
+	return [7]uint64{ uint64( aBloomFilter.HashIterations ), uint64( aBloomFilter.DataDepth ),
+		uint64( aBloomFilter.Folds ), uint64( aBloomFilter.Strategy ), uint64( aBloomFilter.Size ),
+		aBloomFilter.Seed, uint64( aBloomFilter.heldWords() ) }
+}
+
+//writes a delta of the words marked in the bitmap. takeDirty returns one
+//word of the bitmap, loadWord one of IntBuckets
+func writeDelta( writer io.Writer, aBloomFilter *BloomFilter, takeDirty func( int ) uint64, loadWord func( int ) uint64 ) error {
+	checksum:= crc32.New(walTable)
+	buffered:= bufio.NewWriter( io.MultiWriter( writer, checksum ) )
+
+	buffered.WriteString(deltaMagic)
+
+	var scratch [binary.MaxVarintLen64]byte
+	putUvarint:= func( value uint64 ) {
+		buffered.Write( scratch[ : binary.PutUvarint( scratch[:], value ) ] )
+	}
+	for _,aConstant:= range aBloomFilter.Constants() {
+		putUvarint(aConstant)
+	}
+
+	//runs are found a bitmap word at a time, then written out once they end
+	words:= aBloomFilter.heldWords()
+	lastEnd, runStart, runLength:= 0, 0, 0
+	flushRun:= func() {
+		if runLength == 0{
+			return
+		}
+
+		putUvarint( uint64( runStart - lastEnd ) )
+		putUvarint( uint64(runLength) )
+
+		var word [8]byte
+		for i := runStart; i < runStart + runLength; i++ {
+			binary.LittleEndian.PutUint64( word[:], loadWord(i) )
+			buffered.Write( word[:] )
+		}
+
+		lastEnd = runStart + runLength
+		runLength = 0
+	}
+
+	for i := 0; i*64 < words; i++ {
+		changed:= takeDirty(i)
+
+		for changed != 0{
+			anIndex:= i*64 + bits.TrailingZeros64(changed)
+			changed&= changed - 1
+
+			if runLength > 0 && runStart + runLength == anIndex{
+				runLength++
+				continue
+			}
+
+			flushRun()
+			runStart, runLength = anIndex, 1
+		}
+	}
+	flushRun()
+
+	//the empty run that ends the delta
+	putUvarint(0)
+	putUvarint(0)
+
+	err:= buffered.Flush()
+	if err!=nil{
+		return err
+	}
+
+	var sum [4]byte
+	binary.LittleEndian.PutUint32( sum[:], checksum.Sum32() )
+	_, err = writer.Write( sum[:] )
+
+	return err
+}
+
+//copies the words in a delta written by WriteDelta into the filter, overwriting
+//whatever they held. Only what the delta describes is read so deltas can follow
+//each other in one stream, pass a bufio.Reader to read it efficiently.
+//
+//nothing is applied until the whole delta is read and its checksum matches.
+//Returns ErrIncompatible for a delta from a filter with other constants or
+//another amount of IntBuckets, ErrCorrupt for a damaged or truncated delta and
+//ErrTooLarge for one longer than MaxSerializedSize.
+//
+//changes applied are marked if the filter is tracking them, so a replica can
+//pass deltas along. A filter built on a store can't have its words overwritten
+//and returns ErrNeedsIntBuckets
+func (aBloomFilter *BloomFilter) ApplyDelta( reader io.Reader ) error {
+	if aBloomFilter.store!=nil{
+		return ErrNeedsIntBuckets
+	}
+
+	checksum:= crc32.New(walTable)
+	tee:= &deltaReader{ reader: reader, checksum: checksum }
+
+	magic:= make( []byte, len(deltaMagic) )
+	if _, err:= io.ReadFull( tee, magic ); err != nil || string(magic) != deltaMagic{
+		return ErrCorrupt
+	}
+
+	for _,aConstant:= range aBloomFilter.Constants() {
+		value, err:= binary.ReadUvarint(tee)
+		if err!=nil{
+			return tee.fail(err)
+		}
+		if value != aConstant{
+			return ErrIncompatible
+		}
+	}
+
+	//staged then applied once the checksum says the delta is whole
+	type run struct{ start int; words []uint64 }
+	var runs []run
+
+	position:= 0
+	words:= len(aBloomFilter.IntBuckets)
+	for {
+		gap, err:= binary.ReadUvarint(tee)
+		if err!=nil{
+			return tee.fail(err)
+		}
+		length, err:= binary.ReadUvarint(tee)
+		if err!=nil{
+			return tee.fail(err)
+		}
+		if length == 0{
+			break
+		}
+
+		//overlapping or overrunning runs can only come from a damaged delta
+		if gap > uint64( words - position ) || length > uint64( words - position ) - gap{
+			return ErrCorrupt
+		}
+		start:= position + int(gap)
+		position = start + int(length)
+
+		//grown a word at a time so a lying length can't allocate more than the delta holds
+		staged:= run{ start: start }
+		var word [8]byte
+		for i := uint64(0); i < length; i++ {
+			if _, err:= io.ReadFull( tee, word[:] ); err!=nil{
+				return tee.fail(err)
+			}
+			staged.words = append( staged.words, binary.LittleEndian.Uint64( word[:] ) )
+		}
+		runs = append( runs, staged )
+	}
+
+	expected:= checksum.Sum32()
+	var sum [4]byte
+	if _, err:= io.ReadFull( tee, sum[:] ); err!=nil{
+		return tee.fail(err)
+	}
+	if binary.LittleEndian.Uint32( sum[:] ) != expected{
+		return ErrCorrupt
+	}
+
+	for _,aRun:= range runs {
+		for i,aWord:= range aRun.words {
+			anIndex:= aRun.start + i
+			aBloomFilter.IntBuckets[anIndex] = aWord
+			if aBloomFilter.dirty != nil{
+				aBloomFilter.dirty[anIndex/64]|= 1 << (uint(anIndex)%64)
+			}
+		}
+	}
+
+	return nil
+}
+
+//reads a delta, checksumming everything read and stopping at MaxSerializedSize.
+//never reads past what it's asked for, so the stream carries on after the delta
+type deltaReader struct{
+	reader io.Reader
+	checksum io.Writer
+	read int64
+}
+
+func (aReader *deltaReader) Read( data []byte ) (int, error) {
+	if aReader.read + int64( len(data) ) > MaxSerializedSize{
+		aReader.read = MaxSerializedSize + 1
+		return 0, ErrTooLarge
+	}
+
+	read, err:= aReader.reader.Read(data)
+	aReader.checksum.Write( data[:read] )
+	aReader.read+= int64(read)
+
+	return read, err
+}
+
+//for the uvarints, a single byte read unless the reader can do better
+func (aReader *deltaReader) ReadByte() (byte, error) {
+	var aByte [1]byte
+
+	if byteReader, ok:= aReader.reader.(io.ByteReader); ok && aReader.read < MaxSerializedSize{
+		read, err:= byteReader.ReadByte()
+		if err!=nil{
+			return 0, err
+		}
+		aByte[0] = read
+		aReader.checksum.Write( aByte[:] )
+		aReader.read++
+		return read, nil
+	}
+
+	_, err:= io.ReadFull( aReader, aByte[:] )
+	return aByte[0], err
+}
+
+//what a read error means for the delta as a whole
+func (aReader *deltaReader) fail( err error ) error {
+	if aReader.read > MaxSerializedSize || err == ErrTooLarge{
+		return ErrTooLarge
+	}
+	if err == io.EOF || err == io.ErrUnexpectedEOF{
+		return ErrCorrupt
+	}
+
+	return err
+}
@@ -0,0 +1,296 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bufio"
+	"bytes"
+	"errors"
+	"slices"
+	"sync"
+
+)
+
+//a replica with the same constants and buckets
+func cloneFilter( aBloomFilter *BloomFilter ) *BloomFilter {
+	clone:= *aBloomFilter
+	clone.IntBuckets = slices.Clone( aBloomFilter.IntBuckets )
+	clone.dirty = nil
+
+	return &clone
+}
+
+func deltaKeys( randomKeys *KeyGenerator, count int ) [][]byte {
+	keys:= make([][]byte, count)
+	for i := range keys {
+		keys[i] = randomKeys.Key(16)
+	}
+
+	return keys
+}
+
+//a writer that fails part way through
+type failingWriter struct{ left int }
+
+func (aWriter *failingWriter) Write( data []byte ) (int, error) {
+	if len(data) > aWriter.left{
+		return 0, errors.New("disk full")
+	}
+	aWriter.left-= len(data)
+
+	return len(data), nil
+}
+
+func TestDeltaRoundTrip(t *testing.T) {
+	randomKeys:= testKeys()
+
+	primary:= &BloomFilter{ HashIterations: standardHash, DataDepth: 3 }
+	primary.BuildBuckets()
+	primary.AddBatch( deltaKeys( randomKeys, 1000 ) )
+
+	replica:= cloneFilter(primary)
+	primary.TrackChanges()
+	if primary.ChangedWords() != 0{
+		t.Fatal("Words were changed before any add")
+	}
+
+	//a stream of deltas applied in order
+	var stream bytes.Buffer
+	for round := 0; round < 3; round++ {
+		primary.AddBatch( deltaKeys( randomKeys, 50 ) )
+
+		changed:= primary.ChangedWords()
+		if changed == 0 || changed > 50*standardHash{
+			t.Fatal("Changed words are off", changed)
+		}
+
+		before:= stream.Len()
+		if err:= primary.WriteDelta(&stream); err!=nil{
+			t.Fatal("Failed to write a delta", err)
+		}
+		//each scattered word costs itself plus a varint gap and length
+		if written:= stream.Len() - before; written > changed*12 + 100{
+			t.Error("Delta is larger than its changes", written, changed)
+		}
+		if primary.ChangedWords() != 0{
+			t.Error("Written words still counted as changed")
+		}
+	}
+
+	//nothing changed is still a delta
+	primary.WriteDelta(&stream)
+
+	reader:= bufio.NewReader(&stream)
+	for i := 0; i < 4; i++ {
+		if err:= replica.ApplyDelta(reader); err!=nil{
+			t.Fatal("Failed to apply a delta", i, err)
+		}
+	}
+	if reader.Buffered() != 0 || !slices.Equal( primary.IntBuckets, replica.IntBuckets ){
+		t.Fatal("Replica differs after applying deltas")
+	}
+
+	//clearing the filter is a change like any other
+	primary.Reset()
+	if primary.ChangedWords() != len(primary.IntBuckets){
+		t.Error("Reset didn't mark every word", primary.ChangedWords())
+	}
+	stream.Reset()
+	primary.WriteDelta(&stream)
+	replica.ApplyDelta(&stream)
+	if !slices.Equal( primary.IntBuckets, replica.IntBuckets ){
+		t.Error("Replica wasn't cleared by the delta")
+	}
+
+	//a failed write leaves the words for the next delta
+	primary.Add( randomKeys.Key(8) )
+	changed:= primary.ChangedWords()
+	if err:= primary.WriteDelta( &failingWriter{ left: 20 } ); err == nil || primary.ChangedWords() != changed{
+		t.Error("Failed delta lost its changes", err, primary.ChangedWords())
+	}
+
+	allocations:= testing.AllocsPerRun( 100, func() {
+		primary.Add(stream.Bytes())
+	})
+	if allocations != 0{
+		t.Error("Tracking changes allocated", allocations)
+	}
+}
+
+//deltas taken while other goroutines add still rebuild the filter
+func TestConcurrentDelta(t *testing.T) {
+	aBloomFilter:= &BloomFilter{ HashIterations: standardHash, DataDepth: 2 }
+	aBloomFilter.BuildBuckets()
+	replica:= cloneFilter(aBloomFilter)
+
+	aBloomFilter.TrackChanges()
+	aFilter:= NewConcurrentFilter(aBloomFilter)
+
+	var group sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		group.Add(1)
+		go func( seed uint64 ) {
+			defer group.Done()
+			randomKeys:= NewKeyGenerator(seed)
+			for j := 0; j < 2000; j++ {
+				if j % 2 == 0{
+					aFilter.Add( randomKeys.Key(8) )
+				}else{
+					aFilter.AddIfAbsent( randomKeys.Key(8) )
+				}
+			}
+		}( uint64(i) )
+	}
+
+	for done:= false; !done; {
+		select{
+		case <-waitGroupDone(&group):
+			done = true
+		default:
+		}
+
+		var delta bytes.Buffer
+		if err:= aFilter.WriteDelta(&delta); err!=nil{
+			t.Fatal("Failed to write a concurrent delta", err)
+		}
+		if err:= replica.ApplyDelta(&delta); err!=nil{
+			t.Fatal("Failed to apply a concurrent delta", err)
+		}
+	}
+
+	var delta bytes.Buffer
+	aFilter.WriteDelta(&delta)
+	replica.ApplyDelta(&delta)
+
+	snapshot:= aFilter.Snapshot()
+	if !slices.Equal( snapshot.IntBuckets, replica.IntBuckets ){
+		t.Error("Replica differs from the concurrent filter")
+	}
+
+	aFilter.Add( []byte("one more") )
+	if err:= aFilter.WriteDelta( &failingWriter{} ); err == nil || aBloomFilter.ChangedWords() == 0{
+		t.Error("Failed concurrent delta lost its changes", err)
+	}
+}
+
+//changes taken from one filter and merged into another rebuild it,
+//and merging what's already there changes nothing
+func TestTakeChangesMerge(t *testing.T) {
+	randomKeys:= testKeys()
+
+	aBloomFilter:= &BloomFilter{ HashIterations: standardHash, DataDepth: 2 }
+	aBloomFilter.BuildBuckets()
+	replica:= NewConcurrentFilter( cloneFilter(aBloomFilter) )
+
+	if err:= NewConcurrentFilter(aBloomFilter).TakeChanges(func( int, uint64 ) {}); err != ErrNotTracking{
+		t.Error("Took changes without tracking", err)
+	}
+
+	aBloomFilter.TrackChanges()
+	aFilter:= NewConcurrentFilter(aBloomFilter)
+	for i := 0; i < 500; i++ {
+		aFilter.Add( randomKeys.Key(8) )
+	}
+
+	taken:= 0
+	aFilter.TakeChanges(func( word int, value uint64 ) {
+		taken++
+		if !replica.MergeWord( word, value ){
+			t.Fatal("Merging new bits changed nothing", word)
+		}
+	})
+	if taken == 0 || aBloomFilter.ChangedWords() != 0{
+		t.Error("Changes weren't taken", taken, aBloomFilter.ChangedWords())
+	}
+
+	snapshot, merged:= aFilter.Snapshot(), replica.Snapshot()
+	if !slices.Equal( snapshot.IntBuckets, merged.IntBuckets ){
+		t.Error("Merged changes differ from the filter")
+	}
+
+	for i,aWord:= range snapshot.IntBuckets {
+		if aWord != 0 && aFilter.MergeWord( i, aWord ){
+			t.Fatal("Merging bits already there changed the filter", i)
+		}
+	}
+	if aBloomFilter.ChangedWords() != 0{
+		t.Error("Merging nothing new marked words")
+	}
+}
+
+//closes once the group is done
+func waitGroupDone( group *sync.WaitGroup ) <-chan struct{} {
+	done:= make( chan struct{} )
+	go func() {
+		group.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+func TestDeltaRejects(t *testing.T) {
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+
+	aBloomFilter:= &BloomFilter{ HashIterations: standardHash, DataDepth: 2 }
+	aBloomFilter.BuildBuckets()
+
+	if err:= aBloomFilter.WriteDelta( &bytes.Buffer{} ); err != ErrNotTracking{
+		t.Error("Wrote a delta without tracking", err)
+	}
+
+	aBloomFilter.TrackChanges()
+	for i := 0; i < 100; i++ {
+		aBloomFilter.Add( []byte{ byte(i) } )
+	}
+	var delta bytes.Buffer
+	aBloomFilter.WriteDelta(&delta)
+	valid:= delta.Bytes()
+
+	seeded:= cloneFilter(aBloomFilter)
+	seeded.Seed = 1
+	if err:= seeded.ApplyDelta( bytes.NewReader(valid) ); err != ErrIncompatible{
+		t.Error("Applied a delta from another seed", err)
+	}
+
+	replica:= cloneFilter(aBloomFilter)
+	replica.Reset()
+	for i := len(deltaMagic); i < len(valid); i++ {
+		damaged:= bytes.Clone(valid)
+		damaged[i]^= 0x10
+		if err:= replica.ApplyDelta( bytes.NewReader(damaged) ); err == nil{
+			t.Fatal("Applied a damaged delta", i)
+		}
+		if err:= replica.ApplyDelta( bytes.NewReader( valid[:i] ) ); err != ErrCorrupt{
+			t.Fatal("Applied a truncated delta", i, err)
+		}
+	}
+	if slices.ContainsFunc( replica.IntBuckets, func( aWord uint64 ) bool { return aWord != 0 } ){
+		t.Error("A rejected delta was partly applied")
+	}
+
+	MaxSerializedSize = 64
+	if err:= replica.ApplyDelta( bytes.NewReader(valid) ); err != ErrTooLarge{
+		t.Error("Applied a delta past MaxSerializedSize", err)
+	}
+}
+
+func FuzzApplyDelta(f *testing.F) {
+	aBloomFilter:= &BloomFilter{ HashIterations: 3, DataDepth: 1 }
+	aBloomFilter.BuildBuckets()
+	aBloomFilter.TrackChanges()
+	aBloomFilter.Add( []byte("seed") )
+
+	var delta bytes.Buffer
+	aBloomFilter.WriteDelta(&delta)
+	f.Add( delta.Bytes() )
+
+	f.Fuzz(func( t *testing.T, data []byte ) {
+		replica:= &BloomFilter{ HashIterations: 3, DataDepth: 1 }
+		replica.BuildBuckets()
+
+		if replica.ApplyDelta( bytes.NewReader(data) ) == nil && replica.Validate() != nil{
+			t.Fatal("Applying a delta broke the filter")
+		}
+	})
+}
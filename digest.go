@@ -0,0 +1,143 @@
+package bloomFilter
+
+//a key hashed once, ready to be added to or checked against any number of filters.
+//
+//checking the same key against a dozen filters would otherwise walk the whole
+//sha256 chain a dozen times. A digest keeps the leading 8 bytes of every hash in
+//the chain, which is all any DataDepth needs, so it fits every filter whose
+//HashIterations are no more than its own. The chain is the same whatever the
+//iterations, a shorter one is just a prefix of a longer one.
+//
+//the chain depends on the filter's Seed and Strategy, so a digest only fits
+//filters with the same seed and strategy as the one that made it. Digests for
+//the double hashing strategies keep each h1 + i*h2 instead, which fits any Size
+//the same way.
+type Digest struct{
+	//the leading bytes of each hash in the chain, little endian
+	values []uint64
+
+	//the seed and strategy the chain was walked with
+	seed uint64
+	strategy HashStrategy
+}
+
+//hashes the data for use with this filter and any other filter using
+//the same seed and strategy and the same or fewer HashIterations
+func (aBloomFilter *BloomFilter) Hash( data []byte ) Digest {
+	return newDigest( data, aBloomFilter.HashIterations, aBloomFilter.Seed, aBloomFilter.Strategy )
+}
+
+//walks the hash chain of the data for the given iterations
+func newDigest( data []byte, hashIterations int, seed uint64, strategy HashStrategy ) Digest {
+	aDigest:= Digest{ values: make( []uint64, hashIterations ), seed: seed, strategy: strategy }
+
+	//the iterator's index is thrown away, only the value is wanted.
+	//a single bucket keeps the murmur modulo well defined
+	iterator:= newIndexIterator( data, 0, seed )
+	iterator.strategy = strategy
+	iterator.buckets = 1
+
+	for i := range aDigest.values {
+		iterator.next()
+		aDigest.values[i] = iterator.value()
+	}
+
+	return aDigest
+}
+
+//the amount of hash iterations the digest covers
+func (aDigest Digest) HashIterations() int {
+	return len(aDigest.values)
+}
+
+//the digest's values for the given filter.
+//fails if the digest is too short for the filter or was seeded or hashed differently
+func (aDigest Digest) prefix( aBloomFilter *BloomFilter ) ([]uint64, error) {
+	if aBloomFilter.HashIterations > len(aDigest.values) ||
+		aBloomFilter.Seed != aDigest.seed || aBloomFilter.Strategy != aDigest.strategy{
+		return nil, ErrIncompatible
+	}
+
+	return aDigest.values[:aBloomFilter.HashIterations], nil
+}
+
+//truncates a digest value to the first dataDepth bytes,
+//exactly as bytesToInt truncates a hash
+func truncateIndex( value uint64, dataDepth int ) int {
+	if dataDepth >= 8{
+		return int(value)
+	}
+
+	return int( value & ( uint64(1) << (8*uint(dataDepth)) - 1 ) )
+}
+
+//the index a digest value maps to in this filter
+func (aBloomFilter *BloomFilter) digestIndex( value uint64 ) int {
+	if aBloomFilter.Strategy != SHA256Chain{
+		return int( value % uint64( aBloomFilter.Size ) )
+	}
+
+	return truncateIndex( value, aBloomFilter.DataDepth ) & ( aBloomFilter.bucketCount() - 1 )
+}
+
+//adds a digest produced by any filter with at least this filter's HashIterations.
+//the result is identical to calling Add with the original data
+func (aBloomFilter *BloomFilter) AddDigest( aDigest Digest ) error {
+	values, err:= aDigest.prefix(aBloomFilter)
+	if err!=nil{
+		return err
+	}
+
+	for _,aValue:= range values{
+		aBloomFilter.Set( aBloomFilter.digestIndex(aValue) )
+	}
+
+	return nil
+}
+
+//checks the membership of a digest produced by any filter with at least
+//this filter's HashIterations, exactly like CheckMembership on the original data
+func (aBloomFilter *BloomFilter) CheckDigest( aDigest Digest ) (bool, error) {
+	values, err:= aDigest.prefix(aBloomFilter)
+	if err!=nil{
+		return false, err
+	}
+
+	for _,aValue:= range values{
+		if !aBloomFilter.Get( aBloomFilter.digestIndex(aValue) ){
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+//adds a digest to the concurrent filter, see BloomFilter.AddDigest
+func (aFilter *ConcurrentFilter) AddDigest( aDigest Digest ) error {
+	values, err:= aDigest.prefix(aFilter.filter)
+	if err!=nil{
+		return err
+	}
+
+	for _,aValue:= range values{
+		aFilter.Set( aFilter.filter.digestIndex(aValue) )
+	}
+
+	return nil
+}
+
+//checks a digest against the concurrent filter, see BloomFilter.CheckDigest
+func (aFilter *ConcurrentFilter) CheckDigest( aDigest Digest ) (bool, error) {
+	values, err:= aDigest.prefix(aFilter.filter)
+	if err!=nil{
+		return false, err
+	}
+
+	for _,aValue:= range values{
+		if !aFilter.Get( aFilter.filter.digestIndex(aValue) ){
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
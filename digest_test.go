@@ -0,0 +1,123 @@
+package bloomFilter
+
+import (
+
+	"testing"
+
+)
+
+//a digest from one filter works on filters of any depth and
+//fewer iterations, and matches plain Add and CheckMembership
+//a digest only fits filters seeded like the one that made it
+func TestDigestSeeds(t *testing.T) {
+	seeded:= BloomFilter{HashIterations: 4, DataDepth:2, Seed: 9}
+	seeded.BuildBuckets()
+	unseeded:= BloomFilter{HashIterations: 4, DataDepth:2}
+	unseeded.BuildBuckets()
+
+	aDigest:= seeded.Hash( []byte("seeded") )
+	if err:= unseeded.AddDigest(aDigest); err != ErrIncompatible{
+		t.Error("Digest was added to a differently seeded filter", err)
+	}
+
+	err:= seeded.AddDigest(aDigest)
+	if err!=nil{
+		t.Fatal("Digest was refused by its own filter", err)
+	}
+	if !seeded.CheckMembership( []byte("seeded") ){
+		t.Error("Seeded digest set different buckets to Add")
+	}
+}
+
+func TestDigest(t *testing.T) {
+	randomKeys:= testKeys()
+	source:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	source.BuildBuckets()
+
+	shallow:= BloomFilter{HashIterations: standardHash, DataDepth:1}
+	shallow.BuildBuckets()
+	deep:= BloomFilter{HashIterations: 4, DataDepth:3}
+	deep.BuildBuckets()
+	deepConcurrent:= NewConcurrentFilter( &BloomFilter{HashIterations: 4, DataDepth:3} )
+	deepConcurrent.filter.BuildBuckets()
+
+	//the same data added the usual way, for comparison
+	reference:= BloomFilter{HashIterations: 4, DataDepth:3}
+	reference.BuildBuckets()
+
+	testBytes:= make([][]byte, 200)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		aDigest:= source.Hash(testBytes[i])
+
+		if shallow.AddDigest(aDigest) != nil || deep.AddDigest(aDigest) != nil ||
+			deepConcurrent.AddDigest(aDigest) != nil{
+			t.Fatal("Failed to add a digest to a compatible filter")
+		}
+		reference.Add(testBytes[i])
+	}
+
+	for i := range deep.IntBuckets {
+		if deep.IntBuckets[i] != reference.IntBuckets[i]{
+			t.Fatal("Adding digests differs from adding data")
+		}
+	}
+
+	for i := range testBytes {
+		aDigest:= source.Hash(testBytes[i])
+
+		for _,aFilter:= range []*BloomFilter{ &shallow, &deep } {
+			member, err:= aFilter.CheckDigest(aDigest)
+			if err!=nil || !member{
+				t.Fatal("Added digest is not a member", err)
+			}
+		}
+
+		member, err:= deepConcurrent.CheckDigest(aDigest)
+		if err!=nil || !member{
+			t.Fatal("Added digest is not a member of the concurrent filter", err)
+		}
+	}
+
+	//and absent data agrees with CheckMembership
+	for i := 0; i < 200; i++ {
+		data:= randomKeys.Key(9)
+		member, _:= shallow.CheckDigest( source.Hash(data) )
+		if member != shallow.CheckMembership(data){
+			t.Fatal("CheckDigest disagrees with CheckMembership", data)
+		}
+	}
+
+	//a digest with too few iterations can't be used
+	short:= deep.Hash( testBytes[0] )
+	if short.HashIterations() != 4{
+		t.Error("Digest has the wrong amount of iterations", short.HashIterations())
+	}
+	if source.AddDigest(short) != ErrIncompatible{
+		t.Error("Adding a short digest did not fail")
+	}
+	if _, err:= source.CheckDigest(short); err != ErrIncompatible{
+		t.Error("Checking a short digest did not fail")
+	}
+}
+
+//hashing once and checking many filters
+func BenchmarkCheckDigestStandardHash(b *testing.B) {
+	randomKeys:= testKeys()
+	filters:= make([]BloomFilter, 12)
+	for i := range filters {
+		filters[i] = BloomFilter{HashIterations: standardHash, DataDepth:2}
+		filters[i].BuildBuckets()
+	}
+
+	data:= randomKeys.Key(16)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		aDigest:= filters[0].Hash(data)
+		for j := range filters {
+			filters[j].CheckDigest(aDigest)
+		}
+	}
+}
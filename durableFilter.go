@@ -0,0 +1,237 @@
+package bloomFilter
+
+import(
+	"errors" //for checking whether a snapshot exists yet
+	"io/fs" //for the missing snapshot error
+	"os" //for syncing and renaming snapshots
+	"sync" //for serialising compactions
+	"time" //for scheduled compaction
+)
+
+//how a DurableFilter stores itself
+type DurableOptions struct{
+	//gzip snapshots, as Serialize's compress
+	Compress bool
+
+	//how often the log is compacted into a new snapshot in the background.
+	//0 leaves compaction to explicit Compact calls
+	CompactInterval time.Duration
+}
+
+//a ConcurrentFilter whose adds survive a crash without rewriting the whole
+//filter for each one.
+//
+//the filter lives in a snapshot written by Serialize plus a write ahead log next
+//to it, fileName + ".wal", recording every key added since. Add returns once its
+//key is fsynced to the log, concurrent adds share fsyncs so throughput holds up
+//under load. Opening loads the snapshot and replays the log over it.
+//
+//compacting writes a fresh snapshot and drops the log records it covers. Adding
+//is idempotent, so a crash partway through at worst replays keys the snapshot
+//already holds.
+type DurableFilter struct{
+	filter *ConcurrentFilter
+
+	fileName string
+	options DurableOptions
+	log *writeAheadLog
+
+	//held by whoever is compacting
+	compactLock sync.Mutex
+
+	//read locked by adds from logging a key until its bits are set, write
+	//locked by a compaction while it cuts the log and copies the filter
+	logLock sync.RWMutex
+
+	//stops the background compaction and reports its first error
+	stop chan struct{}
+	stopped chan error
+}
+
+//opens the filter stored at fileName, or starts one from aBloomFilter if nothing
+//is stored there yet. aBloomFilter must be built and is ignored otherwise,
+//when used it mustn't be used directly while the DurableFilter is.
+//
+//the log is replayed up to its first torn or corrupt record, see Compact for
+//when records go away. The snapshot is treated as untrusted like RetrieveFilter
+func OpenDurableFilter( fileName string, aBloomFilter *BloomFilter, options DurableOptions ) (*DurableFilter, error) {
+
+	snapshot, err:= RetrieveFilter( fileName, options.Compress )
+	if errors.Is( err, fs.ErrNotExist ){
+		snapshot = *aBloomFilter
+		err = snapshot.Validate()
+	}
+	if err!=nil{
+		return nil, err
+	}
+
+	log, err:= openWriteAheadLog( fileName + ".wal", func( data []byte ) {
+		snapshot.Add(data)
+	})
+	if err!=nil{
+		return nil, err
+	}
+
+	aFilter:= &DurableFilter{ filter: NewConcurrentFilter(&snapshot),
+		fileName: fileName, options: options, log: log }
+
+	if options.CompactInterval > 0{
+		aFilter.stop = make( chan struct{} )
+		aFilter.stopped = make( chan error, 1 )
+		go aFilter.compactEvery( options.CompactInterval )
+	}
+
+	return aFilter, nil
+}
+
+//compacts on a timer until Close, skipping ticks with nothing logged
+func (aFilter *DurableFilter) compactEvery( interval time.Duration ) {
+	ticker:= time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var firstErr error
+	for {
+		select{
+		case <-aFilter.stop:
+			aFilter.stopped <- firstErr
+			return
+		case <-ticker.C:
+			if aFilter.log.empty(){
+				continue
+			}
+
+			err:= aFilter.Compact()
+			if err!=nil && firstErr == nil{
+				firstErr = err
+			}
+		}
+	}
+}
+
+//takes an array of bytes and adds it to the filter, returning once it's durable
+func (aFilter *DurableFilter) Add( data []byte ) error {
+	//logged before its bits are set, so bits anyone can see belong to keys already
+	//in the log. logLock keeps a compaction from cutting in between
+	aFilter.logLock.RLock()
+	sequence, err:= aFilter.log.append(data)
+	if err == nil{
+		aFilter.filter.Add(data)
+	}
+	aFilter.logLock.RUnlock()
+	if err!=nil{
+		return err
+	}
+
+	return aFilter.log.wait(sequence)
+}
+
+//takes an array of bytes and checks its membership in the filter
+func (aFilter *DurableFilter) CheckMembership( data []byte ) bool {
+	return aFilter.filter.CheckMembership(data)
+}
+
+//a copy of the filter as it is now, see ConcurrentFilter.Snapshot
+func (aFilter *DurableFilter) Snapshot() BloomFilter {
+	return aFilter.filter.Snapshot()
+}
+
+//adds the data, see ConcurrentFilter.AddIfAbsent, returning once it's durable.
+//
+//data that was already present isn't logged again. Its bits may have been set by
+//an add still waiting on the disk though, so it's only reported present once
+//everything logged so far is durable, that add's record included
+func (aFilter *DurableFilter) AddIfAbsent( data []byte ) (wasPresent bool, err error) {
+	if aFilter.filter.CheckMembership(data){
+		return true, aFilter.log.wait( aFilter.log.last() )
+	}
+
+	//a racing add may still get there first, the key is logged twice then
+	aFilter.logLock.RLock()
+	sequence, err:= aFilter.log.append(data)
+	if err == nil{
+		wasPresent = aFilter.filter.AddIfAbsent(data)
+	}
+	aFilter.logLock.RUnlock()
+	if err!=nil{
+		return false, err
+	}
+
+	return wasPresent, aFilter.log.wait(sequence)
+}
+
+//writes a new snapshot holding everything added so far and drops the
+//log records it covers. Adds carry on while it runs.
+//
+//the snapshot is written beside the old one and renamed over it,
+//so a crash never leaves a half written snapshot behind
+func (aFilter *DurableFilter) Compact() error {
+	aFilter.compactLock.Lock()
+	defer aFilter.compactLock.Unlock()
+
+	//no add is between logging its key and setting its bits while logLock is
+	//held, so the snapshot holds every record before the cut
+	aFilter.logLock.Lock()
+	cut:= aFilter.log.cut()
+	snapshot:= aFilter.filter.Snapshot()
+	aFilter.logLock.Unlock()
+
+	err:= writeSnapshot( aFilter.fileName, &snapshot, aFilter.options.Compress )
+	if err!=nil{
+		return err
+	}
+
+	return aFilter.log.discardBefore(cut)
+}
+
+//serializes the filter to a temporary file, syncs it and renames it into place
+func writeSnapshot( fileName string, aBloomFilter *BloomFilter, compress bool ) error {
+	temporary:= fileName + ".tmp"
+
+	err:= aBloomFilter.Serialize( temporary, compress )
+	if err == nil{
+		err = syncFile(temporary)
+	}
+	if err == nil{
+		err = os.Rename( temporary, fileName )
+	}
+	if err!=nil{
+		os.Remove(temporary)
+		return err
+	}
+
+	return syncDirectory(fileName)
+}
+
+//fsyncs a file that's already been written and closed
+func syncFile( fileName string ) error {
+	file, err:= os.OpenFile( fileName, os.O_RDWR, 0 )
+	if err!=nil{
+		return err
+	}
+
+	err = file.Sync()
+	closeErr:= file.Close()
+	if err!=nil{
+		return err
+	}
+	return closeErr
+}
+
+//stops background compaction and closes the log once everything added is
+//durable. Returns the first error a background compaction hit, if any.
+//
+//the filter can still be checked afterwards but adding fails with ErrClosed
+func (aFilter *DurableFilter) Close() error {
+	var compactErr error
+	if aFilter.stop!=nil{
+		close(aFilter.stop)
+		compactErr = <-aFilter.stopped
+		aFilter.stop = nil
+	}
+
+	err:= aFilter.log.close()
+	if err!=nil{
+		return err
+	}
+	return compactErr
+}
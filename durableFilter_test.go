@@ -0,0 +1,191 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+)
+
+func newDurableTestFilter() *BloomFilter {
+	aBloomFilter:= &BloomFilter{ HashIterations: standardHash, DataDepth: 2 }
+	aBloomFilter.BuildBuckets()
+
+	return aBloomFilter
+}
+
+func openDurableTestFilter( t *testing.T, fileName string, options DurableOptions ) *DurableFilter {
+	aFilter, err:= OpenDurableFilter( fileName, newDurableTestFilter(), options )
+	if err!=nil{
+		t.Fatal("Failed to open a durable filter", err)
+	}
+
+	return aFilter
+}
+
+func checkAll( t *testing.T, aFilter *DurableFilter, keys [][]byte, why string ) {
+	for i := range keys {
+		if !aFilter.CheckMembership(keys[i]){
+			t.Fatal( why, "lost a key", i )
+		}
+	}
+}
+
+//adds that returned are there after a crash, with or without compactions
+func TestDurableFilterRecovery(t *testing.T) {
+	randomKeys:= testKeys()
+	fileName:= filepath.Join( t.TempDir(), "filter.json" )
+
+	keys:= make([][]byte, 300)
+	for i := range keys {
+		keys[i] = randomKeys.Key(16)
+	}
+
+	aFilter:= openDurableTestFilter( t, fileName, DurableOptions{ Compress: true } )
+	for _,aKey:= range keys[:100] {
+		if err:= aFilter.Add(aKey); err!=nil{
+			t.Fatal("Failed to add", err)
+		}
+	}
+
+	//never closed, just as a crash would leave it
+	aFilter = openDurableTestFilter( t, fileName, DurableOptions{ Compress: true } )
+	checkAll( t, aFilter, keys[:100], "Replaying the log" )
+	if _, err:= os.Stat(fileName); err == nil{
+		t.Fatal("A snapshot was written before compacting")
+	}
+
+	if err:= aFilter.Compact(); err!=nil{
+		t.Fatal("Failed to compact", err)
+	}
+	if info, _:= os.Stat( fileName + ".wal" ); info.Size() != int64( len(walMagic) ){
+		t.Error("Compacting left records in the log", info.Size())
+	}
+
+	for _,aKey:= range keys[100:200] {
+		if wasPresent, err:= aFilter.AddIfAbsent(aKey); wasPresent || err!=nil{
+			t.Fatal("Failed to add if absent", wasPresent, err)
+		}
+	}
+	logBefore, _:= os.ReadFile( fileName + ".wal" )
+	if err:= aFilter.Compact(); err!=nil{
+		t.Fatal("Failed to compact", err)
+	}
+
+	//a crash after the new snapshot but before the log was rewritten
+	//replays the old log over it, which changes nothing
+	snapshot:= aFilter.Snapshot()
+	os.WriteFile( fileName + ".wal", logBefore, 0664 )
+	aFilter = openDurableTestFilter( t, fileName, DurableOptions{ Compress: true } )
+	checkAll( t, aFilter, keys[:200], "Replaying a stale log" )
+	if replayed:= aFilter.Snapshot(); !slices.Equal( snapshot.IntBuckets, replayed.IntBuckets ){
+		t.Error("Replaying a stale log changed the filter")
+	}
+
+	for _,aKey:= range keys[200:] {
+		aFilter.Add(aKey)
+	}
+
+	aFilter = openDurableTestFilter( t, fileName, DurableOptions{ Compress: true } )
+	checkAll( t, aFilter, keys, "Reopening after compacting" )
+
+	if err:= aFilter.Close(); err!=nil{
+		t.Fatal("Failed to close", err)
+	}
+	if err:= aFilter.Add(keys[0]); err != ErrClosed{
+		t.Error("Added to a closed filter", err)
+	}
+	if err:= aFilter.Close(); err != ErrClosed{
+		t.Error("Closed twice", err)
+	}
+}
+
+//adds carry on through compactions without any going missing
+func TestDurableFilterConcurrentCompaction(t *testing.T) {
+	fileName:= filepath.Join( t.TempDir(), "filter.json" )
+	aFilter:= openDurableTestFilter( t, fileName, DurableOptions{ CompactInterval: time.Millisecond } )
+
+	const writers, perWriter = 4, 150
+
+	keys:= make([][][]byte, writers)
+	for i := range keys {
+		randomKeys:= NewKeyGenerator( uint64(i) + 1 )
+		keys[i] = make([][]byte, perWriter)
+		for j := range keys[i] {
+			keys[i][j] = randomKeys.Key(16)
+		}
+	}
+
+	var group sync.WaitGroup
+	for i := range keys {
+		group.Add(1)
+		go func( writerKeys [][]byte ) {
+			defer group.Done()
+			for j,aKey:= range writerKeys {
+				if err:= aFilter.Add(aKey); err!=nil{
+					t.Error("Failed to add", err)
+					return
+				}
+				if j % 50 == 0{
+					aFilter.Compact()
+				}
+			}
+		}( keys[i] )
+	}
+	group.Wait()
+
+	if err:= aFilter.Close(); err!=nil{
+		t.Fatal("Compaction failed", err)
+	}
+
+	aFilter = openDurableTestFilter( t, fileName, DurableOptions{} )
+	for i := range keys {
+		checkAll( t, aFilter, keys[i], "Compacting while adding" )
+	}
+	aFilter.Close()
+}
+
+//a key whose add hasn't reached the disk yet can't be reported
+//present until it has, a crash would lose it otherwise
+func TestDurableFilterPresentIsDurable(t *testing.T) {
+	aFilter:= openDurableTestFilter( t, filepath.Join( t.TempDir(), "filter.json" ), DurableOptions{} )
+	defer aFilter.Close()
+
+	//an Add that has logged and set its key but not yet waited
+	key:= []byte("pending")
+	sequence, err:= aFilter.log.append(key)
+	if err!=nil{
+		t.Fatal("Failed to log", err)
+	}
+	aFilter.filter.Add(key)
+
+	wasPresent, err:= aFilter.AddIfAbsent(key)
+	if !wasPresent || err!=nil{
+		t.Fatal("Pending key wasn't present", wasPresent, err)
+	}
+
+	aFilter.log.lock.Lock()
+	durable:= aFilter.log.durable
+	aFilter.log.lock.Unlock()
+	if durable < sequence{
+		t.Error("Key was reported present before its record was durable", durable, sequence)
+	}
+}
+
+func TestDurableFilterRejects(t *testing.T) {
+	directory:= t.TempDir()
+
+	unbuilt:= &BloomFilter{ HashIterations: standardHash, DataDepth: 2 }
+	if _, err:= OpenDurableFilter( filepath.Join( directory, "unbuilt.json" ), unbuilt, DurableOptions{} ); err != ErrCorrupt{
+		t.Error("Opened with an unbuilt filter", err)
+	}
+
+	os.WriteFile( filepath.Join( directory, "broken.json" ), []byte("{\"HashIterations\":0}"), 0664 )
+	if _, err:= OpenDurableFilter( filepath.Join( directory, "broken.json" ), newDurableTestFilter(), DurableOptions{} ); err != ErrCorrupt{
+		t.Error("Opened a corrupt snapshot", err)
+	}
+}
@@ -0,0 +1,234 @@
+package bloomFilter
+
+import(
+	"crypto/sha256" //for hashing keys into the exact layer
+	"encoding/binary" //for taking a hash from the digest
+	"maps" //for writing the map layout out sorted
+	"slices" //for the sorted layout
+)
+
+//what an ExactFilter can say about some data
+type Membership int
+
+const(
+	//the bloom bits, or a complete exact layer, rule it out
+	DefinitelyAbsent Membership = iota
+
+	//the bloom bits are set but the exact layer overflowed before it could say
+	ProbablyPresent
+
+	//the bloom bits are set and the exact layer holds the data's hash
+	DefinitelyPresent
+)
+
+//how an ExactFilter keeps the hashes of its keys
+type ExactLayout int
+
+const(
+	//a sorted slice, 8 bytes a key. Adding is a copy of the slice, checking a binary search
+	SortedHashes ExactLayout = iota
+
+	//a map, several times larger but adding and checking take constant time
+	MapHashes
+)
+
+//a BloomFilter confirming its answers against an exact layer of key hashes,
+//for callers that can't afford false positives on a small set of keys.
+//
+//every key added goes into the filter and, until the layer holds limit keys, the
+//layer too. Data the bloom bits rule out is definitely absent. Otherwise data whose
+//hash the layer holds is definitely present. While every key ever added is in the
+//layer the rest are false positives and definitely absent too, once a key has been
+//left out of the layer they're only probably present.
+//
+//hashes are the leading 8 bytes of the key's sha256, so two keys share one with a
+//chance of 2^-64. A filter wrapped with items already in it starts out incomplete
+type ExactFilter struct{
+	filter *BloomFilter
+
+	layout ExactLayout
+	limit int
+
+	//one of these, as the layout says
+	sorted []uint64
+	set map[uint64]struct{}
+
+	//whether every key added is in the layer
+	complete bool
+}
+
+//wraps a built filter with an exact layer of at most limit keys in the given layout.
+//panics for a negative limit or an unknown layout
+func NewExactFilter( aBloomFilter *BloomFilter, layout ExactLayout, limit int ) *ExactFilter {
+	if limit < 0 || ( layout != SortedHashes && layout != MapHashes ){
+		panic("an exact filter needs a known layout and a limit of at least 0")
+	}
+
+	aFilter:= &ExactFilter{ filter: aBloomFilter, layout: layout, limit: limit,
+		complete: aBloomFilter.popCount() == 0 }
+	if layout == MapHashes{
+		aFilter.set = make( map[uint64]struct{} )
+	}
+
+	return aFilter
+}
+
+//the wrapped filter
+func (aFilter *ExactFilter) BloomFilter() *BloomFilter {
+	return aFilter.filter
+}
+
+//the hash a key is kept in the layer as
+func exactHash( data []byte ) uint64 {
+	sum:= sha256.Sum256(data)
+	return binary.LittleEndian.Uint64( sum[:8] )
+}
+
+//whether the layer holds the hash
+func (aFilter *ExactFilter) holds( hash uint64 ) bool {
+	if aFilter.layout == MapHashes{
+		_, held:= aFilter.set[hash]
+		return held
+	}
+
+	_, held:= slices.BinarySearch( aFilter.sorted, hash )
+	return held
+}
+
+//puts the hash in the layer if there's room, the layer is incomplete from then on if not
+func (aFilter *ExactFilter) insert( hash uint64 ) {
+	if aFilter.holds(hash){
+		return
+	}
+	if aFilter.Exact() >= aFilter.limit{
+		aFilter.complete = false
+		return
+	}
+
+	if aFilter.layout == MapHashes{
+		aFilter.set[hash] = struct{}{}
+		return
+	}
+
+	position, _:= slices.BinarySearch( aFilter.sorted, hash )
+	aFilter.sorted = slices.Insert( aFilter.sorted, position, hash )
+}
+
+//takes an array of bytes and adds it to the filter and, if there's room, the exact layer
+func (aFilter *ExactFilter) Add( data []byte ) {
+	aFilter.filter.Add(data)
+	aFilter.insert( exactHash(data) )
+}
+
+//checks the bloom bits then confirms against the exact layer, see ExactFilter
+func (aFilter *ExactFilter) Check( data []byte ) Membership {
+	if !aFilter.filter.CheckMembership(data){
+		return DefinitelyAbsent
+	}
+
+	if aFilter.holds( exactHash(data) ){
+		return DefinitelyPresent
+	}
+	if aFilter.complete{
+		return DefinitelyAbsent
+	}
+
+	return ProbablyPresent
+}
+
+//takes an array of bytes and checks its membership in the filter, true unless
+//Check says it's definitely absent. No false positives while the layer is complete
+func (aFilter *ExactFilter) CheckMembership( data []byte ) bool {
+	return aFilter.Check(data) != DefinitelyAbsent
+}
+
+//adds the data and reports whether it was already a member, as CheckMembership
+func (aFilter *ExactFilter) AddIfAbsent( data []byte ) (wasPresent bool) {
+	wasPresent = aFilter.CheckMembership(data)
+	aFilter.Add(data)
+
+	return wasPresent
+}
+
+//how many keys the exact layer holds
+func (aFilter *ExactFilter) Exact() int {
+	if aFilter.layout == MapHashes{
+		return len(aFilter.set)
+	}
+
+	return len(aFilter.sorted)
+}
+
+//whether every key added is in the exact layer, so the filter has no false positives
+func (aFilter *ExactFilter) Complete() bool {
+	return aFilter.complete
+}
+
+//what an exact filter is serialized as, the layer's hashes always sorted
+type exactFilterFile struct{
+	Filter BloomFilter
+	Layout ExactLayout
+	Limit int
+	Complete bool
+	Hashes []uint64
+}
+
+//serializes the filter and its exact layer, see BloomFilter.Serialize
+func (aFilter *ExactFilter) Serialize( fileName string, compress bool ) error {
+	file:= exactFilterFile{ Filter: *aFilter.filter.written(), Layout: aFilter.layout, Limit: aFilter.limit,
+		Complete: aFilter.complete, Hashes: aFilter.sorted }
+
+	if aFilter.layout == MapHashes{
+		file.Hashes = slices.Sorted( maps.Keys(aFilter.set) )
+	}
+
+	return writeSerialized( fileName, file, compress )
+}
+
+//attempts to deserialize an exact filter, the counterpart to ExactFilter.Serialize.
+//like RetrieveFilter the file is treated as untrusted
+func RetrieveExactFilter( fileName string, compressed bool ) (*ExactFilter, error) {
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return nil, err
+	}
+
+	return parseExactFilter( data, compressed )
+}
+
+//the parsing half of RetrieveExactFilter. The filter has to pass Validate and the
+//hashes have to be strictly increasing and no more than the limit
+func parseExactFilter( data []byte, compressed bool ) (*ExactFilter, error) {
+	var file exactFilterFile
+
+	err:= decodeSerialized( data, compressed, &file )
+	if err!=nil{
+		return nil, err
+	}
+
+	err = file.Filter.Validate()
+	if err!=nil{
+		return nil, err
+	}
+	if ( file.Layout != SortedHashes && file.Layout != MapHashes ) || file.Limit < 0 || len(file.Hashes) > file.Limit{
+		return nil, ErrCorrupt
+	}
+	for i := 1; i < len(file.Hashes); i++ {
+		if file.Hashes[i] <= file.Hashes[i-1]{
+			return nil, ErrCorrupt
+		}
+	}
+
+	aFilter:= NewExactFilter( &file.Filter, file.Layout, file.Limit )
+	aFilter.complete = file.Complete
+	if file.Layout == SortedHashes{
+		aFilter.sorted = file.Hashes
+		return aFilter, nil
+	}
+
+	for _,aHash:= range file.Hashes {
+		aFilter.set[aHash] = struct{}{}
+	}
+
+	return aFilter, nil
+}
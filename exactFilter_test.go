@@ -0,0 +1,172 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"path/filepath"
+
+)
+
+var exactLayouts = []ExactLayout{ SortedHashes, MapHashes }
+
+//a filter of 256 buckets answers many non members wrongly, the exact layer none of them
+func TestExactFilter(t *testing.T) {
+	randomKeys:= testKeys()
+	keys:= deltaKeys( randomKeys, 40 )
+	others:= deltaKeys( randomKeys, 2000 )
+
+	for _,layout:= range exactLayouts {
+		aBloomFilter:= BloomFilter{HashIterations: 2, DataDepth: 1}
+		aBloomFilter.BuildBuckets()
+		aFilter:= NewExactFilter( &aBloomFilter, layout, 100 )
+
+		for i,aKey:= range keys {
+			if aFilter.AddIfAbsent(aKey){
+				t.Fatal("Exact filter claimed a new item was present", layout, i)
+			}
+		}
+		aFilter.Add( keys[0] )
+		if aFilter.Exact() != len(keys) || !aFilter.Complete(){
+			t.Fatal("Exact layer holds the wrong keys", layout, aFilter.Exact())
+		}
+
+		for i,aKey:= range keys {
+			if aFilter.Check(aKey) != DefinitelyPresent{
+				t.Fatal("Exact filter lost an item", layout, i)
+			}
+		}
+
+		falsePositives:= 0
+		for i,aKey:= range others {
+			if aBloomFilter.CheckMembership(aKey){
+				falsePositives++
+			}
+			if aFilter.Check(aKey) != DefinitelyAbsent || aFilter.CheckMembership(aKey){
+				t.Fatal("Exact filter let a false positive through", layout, i)
+			}
+		}
+		if falsePositives == 0{
+			t.Fatal("The filter was too large to have false positives")
+		}
+	}
+}
+
+//past the limit keys are only in the filter, and anything it can't rule out is probable
+func TestExactFilterLimit(t *testing.T) {
+	randomKeys:= testKeys()
+	keys:= deltaKeys( randomKeys, 30 )
+	others:= deltaKeys( randomKeys, 2000 )
+
+	for _,layout:= range exactLayouts {
+		aBloomFilter:= BloomFilter{HashIterations: 2, DataDepth: 1}
+		aBloomFilter.BuildBuckets()
+		aFilter:= NewExactFilter( &aBloomFilter, layout, 10 )
+
+		for _,aKey:= range keys {
+			aFilter.Add(aKey)
+		}
+		if aFilter.Exact() != 10 || aFilter.Complete(){
+			t.Fatal("Exact layer went past its limit", layout, aFilter.Exact())
+		}
+
+		for i,aKey:= range keys {
+			expected:= ProbablyPresent
+			if i < 10{
+				expected = DefinitelyPresent
+			}
+			if aFilter.Check(aKey) != expected{
+				t.Fatal("Exact filter answered wrongly past its limit", layout, i, aFilter.Check(aKey))
+			}
+		}
+		for i,aKey:= range others {
+			if aFilter.CheckMembership(aKey) != aBloomFilter.CheckMembership(aKey) || aFilter.Check(aKey) == DefinitelyPresent{
+				t.Fatal("Incomplete exact filter answered differently to its filter", layout, i)
+			}
+		}
+	}
+
+	//items added before wrapping were never in the layer
+	aBloomFilter:= BloomFilter{HashIterations: 2, DataDepth: 1}
+	aBloomFilter.BuildBuckets()
+	aBloomFilter.Add( keys[0] )
+	if aFilter:= NewExactFilter( &aBloomFilter, SortedHashes, 10 ); aFilter.Complete() || aFilter.Check( keys[0] ) != ProbablyPresent{
+		t.Error("Exact filter around a filter with items claimed to be complete")
+	}
+
+	defer func() {
+		if recover() == nil{
+			t.Error("An exact filter was made with an unknown layout")
+		}
+	}()
+	NewExactFilter( &aBloomFilter, ExactLayout(2), 10 )
+}
+
+func TestExactSerialize(t *testing.T) {
+	randomKeys:= testKeys()
+	keys:= deltaKeys( randomKeys, 50 )
+	others:= deltaKeys( randomKeys, 500 )
+
+	for _,layout:= range exactLayouts {
+		for _,limit:= range []int{ 20, 100 } {
+			aBloomFilter:= BloomFilter{HashIterations: 3, DataDepth: 1}
+			aBloomFilter.BuildBuckets()
+			aFilter:= NewExactFilter( &aBloomFilter, layout, limit )
+			for _,aKey:= range keys {
+				aFilter.Add(aKey)
+			}
+
+			fileName:= filepath.Join( t.TempDir(), "exactFilter.json" )
+			if err:= aFilter.Serialize( fileName, true ); err!=nil{
+				t.Fatal("Failed to serialize the exact filter!", err)
+			}
+
+			retrieved, err:= RetrieveExactFilter( fileName, true )
+			if err!=nil{
+				t.Fatal("Failed to deserialize the exact filter!", err)
+			}
+			if retrieved.Exact() != aFilter.Exact() || retrieved.Complete() != aFilter.Complete(){
+				t.Fatal("Retrieved exact layer differs", layout, limit, retrieved.Exact())
+			}
+			for i,aKey:= range append( keys, others... ) {
+				if retrieved.Check(aKey) != aFilter.Check(aKey){
+					t.Fatal("Retrieved exact filter answered differently", layout, limit, i)
+				}
+			}
+		}
+	}
+
+	//hashes out of order, or more than the limit, are refused
+	for _,file:= range []string{
+		`{"Filter":{"HashIterations":1,"DataDepth":1,"IntBuckets":[0,0,0,0]},"Limit":2,"Hashes":[2,1]}`,
+		`{"Filter":{"HashIterations":1,"DataDepth":1,"IntBuckets":[0,0,0,0]},"Limit":1,"Hashes":[1,2]}`,
+		`{"Filter":{"HashIterations":1,"DataDepth":1,"IntBuckets":[0,0,0,0]},"Layout":2,"Limit":2}`,
+	} {
+		if _, err:= parseExactFilter( []byte(file), false ); err != ErrCorrupt{
+			t.Error("Parsed a malformed exact filter", file, err)
+		}
+	}
+}
+
+//anything parseExactFilter accepts has to be usable without panicking
+func FuzzParseExactFilter(f *testing.F) {
+	aBloomFilter:= BloomFilter{HashIterations: 3, DataDepth: 1}
+	aBloomFilter.BuildBuckets()
+	seed:= NewExactFilter( &aBloomFilter, MapHashes, 4 )
+	seed.Add( []byte("seed") )
+	addSerializedSeeds( f, seed.Serialize )
+
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+	MaxSerializedSize = 1 << 16
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseExactFilter( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add(data)
+		if aFilter.Check(data) == DefinitelyAbsent{
+			t.Fatal("Parsed exact filter lost an item")
+		}
+	})
+}
@@ -0,0 +1,48 @@
+package bloomFilter
+
+import(
+	"errors" //for refusing to fold too far
+)
+
+//returned when a fold would leave less than a single integer of buckets
+var ErrFoldTooFar = errors.New("bloomFilter: filter can't be folded below 64 buckets")
+
+//halves the filter the given amount of times without needing the original data.
+//
+//an index is the leading DataDepth bytes of a hash, so the bucket count is always
+//a power of two. Dropping the top bit of every index maps the top half of the
+//buckets onto the bottom half, so OR'ing the top half of IntBuckets into the
+//bottom half gives exactly the filter that would have been built at half the size.
+//Every item added is still a member of the result.
+//
+//returns the new filter along with its estimated false positive rate, which
+//climbs with every fold, so the caller can decide if the memory saved is worth it.
+//the original filter is left alone. Only SHA256Chain filters can be folded,
+//others return ErrIncompatible.
+func (aBloomFilter *BloomFilter) Fold( times int ) (*BloomFilter, float64, error) {
+	//a modulo can't be halved the way a mask can
+	if aBloomFilter.Strategy != SHA256Chain{
+		return nil, 0, ErrIncompatible
+	}
+	if times < 0 || aBloomFilter.bucketCount() >> uint(times) < 64{
+		return nil, 0, ErrFoldTooFar
+	}
+
+	folded:= &BloomFilter{
+		HashIterations: aBloomFilter.HashIterations,
+		DataDepth: aBloomFilter.DataDepth,
+		Folds: aBloomFilter.Folds + times,
+		Seed: aBloomFilter.Seed,
+	}
+
+	//folding k times lands every integer on the one at its position
+	//modulo the new length
+	words:= aBloomFilter.heldWords() >> uint(times)
+	folded.IntBuckets = make( []uint64, words )
+
+	for i,anInt:= range aBloomFilter.words(){
+		folded.IntBuckets[i % words] |= anInt
+	}
+
+	return folded, folded.EstimateFalsePositiveRate(), nil
+}
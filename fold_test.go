@@ -0,0 +1,79 @@
+package bloomFilter
+
+import (
+
+	"testing"
+
+)
+
+//folding has to give exactly the filter that would have been built
+//at the smaller size to begin with
+func TestFold(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: 4, DataDepth:2}
+	workingFilter.BuildBuckets()
+
+	testBytes:= make([][]byte, 500)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		workingFilter.Add(testBytes[i])
+	}
+
+	previousRate:= workingFilter.EstimateFalsePositiveRate()
+
+	for times := 1; times <= 4; times++ {
+		folded, rate, err:= workingFilter.Fold(times)
+		if err!=nil{
+			t.Fatal("Failed to fold the filter", times, err)
+		}
+
+		direct:= BloomFilter{HashIterations: 4, DataDepth:2, Folds: times}
+		direct.BuildBuckets()
+		for i := range testBytes {
+			direct.Add(testBytes[i])
+		}
+
+		if len(folded.IntBuckets) != len(direct.IntBuckets){
+			t.Fatal("Folded filter is the wrong size", times, len(folded.IntBuckets))
+		}
+		for i := range direct.IntBuckets {
+			if folded.IntBuckets[i] != direct.IntBuckets[i]{
+				t.Fatal("Folded filter differs from a filter built at that size", times)
+			}
+		}
+
+		for i := range testBytes {
+			if !folded.CheckMembership(testBytes[i]){
+				t.Fatal("Folded filter lost an item", times)
+			}
+
+			member, err:= folded.CheckDigest( workingFilter.Hash(testBytes[i]) )
+			if err!=nil || !member{
+				t.Fatal("Folded filter lost a digest", times, err)
+			}
+		}
+
+		if rate <= previousRate{
+			t.Error("False positive rate did not climb with the fold", times, rate, previousRate)
+		}
+		previousRate = rate
+	}
+
+	//folds build on each other
+	once, _, _:= workingFilter.Fold(1)
+	twice, _, _:= once.Fold(1)
+	direct, _, _:= workingFilter.Fold(2)
+	for i := range direct.IntBuckets {
+		if twice.IntBuckets[i] != direct.IntBuckets[i]{
+			t.Fatal("Folding twice differs from folding by two")
+		}
+	}
+
+	//2^16 buckets can drop to 64 but no further
+	if _, _, err:= workingFilter.Fold(10); err!=nil{
+		t.Error("Failed to fold down to a single integer", err)
+	}
+	if _, _, err:= workingFilter.Fold(11); err != ErrFoldTooFar{
+		t.Error("Folding below a single integer did not fail")
+	}
+}
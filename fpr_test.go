@@ -0,0 +1,318 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"encoding/binary"
+	"fmt"
+	"math"
+
+)
+
+//statistical checks that each filter's observed false positive rate
+//matches the rate theory predicts for its k, m and load.
+//
+//filters are filled to a target load with one family of keys then probed
+//with a disjoint family, so every positive is a false positive. The observed
+//rate has to land inside a confidence interval around the prediction.
+//
+//runs millions of probes normally, -short cuts that down to keep it quick.
+//the stable filter's stable point is checked by its own tests
+
+//how many hash iterations the suite uses
+const fprHashIterations = 7
+
+//bits per filter, or per shard. 2^16 keeps filling cheap, the
+//probe count is what gives the statistical power
+const fprDataDepth = 2
+
+//items per bucket the filters are filled to, predicting about 0.13%, 1.9%
+//and 6.3% FPR. Even the lowest gives some 65 false positives under -short
+var fprLoads = []float64{ 0.07, 0.12, 0.16 }
+
+//the keys of one family, an 8 byte counter behind a family byte.
+//families never collide and sha256 doesn't care that they're sequential
+func fprKey( family byte, i int ) []byte {
+	key:= make( []byte, 9 )
+	key[0] = family
+	binary.LittleEndian.PutUint64( key[1:], uint64(i) )
+
+	return key
+}
+
+//families for added and probed keys
+const(
+	fprAdded = 'a'
+	fprProbe = 'p'
+)
+
+//the textbook false positive rate for k hashes, m buckets and n items
+//
+//	(1 - (1 - 1/m)^(kn))^k
+//
+//along with its variance from one fill to another. The rate is f^k for f the share
+//of buckets set, and throwing N = kn hashes into m buckets leaves E empty with
+//
+//	Var(E) = m(1 - 1/m)^N + m(m - 1)(1 - 2/m)^N - m^2(1 - 1/m)^(2N)
+//
+//so f = 1 - E/m varies by Var(E)/m^2, and f^k by about (k f^(k-1))^2 times that
+func predictedFPR( hashIterations, buckets, items float64 ) (rate, variance float64) {
+	throws:= hashIterations*items
+	unset:= math.Pow( 1 - 1/buckets, throws )
+	set:= 1 - unset
+
+	empty:= buckets*unset + buckets*(buckets - 1)*math.Pow( 1 - 2/buckets, throws ) -
+		buckets*buckets*unset*unset
+	slope:= hashIterations*math.Pow( set, hashIterations - 1 )
+
+	return math.Pow( set, hashIterations ), slope*slope*empty / (buckets*buckets)
+}
+
+//a filter variant under test
+type fprCase struct{
+	name string
+
+	//only works with SHA256Chain, folding needs a mask and sharding routes on the sha256
+	chainOnly bool
+
+	//builds an empty filter returning a way to add a batch of keys, a way to
+	//check a key and a prediction of the rate once the given items are added
+	build func( configure func( *BloomFilter ) ) ( add func( [][]byte ), check func( []byte ) bool, predict func( items int ) (rate, variance float64) )
+}
+
+//the hash strategies every variant is run with.
+//configure sets up a fresh, unbuilt, filter to use the strategy
+var fprStrategies = []struct{
+	name string
+	strategy HashStrategy
+	configure func( *BloomFilter )
+}{
+	{ "sha256-chain", SHA256Chain, func( *BloomFilter ) {} },
+	{ "sha256-chain-seeded", SHA256Chain, func( aFilter *BloomFilter ) { aFilter.Seed = 0x5eed } },
+
+	//the same amount of buckets, just sized by Size
+	{ "murmur128-mitz64", Murmur128Mitz64, func( aFilter *BloomFilter ) {
+		aFilter.Size = aFilter.bucketCount()
+		aFilter.Strategy = Murmur128Mitz64
+		aFilter.DataDepth = 0
+	}},
+	{ "redis-murmur64a", RedisMurmur64A, func( aFilter *BloomFilter ) {
+		aFilter.Size = aFilter.bucketCount()
+		aFilter.Strategy = RedisMurmur64A
+		aFilter.DataDepth = 0
+	}},
+}
+
+var fprCases = []fprCase{
+	{ "bloom", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(aFilter)
+		aFilter.BuildBuckets()
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					aFilter.Add(aKey)
+				}
+			}, aFilter.CheckMembership, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.bucketCount() ), float64(items) )
+			}
+	}},
+
+	{ "batch", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(aFilter)
+		aFilter.BuildBuckets()
+
+		return aFilter.AddBatch, func( key []byte ) bool {
+				return aFilter.CheckBatch( [][]byte{ key } )[0]
+			}, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.bucketCount() ), float64(items) )
+			}
+	}},
+
+	{ "concurrent", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(aFilter)
+		aFilter.BuildBuckets()
+		concurrent:= NewConcurrentFilter(aFilter)
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					concurrent.Add(aKey)
+				}
+			}, concurrent.CheckMembership, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.bucketCount() ), float64(items) )
+			}
+	}},
+
+	//built a byte deeper then folded 8 times, so it ends up as large as the others
+	{ "folded", true, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth + 1 }
+		configure(aFilter)
+		aFilter.BuildBuckets()
+
+		var folded *BloomFilter
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					aFilter.Add(aKey)
+				}
+				folded, _, _ = aFilter.Fold(8)
+			}, func( key []byte ) bool {
+				return folded.CheckMembership(key)
+			}, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.bucketCount() >> 8 ), float64(items) )
+			}
+	}},
+
+	//items spread over the shards, each shard holds about items / shards
+	{ "sharded", true, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter, _:= NewShardedFilter( 4, fprHashIterations, fprDataDepth )
+		for i := range aFilter.shards {
+			configure( &aFilter.shards[i].filter )
+			aFilter.shards[i].filter.BuildBuckets()
+		}
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					aFilter.Add(aKey)
+				}
+			}, aFilter.CheckMembership, func( items int ) (float64, float64) {
+				//the rate is the mean of four shards filled independently. How the items
+				//split between them moves the mean only to second order, as the split sums to items
+				buckets:= float64( aFilter.shards[0].filter.bucketCount() )
+				rate, variance:= predictedFPR( fprHashIterations, buckets, float64(items) / 4 )
+				return rate, variance / 4
+			}
+	}},
+
+	//kept sparse however full it gets, so every check goes through the page table
+	{ "sparse", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		constants:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(constants)
+		aFilter:= NewSparseFilter( constants, 0 )
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					aFilter.Add(aKey)
+				}
+			}, aFilter.CheckMembership, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.filter.bucketCount() ), float64(items) )
+			}
+	}},
+
+	//kept in containers however full it gets
+	{ "roaring", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		constants:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(constants)
+		aFilter:= NewRoaringFilter( constants, 0 )
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					aFilter.Add(aKey)
+				}
+			}, aFilter.CheckMembership, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.filter.bucketCount() ), float64(items) )
+			}
+	}},
+
+	//a plain filter on atomic words rather than IntBuckets
+	{ "atomic-store", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(aFilter)
+		aFilter.BuildOn( NewAtomicStore( aFilter.bucketCount() ) )
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					aFilter.Add(aKey)
+				}
+			}, aFilter.CheckMembership, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.bucketCount() ), float64(items) )
+			}
+	}},
+
+	//the layer holds every key, so there are no false positives at all
+	{ "exact", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(aFilter)
+		aFilter.BuildBuckets()
+		exact:= NewExactFilter( aFilter, MapHashes, 1 << 20 )
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					exact.Add(aKey)
+				}
+			}, exact.CheckMembership, func( int ) (float64, float64) {
+				return 0, 0
+			}
+	}},
+
+	//the layer overflows almost at once, leaving the bloom bits to answer
+	{ "exact-overflowed", false, func( configure func( *BloomFilter ) ) ( func( [][]byte ), func( []byte ) bool, func( int ) (float64, float64) ) {
+		aFilter:= &BloomFilter{ HashIterations: fprHashIterations, DataDepth: fprDataDepth }
+		configure(aFilter)
+		aFilter.BuildBuckets()
+		exact:= NewExactFilter( aFilter, SortedHashes, 64 )
+
+		return func( keys [][]byte ) {
+				for _,aKey:= range keys {
+					exact.Add(aKey)
+				}
+			}, exact.CheckMembership, func( items int ) (float64, float64) {
+				return predictedFPR( fprHashIterations, float64( aFilter.bucketCount() ), float64(items) )
+			}
+	}},
+}
+
+func TestEmpiricalFalsePositiveRate(t *testing.T) {
+	probes:= 2000000
+	if testing.Short(){
+		probes = 50000
+	}
+
+	for _,aStrategy:= range fprStrategies {
+		for _,aCase:= range fprCases {
+			if aCase.chainOnly && aStrategy.strategy != SHA256Chain{
+				continue
+			}
+
+			for _,aLoad:= range fprLoads {
+				name:= fmt.Sprintf( "%s/%s/load-%.2f", aStrategy.name, aCase.name, aLoad )
+
+				t.Run( name, func( t *testing.T ) {
+					add, check, predict:= aCase.build( aStrategy.configure )
+
+					items:= int( aLoad * float64( 1 << (8*fprDataDepth) ) )
+					if aCase.name == "sharded"{
+						items*= 4
+					}
+
+					keys:= make( [][]byte, items )
+					for i := range keys {
+						keys[i] = fprKey( fprAdded, i )
+					}
+					add(keys)
+
+					var positives int
+					for i := 0; i < probes; i++ {
+						if check( fprKey( fprProbe, i ) ){
+							positives++
+						}
+					}
+
+					observed:= float64(positives) / float64(probes)
+					predicted, fillVariance:= predict(items)
+
+					//four standard deviations, of the binomial draw of probes and of
+					//how many buckets the fill happened to set. The fill dominates once
+					//millions of probes are drawn
+					allowed:= 4*math.Sqrt( predicted*(1-predicted) / float64(probes) + fillVariance )
+
+					if math.Abs( observed - predicted ) > allowed{
+						t.Errorf( "observed FPR %.5f is outside %.5f ± %.5f", observed, predicted, allowed )
+					}
+				})
+			}
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package bloomFilter
+
+import(
+	"errors" //for refusing mismatched digests and patches
+	"maps" //for copying version vectors
+	"math/bits" //for merging into a store a bit at a time
+)
+
+//returned when a digest or patch was made with another region size,
+//or covers another amount of IntBuckets, than it's being used with
+var ErrRegionMismatch = errors.New("bloomFilter: digests and patches must use the same regions")
+
+//how many local adds each replica has made, by replica id.
+//
+//a filter that has merged another has every version of it at least as high.
+//Comparing two vectors says whether either filter has seen everything the
+//other has, so replicas that already agree can skip syncing.
+type VersionVector map[string]uint64
+
+//how two version vectors relate
+type Causality int
+
+const(
+	//both have seen exactly the same adds
+	VersionsEqual Causality = iota
+
+	//the other has seen everything this one has, and more
+	VersionsBefore
+
+	//this one has seen everything the other has, and more
+	VersionsAfter
+
+	//each has seen adds the other hasn't, only a merge brings them together
+	VersionsConcurrent
+)
+
+//says how this vector relates to the other, see Causality
+func (aVector VersionVector) Compare( other VersionVector ) Causality {
+	behind, ahead:= false, false
+
+	for replica,version:= range aVector {
+		if version > other[replica]{
+			ahead = true
+		}
+	}
+	for replica,version:= range other {
+		if version > aVector[replica]{
+			behind = true
+		}
+	}
+
+	switch{
+	case ahead && behind:
+		return VersionsConcurrent
+	case ahead:
+		return VersionsAfter
+	case behind:
+		return VersionsBefore
+	}
+
+	return VersionsEqual
+}
+
+//raises each version to the other's where that's higher
+func (aVector VersionVector) Merge( other VersionVector ) {
+	for replica,version:= range other {
+		if version > aVector[replica]{
+			aVector[replica] = version
+		}
+	}
+}
+
+//a grow only bloom filter for replicas that each take adds and merge later.
+//
+//buckets are only ever set, so merging is a bitwise or of IntBuckets and the
+//highest of each version. Merges are associative, commutative and idempotent:
+//replicas merging each other's state in any order, as often as they like, end
+//up with identical filters holding every item added anywhere.
+//
+//the filter's constants have to match across replicas. Like a BloomFilter a
+//GFilter isn't safe for concurrent use.
+type GFilter struct{
+	//the items added here or merged in
+	Filter BloomFilter
+
+	//this replica's id in Versions, unique across replicas
+	ReplicaID string
+
+	Versions VersionVector
+}
+
+//wraps a built filter as a replica with the given id.
+//the filter must not be used directly afterwards
+func NewGFilter( replicaID string, aBloomFilter *BloomFilter ) *GFilter {
+	return &GFilter{ Filter: *aBloomFilter, ReplicaID: replicaID, Versions: VersionVector{} }
+}
+
+//takes an array of bytes and adds it to the filter, counting the add in this replica's version
+func (aFilter *GFilter) Add( data []byte ) {
+	aFilter.Filter.Add(data)
+	aFilter.Versions[aFilter.ReplicaID]++
+}
+
+//takes an array of bytes and checks its membership in the filter
+func (aFilter *GFilter) CheckMembership( data []byte ) bool {
+	return aFilter.Filter.CheckMembership(data)
+}
+
+//merges another replica's filter into this one, leaving the other untouched.
+//returns ErrIncompatible if their constants differ
+func (aFilter *GFilter) Merge( other *GFilter ) error {
+	if !aFilter.Filter.sameConstants(&other.Filter){
+		return ErrIncompatible
+	}
+
+	for i,anInt:= range other.Filter.words() {
+		aFilter.Filter.orWord( i, anInt )
+	}
+	aFilter.Versions.Merge(other.Versions)
+
+	return nil
+}
+
+//ors the mask into one of IntBuckets, marking it changed for the next delta if it was.
+//a store is set a bit at a time, it has no word to or into
+func (aBloomFilter *BloomFilter) orWord( word int, mask uint64 ) {
+	if aBloomFilter.store!=nil{
+		for remaining:= mask; remaining != 0; remaining&= remaining - 1 {
+			anIndex:= word*64 + bits.TrailingZeros64(remaining)
+			if !aBloomFilter.store.GetBit(anIndex){
+				aBloomFilter.Set(anIndex)
+			}
+		}
+		return
+	}
+
+	merged:= aBloomFilter.IntBuckets[word] | mask
+	if merged == aBloomFilter.IntBuckets[word]{
+		return
+	}
+
+	aBloomFilter.IntBuckets[word] = merged
+	if aBloomFilter.dirty!=nil{
+		aBloomFilter.dirty[word/64]|= 1 << (uint(word)%64)
+	}
+}
+
+//a hash of each region of IntBuckets, for finding which parts of two
+//replicas differ without sending either whole filter.
+//
+//two nodes swap digests, Diff them, then send each other just the differing
+//regions with Regions and MergeRegions. A DataDepth 4 filter in regions of
+//4096 words, 32KB each, takes a 16KB digest.
+type RegionDigest struct{
+	//IntBuckets per region, the last region may be shorter
+	RegionWords int
+
+	//the amount of IntBuckets covered
+	Words int
+
+	//one per region, in order
+	Hashes []uint64
+
+	//the versions of the filter digested, so a node can tell it's behind
+	//before doing any more than compare vectors
+	Versions VersionVector
+}
+
+//digests IntBuckets in regions of the given amount of words.
+//panics if regionWords isn't positive
+func (aFilter *GFilter) Digest( regionWords int ) RegionDigest {
+	if regionWords < 1{
+		panic("a region needs at least one word")
+	}
+
+	words:= aFilter.Filter.words()
+	aDigest:= RegionDigest{ RegionWords: regionWords, Words: len(words),
+		Hashes: make( []uint64, (len(words) + regionWords - 1) / regionWords ),
+		Versions: maps.Clone(aFilter.Versions) }
+
+	for region := range aDigest.Hashes {
+		aDigest.Hashes[region] = hashRegion( words[ region*regionWords : min( (region+1)*regionWords, len(words) ) ] )
+	}
+
+	return aDigest
+}
+
+//chains every word through murmur3's finalizer, so any change to any word,
+//or swapping two of them, changes the hash
+func hashRegion( words []uint64 ) uint64 {
+	hash:= uint64( len(words) )
+	for _,aWord:= range words {
+		hash = murmurFmix64( hash ^ aWord ) + murmurC1
+	}
+
+	return hash
+}
+
+//the indices of the regions whose hashes differ, in order.
+//returns ErrRegionMismatch if the digests cover different regions
+func (aDigest RegionDigest) Diff( other RegionDigest ) ([]int, error) {
+	if aDigest.RegionWords != other.RegionWords || aDigest.Words != other.Words ||
+		len(aDigest.Hashes) != len(other.Hashes){
+		return nil, ErrRegionMismatch
+	}
+
+	var differing []int
+	for i := range aDigest.Hashes {
+		if aDigest.Hashes[i] != other.Hashes[i]{
+			differing = append( differing, i )
+		}
+	}
+
+	return differing, nil
+}
+
+//the words of some regions of a replica, for MergeRegions on another
+type RegionPatch struct{
+	RegionWords int
+	Words int
+
+	//the region indices and each region's words
+	Regions []int
+	Contents [][]uint64
+
+	//the versions of the replica the patch came from
+	Versions VersionVector
+}
+
+//the words of the given regions, usually those Diff found differing.
+//returns ErrRegionMismatch for regions outside the filter
+func (aFilter *GFilter) Regions( regionWords int, regions []int ) (RegionPatch, error) {
+	words:= aFilter.Filter.words()
+	aPatch:= RegionPatch{ RegionWords: regionWords, Words: len(words),
+		Versions: maps.Clone(aFilter.Versions) }
+
+	for _,region:= range regions {
+		if regionWords < 1 || region < 0 || region >= (len(words) + regionWords - 1) / regionWords{
+			return RegionPatch{}, ErrRegionMismatch
+		}
+
+		aPatch.Regions = append( aPatch.Regions, region )
+		aPatch.Contents = append( aPatch.Contents,
+			append( []uint64(nil), words[ region*regionWords : min( (region+1)*regionWords, len(words) ) ]... ) )
+	}
+
+	return aPatch, nil
+}
+
+//ors a patch's regions into the filter.
+//
+//the patch's versions are merged too, which is only right when the patch holds
+//every region where the sender differed, as it does when built from a Diff of
+//digests taken since either side last changed. Returns ErrRegionMismatch for a
+//patch whose regions don't fit the filter
+func (aFilter *GFilter) MergeRegions( aPatch RegionPatch ) error {
+	words:= aFilter.Filter.heldWords()
+	if aPatch.RegionWords < 1 || aPatch.Words != words || len(aPatch.Regions) != len(aPatch.Contents){
+		return ErrRegionMismatch
+	}
+
+	//checked in full first so a bad patch changes nothing
+	for i,region:= range aPatch.Regions {
+		if region < 0 || region >= (words + aPatch.RegionWords - 1) / aPatch.RegionWords ||
+			len(aPatch.Contents[i]) != min( aPatch.RegionWords, words - region*aPatch.RegionWords ){
+			return ErrRegionMismatch
+		}
+	}
+
+	for i,region:= range aPatch.Regions {
+		for j,anInt:= range aPatch.Contents[i] {
+			aFilter.Filter.orWord( region*aPatch.RegionWords + j, anInt )
+		}
+	}
+	aFilter.Versions.Merge(aPatch.Versions)
+
+	return nil
+}
+
+//serializes the replica, see BloomFilter.Serialize
+func (aFilter *GFilter) Serialize( fileName string, compress bool ) error {
+	written:= *aFilter
+	written.Filter = *aFilter.Filter.written()
+
+	return writeSerialized( fileName, &written, compress )
+}
+
+//attempts to deserialize a file into a replica, the counterpart to the above Serialize.
+//like RetrieveFilter the file is treated as untrusted
+func RetrieveGFilter( fileName string, compressed bool ) (*GFilter, error) {
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return nil, err
+	}
+
+	return parseGFilter( data, compressed )
+}
+
+//the parsing half of RetrieveGFilter
+func parseGFilter( data []byte, compressed bool ) (*GFilter, error) {
+	aFilter:= &GFilter{}
+
+	err:= decodeSerialized( data, compressed, aFilter )
+	if err!=nil{
+		return nil, err
+	}
+
+	err = aFilter.Filter.Validate()
+	if err!=nil{
+		return nil, err
+	}
+	if aFilter.Versions == nil{
+		aFilter.Versions = VersionVector{}
+	}
+
+	return aFilter, nil
+}
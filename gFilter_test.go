@@ -0,0 +1,311 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"maps"
+	"path/filepath"
+	"slices"
+
+)
+
+func newTestGFilter( replicaID string ) *GFilter {
+	aBloomFilter:= BloomFilter{HashIterations: 4, DataDepth: 2}
+	aBloomFilter.BuildBuckets()
+
+	return NewGFilter( replicaID, &aBloomFilter )
+}
+
+func cloneGFilter( aFilter *GFilter ) *GFilter {
+	return &GFilter{ Filter: *cloneFilter(&aFilter.Filter), ReplicaID: aFilter.ReplicaID,
+		Versions: maps.Clone(aFilter.Versions) }
+}
+
+func sameGFilters( first, second *GFilter ) bool {
+	return slices.Equal( first.Filter.IntBuckets, second.Filter.IntBuckets ) &&
+		first.Versions.Compare(second.Versions) == VersionsEqual
+}
+
+func TestVersionVector(t *testing.T) {
+	cases:= []struct{
+		first, second VersionVector
+		expected Causality
+	}{
+		{VersionVector{}, VersionVector{}, VersionsEqual},
+		{VersionVector{"a": 1}, VersionVector{"a": 1}, VersionsEqual},
+		{VersionVector{"a": 1}, VersionVector{"a": 2}, VersionsBefore},
+		{VersionVector{}, VersionVector{"b": 1}, VersionsBefore},
+		{VersionVector{"a": 2, "b": 1}, VersionVector{"a": 2}, VersionsAfter},
+		{VersionVector{"a": 2}, VersionVector{"b": 1}, VersionsConcurrent},
+		{VersionVector{"a": 2, "b": 1}, VersionVector{"a": 1, "b": 2}, VersionsConcurrent},
+	}
+
+	for i,aCase:= range cases {
+		if result:= aCase.first.Compare(aCase.second); result != aCase.expected{
+			t.Error("Version vectors compared wrongly", i, result, aCase.expected)
+		}
+	}
+
+	merged:= VersionVector{"a": 2, "b": 1}
+	merged.Merge( VersionVector{"a": 1, "b": 3, "c": 1} )
+	if !maps.Equal( merged, VersionVector{"a": 2, "b": 3, "c": 1} ){
+		t.Error("Version vectors merged wrongly", merged)
+	}
+}
+
+//merging in any order, any number of times, gives the same filter
+func TestGFilterMerge(t *testing.T) {
+	randomKeys:= testKeys()
+
+	replicas:= []*GFilter{ newTestGFilter("a"), newTestGFilter("b"), newTestGFilter("c") }
+	var keys [][]byte
+	for i,aReplica:= range replicas {
+		for _,aKey:= range deltaKeys( randomKeys, 200*(i + 1) ) {
+			aReplica.Add(aKey)
+			keys = append( keys, aKey )
+		}
+	}
+
+	merge:= func( into *GFilter, others ...*GFilter ) *GFilter {
+		merged:= cloneGFilter(into)
+		for _,other:= range others {
+			if err:= merged.Merge(other); err!=nil{
+				t.Fatal("Failed to merge matching replicas", err)
+			}
+		}
+		return merged
+	}
+
+	//(a+b)+c, a+(b+c) and the other orders
+	expected:= merge( merge( replicas[0], replicas[1] ), replicas[2] )
+	results:= []*GFilter{
+		merge( replicas[0], merge( replicas[1], replicas[2] ) ),
+		merge( replicas[2], replicas[1], replicas[0] ),
+		merge( replicas[1], replicas[0], replicas[2] ),
+		merge( expected, replicas[0], replicas[1], replicas[2], expected ),
+	}
+	for i,aResult:= range results {
+		if !sameGFilters( expected, aResult ){
+			t.Error("Merge order changed the result", i)
+		}
+	}
+
+	if !maps.Equal( expected.Versions, VersionVector{"a": 200, "b": 400, "c": 600} ){
+		t.Error("Merged versions are wrong", expected.Versions)
+	}
+	for i,aKey:= range keys {
+		if !expected.CheckMembership(aKey){
+			t.Fatal("Merged replica lost an item", i)
+		}
+	}
+
+	if replicas[0].Versions.Compare(expected.Versions) != VersionsBefore ||
+		replicas[0].Versions.Compare(replicas[1].Versions) != VersionsConcurrent{
+		t.Error("Replicas compare wrongly with their merge")
+	}
+
+	//the merged replica still counts its own adds separately
+	expected.Add( []byte("after") )
+	if expected.Versions["a"] != 201 || expected.Versions.Compare(results[0].Versions) != VersionsAfter{
+		t.Error("Adding after merging counted wrongly", expected.Versions)
+	}
+}
+
+//two replicas swap only the regions they differ in, then match exactly
+func TestGFilterAntiEntropy(t *testing.T) {
+	randomKeys:= testKeys()
+
+	first, second:= newTestGFilter("first"), newTestGFilter("second")
+	shared:= deltaKeys( randomKeys, 2000 )
+	for _,aKey:= range shared {
+		first.Add(aKey)
+		second.Add(aKey)
+	}
+	first.Versions, second.Versions = VersionVector{"seed": 1}, VersionVector{"seed": 1}
+
+	firstKeys, secondKeys:= deltaKeys( randomKeys, 2 ), deltaKeys( randomKeys, 3 )
+	for _,aKey:= range firstKeys {
+		first.Add(aKey)
+	}
+	for _,aKey:= range secondKeys {
+		second.Add(aKey)
+	}
+	if first.Versions.Compare(second.Versions) != VersionsConcurrent{
+		t.Fatal("Diverged replicas aren't concurrent")
+	}
+
+	const regionWords = 16
+	firstDigest, secondDigest:= first.Digest(regionWords), second.Digest(regionWords)
+	if len(firstDigest.Hashes) != 64{
+		t.Fatal("Digest has the wrong amount of regions", len(firstDigest.Hashes))
+	}
+
+	differing, err:= firstDigest.Diff(secondDigest)
+	if err!=nil{
+		t.Fatal("Failed to diff matching digests", err)
+	}
+	//each key sets at most one bucket in each of 4 words
+	if len(differing) == 0 || len(differing) > 4*( len(firstKeys) + len(secondKeys) ){
+		t.Fatal("Digests differ in the wrong amount of regions", len(differing))
+	}
+
+	toSecond, err:= first.Regions( regionWords, differing )
+	if err!=nil{
+		t.Fatal("Failed to take regions", err)
+	}
+	toFirst, err:= second.Regions( regionWords, differing )
+	if err!=nil{
+		t.Fatal("Failed to take regions", err)
+	}
+	if err:= second.MergeRegions(toSecond); err!=nil{
+		t.Fatal("Failed to merge regions", err)
+	}
+	if err:= first.MergeRegions(toFirst); err!=nil{
+		t.Fatal("Failed to merge regions", err)
+	}
+
+	if !sameGFilters( first, second ){
+		t.Fatal("Replicas differ after anti-entropy")
+	}
+	differing, _ = first.Digest(regionWords).Diff( second.Digest(regionWords) )
+	if len(differing) != 0{
+		t.Error("Digests still differ after anti-entropy", differing)
+	}
+	for _,aKey:= range slices.Concat( shared, firstKeys, secondKeys ) {
+		if !first.CheckMembership(aKey) || !second.CheckMembership(aKey){
+			t.Fatal("Replica lost an item in anti-entropy")
+		}
+	}
+
+	//a shorter last region is still covered
+	if oddDigest:= first.Digest(100); len(oddDigest.Hashes) != 11{
+		t.Error("Uneven regions were counted wrongly", len(oddDigest.Hashes))
+	}
+}
+
+func TestGFilterMismatch(t *testing.T) {
+	first:= newTestGFilter("first")
+	first.Add( []byte("item") )
+
+	other:= BloomFilter{HashIterations: 4, DataDepth: 1}
+	other.BuildBuckets()
+	if err:= first.Merge( NewGFilter( "other", &other ) ); err != ErrIncompatible{
+		t.Error("Merged replicas of different sizes", err)
+	}
+
+	if _, err:= first.Digest(16).Diff( first.Digest(32) ); err != ErrRegionMismatch{
+		t.Error("Diffed digests with different regions", err)
+	}
+	if _, err:= first.Regions( 16, []int{64} ); err != ErrRegionMismatch{
+		t.Error("Took a region past the end", err)
+	}
+
+	before:= cloneGFilter(first)
+	badPatches:= []RegionPatch{
+		{RegionWords: 16, Words: 1024, Regions: []int{0, 64}, Contents: [][]uint64{ make([]uint64, 16), make([]uint64, 16) }},
+		{RegionWords: 16, Words: 1024, Regions: []int{0}, Contents: [][]uint64{ make([]uint64, 8) }},
+		{RegionWords: 16, Words: 512, Regions: []int{0}, Contents: [][]uint64{ make([]uint64, 16) }},
+		{RegionWords: 0, Words: 1024},
+	}
+	for i,aPatch:= range badPatches {
+		aPatch.Versions = VersionVector{"bad": 1}
+		if err:= first.MergeRegions(aPatch); err != ErrRegionMismatch{
+			t.Error("Merged a patch that doesn't fit", i, err)
+		}
+	}
+	if !sameGFilters( before, first ){
+		t.Error("A refused patch changed the replica")
+	}
+}
+
+func TestGFilterSerialize(t *testing.T) {
+	randomKeys:= testKeys()
+	aFilter:= newTestGFilter("replica")
+	keys:= deltaKeys( randomKeys, 500 )
+	for _,aKey:= range keys {
+		aFilter.Add(aKey)
+	}
+	aFilter.Versions["elsewhere"] = 7
+
+	for _,compress:= range []bool{ false, true } {
+		fileName:= filepath.Join( t.TempDir(), "gFilter.json" )
+		if err:= aFilter.Serialize( fileName, compress ); err!=nil{
+			t.Fatal("Failed to serialize the replica!", err)
+		}
+
+		retrieved, err:= RetrieveGFilter( fileName, compress )
+		if err!=nil{
+			t.Fatal("Failed to deserialize the replica!", err)
+		}
+		if !sameGFilters( aFilter, retrieved ) || retrieved.ReplicaID != "replica"{
+			t.Fatal("Retrieved replica differs")
+		}
+	}
+}
+
+//a replica built on a store is written with its buckets
+func TestGFilterSerializeStore(t *testing.T) {
+	randomKeys:= testKeys()
+	aBloomFilter:= BloomFilter{HashIterations: 4, DataDepth: 2}
+	aBloomFilter.BuildOn( NewAtomicStore(1 << 16) )
+	aFilter:= NewGFilter( "replica", &aBloomFilter )
+
+	keys:= deltaKeys( randomKeys, 500 )
+	for _,aKey:= range keys {
+		aFilter.Add(aKey)
+	}
+
+	fileName:= filepath.Join( t.TempDir(), "gFilter.json" )
+	if err:= aFilter.Serialize( fileName, true ); err!=nil{
+		t.Fatal("Failed to serialize the replica!", err)
+	}
+	retrieved, err:= RetrieveGFilter( fileName, true )
+	if err!=nil{
+		t.Fatal("Failed to deserialize the replica!", err)
+	}
+	for i,aKey:= range keys {
+		if !retrieved.CheckMembership(aKey){
+			t.Fatal("Retrieved replica lost an item", i)
+		}
+	}
+	if retrieved.Filter.Stats() != aFilter.Filter.Stats() || retrieved.Versions["replica"] != 500{
+		t.Error("Retrieved replica differs")
+	}
+}
+
+//anything parseGFilter accepts has to be usable without panicking
+func FuzzParseGFilter(f *testing.F) {
+	aBloomFilter:= BloomFilter{HashIterations: 3, DataDepth: 1}
+	aBloomFilter.BuildBuckets()
+	seed:= NewGFilter( "seed", &aBloomFilter )
+	seed.Add( []byte("seed") )
+	addSerializedSeeds( f, seed.Serialize )
+
+	f.Add( []byte(`{"Filter":{"HashIterations":3,"DataDepth":1,"IntBuckets":[0,0,0,0]},"ReplicaID":"x"}`), false )
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseGFilter( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add(data)
+		if !aFilter.CheckMembership(data){
+			t.Fatal("Parsed replica lost an item")
+		}
+
+		other:= cloneGFilter(aFilter)
+		if err:= other.Merge(aFilter); err!=nil{
+			t.Fatal("Failed to merge a replica with its copy", err)
+		}
+
+		aDigest:= aFilter.Digest(3)
+		aPatch, err:= aFilter.Regions( 3, []int{ len(aDigest.Hashes) - 1 } )
+		if err!=nil{
+			t.Fatal("Failed to take the last region", err)
+		}
+		if err:= other.MergeRegions(aPatch); err!=nil{
+			t.Fatal("Failed to merge the last region", err)
+		}
+	})
+}
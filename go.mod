@@ -0,0 +1,3 @@
+module github.com/Everlag/goFilter
+
+go 1.23
@@ -0,0 +1,174 @@
+package bloomFilter
+
+import(
+	"bufio" //for writing words without building the whole file in memory
+	"encoding/binary" //for Java's big endian DataOutputStream
+	"errors" //for refusing strategies we don't implement
+	"io" //for reading and writing streams like Guava does
+	"math" //for Guava's sizing
+	"os" //for the file based convenience functions
+)
+
+//returned when a Guava filter uses a strategy other than MURMUR128_MITZ_64
+var ErrUnsupportedStrategy = errors.New("bloomFilter: only Guava's MURMUR128_MITZ_64 strategy is supported")
+
+//the ordinals Guava writes for its BloomFilterStrategies
+const(
+	guavaMitz32 = 0
+	guavaMitz64 = 1
+)
+
+//words read from a Guava stream at a time. The word count in the header
+//is only trusted as far as the data actually backs it up
+const guavaReadChunk = 8192
+
+//builds an empty filter sized exactly as Guava's
+//BloomFilter.create(funnel, expectedInsertions, fpp) would be, so the two agree
+//on every bit once given the same items.
+//
+//Guava hashes whatever its funnel writes. Adding a key's bytes here matches
+//Funnels.byteArrayFunnel() and Funnels.stringFunnel(UTF_8) on the Java side, an
+//IntegerEncoder's little endian bytes match integerFunnel() and longFunnel().
+//
+//panics if fpp isn't between 0 and 1, as Guava throws
+func NewGuavaFilter( expectedInsertions int, fpp float64 ) *BloomFilter {
+	if !(fpp > 0 && fpp < 1) || expectedInsertions < 0{
+		panic("Guava filters need an fpp between 0 and 1 and a non negative expectedInsertions")
+	}
+
+	if expectedInsertions == 0{
+		expectedInsertions = 1
+	}
+	insertions:= float64(expectedInsertions)
+
+	//BloomFilter.optimalNumOfBits and optimalNumOfHashFunctions, in the same order
+	//of operations so the doubles round identically. Java's casts truncate like Go's
+	bitCount:= int64( -insertions * math.Log(fpp) / (math.Ln2 * math.Ln2) )
+	hashIterations:= int( math.Floor( float64(bitCount) / insertions * math.Ln2 + 0.5 ) )
+	if hashIterations < 1{
+		hashIterations = 1
+	}
+
+	aBloomFilter:= &BloomFilter{ HashIterations: hashIterations, Strategy: Murmur128Mitz64, Size: int(bitCount) }
+	aBloomFilter.BuildBuckets()
+
+	return aBloomFilter
+}
+
+//writes the filter exactly as Guava's BloomFilter.writeTo does, for
+//BloomFilter.readFrom to read on the Java side:
+//
+//	strategy ordinal		1 byte, 1 for MURMUR128_MITZ_64
+//	hash functions			1 unsigned byte
+//	words				int32, big endian
+//	the words themselves		int64s, big endian
+//
+//only an unseeded Murmur128Mitz64 filter with at most 255 hash iterations can be
+//written, anything else returns ErrIncompatible
+func (aBloomFilter *BloomFilter) WriteGuava( writer io.Writer ) error {
+	if aBloomFilter.Strategy != Murmur128Mitz64 || aBloomFilter.Seed != 0 ||
+		aBloomFilter.HashIterations < 1 || aBloomFilter.HashIterations > math.MaxUint8 ||
+		aBloomFilter.heldWords() > math.MaxInt32{
+		return ErrIncompatible
+	}
+
+	buffered:= bufio.NewWriter(writer)
+
+	var header [6]byte
+	header[0] = guavaMitz64
+	header[1] = uint8( aBloomFilter.HashIterations )
+	binary.BigEndian.PutUint32( header[2:], uint32( aBloomFilter.heldWords() ) )
+	buffered.Write( header[:] )
+
+	var word [8]byte
+	for _,anInt:= range aBloomFilter.words(){
+		binary.BigEndian.PutUint64( word[:], anInt )
+		buffered.Write( word[:] )
+	}
+
+	return buffered.Flush()
+}
+
+//reads a filter written by Guava's BloomFilter.writeTo, see WriteGuava for the layout.
+//the result is a Murmur128Mitz64 filter that answers exactly as the Java one would.
+//
+//only what the header describes is read so the filter can be embedded in a
+//larger stream, just like readFrom. Malformed headers and truncated words give
+//ErrCorrupt, other strategies ErrUnsupportedStrategy and more words than
+//MaxSerializedSize allows ErrTooLarge.
+func ReadGuavaFilter( reader io.Reader ) (BloomFilter, error) {
+
+	var header [6]byte
+	_, err:= io.ReadFull( reader, header[:] )
+	if err!=nil{
+		return BloomFilter{}, ErrCorrupt
+	}
+
+	switch header[0]{
+	case guavaMitz64:
+	case guavaMitz32:
+		return BloomFilter{}, ErrUnsupportedStrategy
+	default:
+		return BloomFilter{}, ErrCorrupt
+	}
+
+	//Java's int is signed, anything at or below zero is as broken as it looks
+	hashIterations:= int( header[1] )
+	words:= int64( int32( binary.BigEndian.Uint32( header[2:] ) ) )
+	if hashIterations < 1 || words < 1{
+		return BloomFilter{}, ErrCorrupt
+	}
+	if words*8 > MaxSerializedSize{
+		return BloomFilter{}, ErrTooLarge
+	}
+
+	aBloomFilter:= BloomFilter{ HashIterations: hashIterations, Strategy: Murmur128Mitz64,
+		IntBuckets: make( []uint64, 0, min( words, guavaReadChunk ) ) }
+
+	buffer:= make( []byte, 8*min( words, guavaReadChunk ) )
+	for remaining:= words; remaining > 0; {
+		chunk:= buffer[ : 8*min( remaining, guavaReadChunk ) ]
+
+		_, err:= io.ReadFull( reader, chunk )
+		if err!=nil{
+			return BloomFilter{}, ErrCorrupt
+		}
+
+		for i := 0; i < len(chunk); i+= 8 {
+			aBloomFilter.IntBuckets = append( aBloomFilter.IntBuckets, binary.BigEndian.Uint64( chunk[i:] ) )
+		}
+
+		remaining-= int64( len(chunk) / 8 )
+	}
+
+	aBloomFilter.Size = len(aBloomFilter.IntBuckets)*64
+
+	return aBloomFilter, nil
+}
+
+//writes the filter to a file in Guava's format, see WriteGuava
+func (aBloomFilter *BloomFilter) SerializeGuava( fileName string ) error {
+	file, err:= os.Create(fileName)
+	if err!=nil{
+		return err
+	}
+
+	err = aBloomFilter.WriteGuava(file)
+	if err!=nil{
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+//reads a file written by Guava's BloomFilter.writeTo, see ReadGuavaFilter
+func RetrieveGuavaFilter( fileName string ) (BloomFilter, error) {
+	file, err:= os.Open(fileName)
+	if err!=nil{
+		return BloomFilter{}, err
+	}
+	defer file.Close()
+
+	return ReadGuavaFilter( bufio.NewReader(file) )
+}
@@ -0,0 +1,261 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+)
+
+//what writeTo should give for BloomFilter.create(Funnels.stringFunnel(UTF_8), 10, 0.03)
+//holding guavaWords.
+//
+//these are reference vectors, not output from Java. They were built by a separate
+//reimplementation of Guava's create, put and writeTo checked against Guava's own
+//murmur3 vectors, so they only guard against regressions. TestGuavaJavaFixture
+//checks the same things against a file Guava wrote, see testdata/guava
+const guavaGolden = "0105000000023109210320316110415b919581175681"
+
+var guavaWords = []string{ "alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet" }
+
+//of "probe-0" to "probe-1999", the false positives of the golden filter.
+//a Go filter has to be wrong about exactly the same keys as the Java one
+var guavaFalsePositives = []int{ 79, 102, 161, 319, 341, 389, 398, 437, 558, 677, 834, 855, 922, 956,
+	1074, 1098, 1114, 1158, 1162, 1171, 1184, 1234, 1282, 1307, 1653, 1679, 1696 }
+
+func TestGuavaGolden(t *testing.T) {
+	golden, _:= hex.DecodeString(guavaGolden)
+	checkGuavaGolden( t, golden, guavaFalsePositives )
+
+	//indices in the order Guava sets them
+	expected:= []int{ 108, 51, 122, 65, 8 }
+	for i,anIndex:= range NewGuavaFilter( 10, 0.03 ).getIndices( []byte("The quick brown fox jumps over the lazy dog") ) {
+		if anIndex != expected[i]{
+			t.Error("Guava index differs", i, anIndex, expected[i])
+		}
+	}
+}
+
+//the same checks against the file testdata/guava/WriteFixture.java has Guava write,
+//when it has been run
+func TestGuavaJavaFixture(t *testing.T) {
+	written, err:= os.ReadFile( filepath.Join( "testdata", "guava", "guava.bin" ) )
+	if os.IsNotExist(err){
+		t.Skip("No fixture written by Guava yet, see testdata/guava/README.md")
+	}
+	if err!=nil{
+		t.Fatal("Failed to read the Guava fixture", err)
+	}
+	probes, err:= os.ReadFile( filepath.Join( "testdata", "guava", "guava_probes.txt" ) )
+	if err!=nil{
+		t.Fatal("Failed to read the Guava fixture's probes", err)
+	}
+
+	var falsePositives []int
+	for _,aLine:= range strings.Split( string(probes), "\n" ) {
+		fields:= strings.Fields(aLine)
+		if len(fields) == 2 && fields[0] == "positive"{
+			aProbe, err:= strconv.Atoi( fields[1] )
+			if err!=nil{
+				t.Fatal("Guava fixture has a bad probe", aLine)
+			}
+			falsePositives = append( falsePositives, aProbe )
+		}
+	}
+
+	checkGuavaGolden( t, written, falsePositives )
+}
+
+//a file writeTo gave for the filter guavaGolden describes has to read with the right
+//shape, answer every probe as Guava did and be written back byte for byte
+func checkGuavaGolden( t *testing.T, golden []byte, falsePositives []int ) {
+	aFilter, err:= ReadGuavaFilter( bytes.NewReader(golden) )
+	if err!=nil{
+		t.Fatal("Failed to read the golden filter", err)
+	}
+	if aFilter.HashIterations != 5 || aFilter.Size != 128{
+		t.Fatal("Golden filter has the wrong shape", aFilter.HashIterations, aFilter.Size)
+	}
+
+	for _,aWord:= range guavaWords {
+		if !aFilter.CheckMembership( []byte(aWord) ){
+			t.Error("Golden filter lost", aWord)
+		}
+	}
+
+	positives:= map[int]bool{}
+	for _,aProbe:= range falsePositives {
+		positives[aProbe] = true
+	}
+	for i := 0; i < 2000; i++ {
+		if aFilter.CheckMembership( []byte( fmt.Sprintf( "probe-%d", i ) ) ) != positives[i]{
+			t.Error("Golden filter disagrees with Guava about a probe", i)
+		}
+	}
+
+	//the same filter built from scratch has to come out byte for byte the same
+	built:= NewGuavaFilter( 10, 0.03 )
+	for _,aWord:= range guavaWords {
+		built.Add( []byte(aWord) )
+	}
+
+	var written bytes.Buffer
+	err = built.WriteGuava(&written)
+	if err!=nil{
+		t.Fatal("Failed to write a Guava filter", err)
+	}
+	if !bytes.Equal( written.Bytes(), golden ){
+		t.Errorf("Built filter differs from the golden one, %x", written.Bytes())
+	}
+}
+
+//sizes from Guava's optimalNumOfBits and optimalNumOfHashFunctions
+func TestGuavaSizing(t *testing.T) {
+	sizes:= []struct{
+		insertions int
+		fpp float64
+		hashIterations, words int
+	}{
+		{ 10, 0.03, 5, 2 },
+		{ 1000, 0.01, 7, 150 },
+		{ 100000, 0.001, 10, 22465 },
+		{ 0, 0.5, 1, 1 },
+	}
+
+	for _,aSize:= range sizes {
+		aFilter:= NewGuavaFilter( aSize.insertions, aSize.fpp )
+		if aFilter.HashIterations != aSize.hashIterations || len(aFilter.IntBuckets) != aSize.words{
+			t.Error("Guava sizing differs", aSize, aFilter.HashIterations, len(aFilter.IntBuckets))
+		}
+		if aFilter.Validate() != nil{
+			t.Error("Guava filter doesn't validate", aSize)
+		}
+	}
+}
+
+//a Guava filter round trips through both formats and works with digests of any Size
+func TestGuavaRoundTrip(t *testing.T) {
+	randomKeys:= testKeys()
+
+	aFilter:= NewGuavaFilter( 1000, 0.01 )
+	other:= NewGuavaFilter( 300, 0.05 )
+	other.HashIterations = aFilter.HashIterations
+	reference:= NewGuavaFilter( 300, 0.05 )
+	reference.HashIterations = aFilter.HashIterations
+
+	testBytes:= make([][]byte, 1000)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(12)
+		aFilter.Add(testBytes[i])
+
+		err:= other.AddDigest( aFilter.Hash(testBytes[i]) )
+		if err!=nil{
+			t.Fatal("Guava digest was refused", err)
+		}
+		reference.Add(testBytes[i])
+	}
+
+	if !slices.Equal( other.IntBuckets, reference.IntBuckets ){
+		t.Error("Digest set different buckets to Add on a Guava filter")
+	}
+
+	directory:= t.TempDir()
+
+	err:= aFilter.SerializeGuava( filepath.Join( directory, "guava.bin" ) )
+	if err!=nil{
+		t.Fatal("Failed to serialize in Guava's format", err)
+	}
+	fromGuava, err:= RetrieveGuavaFilter( filepath.Join( directory, "guava.bin" ) )
+	if err!=nil{
+		t.Fatal("Failed to retrieve in Guava's format", err)
+	}
+
+	err = aFilter.Serialize( filepath.Join( directory, "guava.json" ), true )
+	if err!=nil{
+		t.Fatal("Failed to serialize a Guava filter as JSON", err)
+	}
+	fromJSON, err:= RetrieveFilter( filepath.Join( directory, "guava.json" ), true )
+	if err!=nil{
+		t.Fatal("Failed to retrieve a Guava filter from JSON", err)
+	}
+
+	for i := range testBytes {
+		if !fromGuava.CheckMembership(testBytes[i]) || !fromJSON.CheckMembership(testBytes[i]){
+			t.Fatal("Retrieved Guava filter lost an item", i)
+		}
+	}
+
+	allocations:= testing.AllocsPerRun( 100, func() {
+		aFilter.Add(testBytes[0])
+		aFilter.CheckMembership(testBytes[1])
+	})
+	if allocations != 0{
+		t.Error("Guava filter allocated", allocations)
+	}
+
+	if _, _, err:= aFilter.Fold(1); err != ErrIncompatible{
+		t.Error("A Guava filter was folded", err)
+	}
+
+	seeded:= *aFilter
+	seeded.Seed = 1
+	if err:= seeded.WriteGuava( &bytes.Buffer{} ); err != ErrIncompatible{
+		t.Error("A seeded filter was written for Guava", err)
+	}
+}
+
+func TestGuavaRejects(t *testing.T) {
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+	MaxSerializedSize = 1 << 16
+
+	golden, _:= hex.DecodeString(guavaGolden)
+
+	broken:= map[string]struct{
+		data []byte
+		err error
+	}{
+		"mitz32": { append( []byte{ 0 }, golden[1:]... ), ErrUnsupportedStrategy },
+		"unknown strategy": { append( []byte{ 7 }, golden[1:]... ), ErrCorrupt },
+		"no hashes": { append( []byte{ 1, 0 }, golden[2:]... ), ErrCorrupt },
+		"truncated": { golden[:len(golden)-1], ErrCorrupt },
+		"short header": { golden[:3], ErrCorrupt },
+		"no words": { []byte{ 1, 5, 0, 0, 0, 0 }, ErrCorrupt },
+		"negative words": { []byte{ 1, 5, 0xff, 0xff, 0xff, 0xff }, ErrCorrupt },
+		"huge": { []byte{ 1, 5, 0x7f, 0xff, 0xff, 0xff }, ErrTooLarge },
+	}
+
+	for name,aCase:= range broken {
+		if _, err:= ReadGuavaFilter( bytes.NewReader(aCase.data) ); err != aCase.err{
+			t.Error("Broken Guava filter gave the wrong error", name, err)
+		}
+	}
+}
+
+//anything ReadGuavaFilter accepts has to be usable without panicking
+func FuzzReadGuavaFilter(f *testing.F) {
+	golden, _:= hex.DecodeString(guavaGolden)
+	f.Add(golden)
+	f.Add( []byte{ 1, 5, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0 } )
+
+	f.Fuzz(func( t *testing.T, data []byte ) {
+		aFilter, err:= ReadGuavaFilter( bytes.NewReader(data) )
+		if err!=nil{
+			return
+		}
+		if aFilter.Validate() != nil{
+			t.Fatal("ReadGuavaFilter accepted an invalid filter")
+		}
+
+		aFilter.Add(data)
+		if !aFilter.CheckMembership(data){
+			t.Fatal("Read Guava filter lost an item")
+		}
+	})
+}
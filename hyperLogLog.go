@@ -0,0 +1,232 @@
+package bloomFilter
+
+import(
+	"crypto/sha256" //for hashing items added on their own
+	"encoding/binary" //for pulling a 64 bit value out of a hash
+	"math" //for the estimator
+	"math/bits" //for ranking hashes
+)
+
+//a HyperLogLog distinct count estimator.
+//
+//the fill ratio of a BloomFilter's IntBuckets says less and less about how many
+//items went in as the filter saturates, a HyperLogLog keeps a steady relative
+//error of about 1.04/sqrt(2^Precision) regardless of the count.
+//
+//small counts are kept in a sparse map of register to rank, which is smaller
+//than the full register array. The registers are only built once the map
+//outgrows an eighth of them. Until then the count is low enough that linear
+//counting is more accurate than the raw estimate, so that's what it uses. The
+//map itself is no more accurate than the registers would be at the same count.
+//
+// Always call yourHyperLogLog.BuildRegisters before doing anything else.
+type HyperLogLog struct{
+	//the bits of each hash used to pick a register.
+	//there are 2^Precision registers, between 4 and 18 is allowed
+	Precision uint8
+
+	//the dense registers, one byte each. nil while the sketch is sparse
+	Registers []uint8
+
+	//register index to rank for the sparse representation.
+	//nil once the sketch has gone dense
+	Sparse map[uint32]uint8
+}
+
+//sets up an empty, sparse, sketch.
+	//essentially a reset switch
+func (aCounter *HyperLogLog) BuildRegisters() {
+	if aCounter.Precision < 4 || aCounter.Precision > 18{
+		panic("HyperLogLog Precision has to be between 4 and 18")
+	}
+
+	aCounter.Registers = nil
+	aCounter.Sparse = make( map[uint32]uint8 )
+}
+
+//literally BuildRegisters, for convention
+func (aCounter *HyperLogLog) Reset() {
+	aCounter.BuildRegisters()
+}
+
+//how many registers the sketch has
+func (aCounter *HyperLogLog) registerCount() int {
+	return 1 << aCounter.Precision
+}
+
+//the 64 bit value a hash contributes.
+//
+//taken from bytes 8 through 16 so it is independent of the leading bytes a
+//BloomFilter truncates its first index from
+func hllValue( aHash []byte ) uint64 {
+	return binary.LittleEndian.Uint64( aHash[8:16] )
+}
+
+//takes an array of bytes and counts it
+func (aCounter *HyperLogLog) Add( data []byte ) {
+	sum:= sha256.Sum256(data)
+	aCounter.addValue( hllValue( sum[:] ) )
+}
+
+//records a single 64 bit hash value
+func (aCounter *HyperLogLog) addValue( value uint64 ) {
+	//top Precision bits choose the register, the rest give the rank
+	register:= uint32( value >> (64 - aCounter.Precision) )
+	rank:= uint8( bits.LeadingZeros64( value << aCounter.Precision ) ) + 1
+
+	//a value of all zeroes past the register bits ranks one past the end
+	maxRank:= 64 - aCounter.Precision + 1
+	if rank > maxRank{
+		rank = maxRank
+	}
+
+	if aCounter.Registers != nil{
+		if aCounter.Registers[register] < rank{
+			aCounter.Registers[register] = rank
+		}
+		return
+	}
+
+	if aCounter.Sparse[register] < rank{
+		aCounter.Sparse[register] = rank
+	}
+
+	if len(aCounter.Sparse) > aCounter.registerCount()/8{
+		aCounter.densify()
+	}
+}
+
+//moves the sparse map into the full register array
+func (aCounter *HyperLogLog) densify() {
+	aCounter.Registers = make( []uint8, aCounter.registerCount() )
+
+	for register,rank:= range aCounter.Sparse{
+		aCounter.Registers[register] = rank
+	}
+
+	aCounter.Sparse = nil
+}
+
+//returns the estimated amount of distinct items added
+func (aCounter *HyperLogLog) Count() uint64 {
+	registerCount:= float64( aCounter.registerCount() )
+
+	//while sparse every register not in the map is zero and the count is low,
+	//where linear counting beats the raw estimate
+	if aCounter.Registers == nil{
+		zeroed:= registerCount - float64( len(aCounter.Sparse) )
+		return uint64( math.Round( linearCount( registerCount, zeroed ) ) )
+	}
+
+	var sum float64
+	var zeroed float64
+	for _,rank:= range aCounter.Registers{
+		sum+= math.Ldexp( 1, -int(rank) )
+		if rank == 0{
+			zeroed++
+		}
+	}
+
+	estimate:= hllAlpha(registerCount) * registerCount * registerCount / sum
+
+	//the raw estimate is biased at the low end, fall back to linear counting there
+	if estimate <= 2.5*registerCount && zeroed > 0{
+		estimate = linearCount( registerCount, zeroed )
+	}
+
+	return uint64( math.Round(estimate) )
+}
+
+//the estimate of distinct items from the amount of empty registers
+func linearCount( registerCount, zeroed float64 ) float64 {
+	return registerCount * math.Log( registerCount / zeroed )
+}
+
+//the bias correction constant for the given amount of registers
+func hllAlpha( registerCount float64 ) float64 {
+	switch registerCount{
+	case 16:
+		return 0.673
+	case 32:
+		return 0.697
+	case 64:
+		return 0.709
+	}
+
+	return 0.7213 / ( 1 + 1.079/registerCount )
+}
+
+//folds another sketch into this one, the result counts the union of both.
+//
+//both sketches must have the same Precision
+func (aCounter *HyperLogLog) Merge( other *HyperLogLog ) error {
+	if aCounter.Precision != other.Precision{
+		return ErrIncompatible
+	}
+
+	//stay sparse for as long as possible
+	if aCounter.Registers == nil && other.Registers == nil{
+		for register,rank:= range other.Sparse{
+			if aCounter.Sparse[register] < rank{
+				aCounter.Sparse[register] = rank
+			}
+		}
+
+		if len(aCounter.Sparse) > aCounter.registerCount()/8{
+			aCounter.densify()
+		}
+
+		return nil
+	}
+
+	if aCounter.Registers == nil{
+		aCounter.densify()
+	}
+
+	if other.Registers == nil{
+		for register,rank:= range other.Sparse{
+			if aCounter.Registers[register] < rank{
+				aCounter.Registers[register] = rank
+			}
+		}
+		return nil
+	}
+
+	for register,rank:= range other.Registers{
+		if aCounter.Registers[register] < rank{
+			aCounter.Registers[register] = rank
+		}
+	}
+
+	return nil
+}
+
+//adds the data to the filter and counts it in the given HyperLogLog
+//from a single hash computation.
+//
+//the counter sees the same value HyperLogLog.Add would give it so the
+//two ways of counting can be mixed and merged freely
+func (aBloomFilter *BloomFilter) AddCounted( data []byte, counter *HyperLogLog ) {
+
+	//nothing to share with a murmur filter
+	if aBloomFilter.Strategy != SHA256Chain{
+		counter.Add(data)
+		aBloomFilter.Add(data)
+		return
+	}
+
+	//the sha256 of the data starts the chain and doubles as the counter's value.
+	//it's taken before any seed is mixed in so the counter agrees with HyperLogLog.Add
+	dataSum:= sha256.Sum256(data)
+	counter.addValue( hllValue( dataSum[:] ) )
+
+	if aBloomFilter.HashIterations < 1{
+		return
+	}
+
+	iterator:= aBloomFilter.newIterator(data)
+	aBloomFilter.Set( iterator.startFrom(dataSum) )
+	for i := 1; i < aBloomFilter.HashIterations; i++ {
+		aBloomFilter.Set( iterator.next() )
+	}
+}
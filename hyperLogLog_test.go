@@ -0,0 +1,116 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"math"
+
+)
+
+//checks the count stays within a few standard errors at a range of
+//cardinalities, covering both the sparse and the dense representation
+func TestHyperLogLogCount(t *testing.T) {
+	randomKeys:= testKeys()
+	for _,distinct:= range []int{ 10, 100, 1000, 50000 } {
+		workingCounter:= HyperLogLog{Precision: 12}
+		workingCounter.BuildRegisters()
+
+		for i := 0; i < distinct; i++ {
+			data:= randomKeys.Key(8)
+
+			//repeats must not count twice
+			workingCounter.Add(data)
+			workingCounter.Add(data)
+		}
+
+		//1.04/sqrt(m) is the standard error, allow 4 of them.
+		//tiny counts can still lose an item or two to register collisions
+		allowed:= 4 * 1.04 / math.Sqrt( float64(workingCounter.registerCount()) ) * float64(distinct)
+		absoluteError:= math.Abs( float64(workingCounter.Count()) - float64(distinct) )
+
+		if absoluteError > math.Max( allowed, 2 ){
+			t.Error("Estimate is too far off", distinct, workingCounter.Count())
+		}
+
+		if distinct <= 100 && workingCounter.Registers != nil{
+			t.Error("Small counts should still be sparse", distinct)
+		}
+		if distinct >= 50000 && workingCounter.Registers == nil{
+			t.Error("Large counts should have gone dense", distinct)
+		}
+	}
+}
+
+func TestHyperLogLogMerge(t *testing.T) {
+	randomKeys:= testKeys()
+	first:= HyperLogLog{Precision: 12}
+	first.BuildRegisters()
+	second:= HyperLogLog{Precision: 12}
+	second.BuildRegisters()
+	tiny:= HyperLogLog{Precision: 12}
+	tiny.BuildRegisters()
+
+	for i := 0; i < 20000; i++ {
+		data:= randomKeys.Key(8)
+		if i%2 == 0{
+			first.Add(data)
+		}else{
+			second.Add(data)
+		}
+		if i < 10{
+			tiny.Add(data)
+		}
+	}
+
+	err:= first.Merge(&second)
+	if err!=nil{
+		t.Fatal("Failed to merge matching counters", err)
+	}
+
+	relativeError:= math.Abs( float64(first.Count()) - 20000 ) / 20000
+	if relativeError > 0.07{
+		t.Error("Merged estimate is too far off", first.Count())
+	}
+
+	//merging a subset changes nothing
+	before:= first.Count()
+	first.Merge(&tiny)
+	if first.Count() != before{
+		t.Error("Merging a subset changed the estimate", before, first.Count())
+	}
+
+	mismatched:= HyperLogLog{Precision: 10}
+	mismatched.BuildRegisters()
+	if first.Merge(&mismatched) != ErrIncompatible{
+		t.Error("Merging counters of different precision did not fail")
+	}
+}
+
+//the combined path has to behave like separate Add calls on both structures
+func TestAddCounted(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	workingFilter.BuildBuckets()
+
+	combined:= HyperLogLog{Precision: 10}
+	combined.BuildRegisters()
+	separate:= HyperLogLog{Precision: 10}
+	separate.BuildRegisters()
+
+	testBytes:= make([][]byte, 300)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		workingFilter.AddCounted( testBytes[i], &combined )
+		separate.Add( testBytes[i] )
+	}
+
+	for i := range testBytes {
+		if !workingFilter.CheckMembership(testBytes[i]){
+			t.Fatal("Item added through AddCounted is not a member", testBytes[i])
+		}
+	}
+
+	if combined.Count() != separate.Count(){
+		t.Error("AddCounted counted differently to HyperLogLog.Add", combined.Count(), separate.Count())
+	}
+}
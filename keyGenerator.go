@@ -0,0 +1,76 @@
+package bloomFilter
+
+import(
+	"encoding/binary" //for spreading generated words over keys
+	"math" //for the exponential distribution
+)
+
+//a deterministic source of keys for tests and benchmarks.
+//
+//the same seed gives the same keys in the same order on every machine and
+//every run, so a failure can be replayed by reusing its seed. It's splitmix64
+//underneath: fast and well spread but in no way secure, don't use it for
+//anything crypto/rand would be needed for.
+//
+//a KeyGenerator isn't safe for concurrent use, give each goroutine its own.
+type KeyGenerator struct{
+	state uint64
+}
+
+//builds a generator, every generator with the same seed produces the same keys
+func NewKeyGenerator( seed uint64 ) *KeyGenerator {
+	return &KeyGenerator{ state: seed }
+}
+
+//the next pseudo random 64 bits
+func (aGenerator *KeyGenerator) Uint64() uint64 {
+	aGenerator.state+= 0x9e3779b97f4a7c15
+
+	mixed:= aGenerator.state
+	mixed = ( mixed ^ (mixed >> 30) ) * 0xbf58476d1ce4e5b9
+	mixed = ( mixed ^ (mixed >> 27) ) * 0x94d049bb133111eb
+
+	return mixed ^ (mixed >> 31)
+}
+
+//a pseudo random int in [0, n). Panics if n isn't positive
+func (aGenerator *KeyGenerator) Intn( n int ) int {
+	if n <= 0{
+		panic("KeyGenerator.Intn needs a positive n")
+	}
+
+	//the bias from the modulo is at most n / 2^63, nothing a test will notice
+	return int( (aGenerator.Uint64() >> 1) % uint64(n) )
+}
+
+//a pseudo random float in [0, 1)
+func (aGenerator *KeyGenerator) Float64() float64 {
+	return float64( aGenerator.Uint64() >> 11 ) / (1 << 53)
+}
+
+//an exponentially distributed float with a mean of 1
+func (aGenerator *KeyGenerator) ExpFloat64() float64 {
+	return -math.Log( 1 - aGenerator.Float64() )
+}
+
+//overwrites key with pseudo random bytes
+func (aGenerator *KeyGenerator) Fill( key []byte ) {
+	for len(key) >= 8 {
+		binary.LittleEndian.PutUint64( key, aGenerator.Uint64() )
+		key = key[8:]
+	}
+
+	if len(key) > 0{
+		var last [8]byte
+		binary.LittleEndian.PutUint64( last[:], aGenerator.Uint64() )
+		copy( key, last[:] )
+	}
+}
+
+//a new key of the given length
+func (aGenerator *KeyGenerator) Key( length int ) []byte {
+	key:= make( []byte, length )
+	aGenerator.Fill(key)
+
+	return key
+}
@@ -0,0 +1,46 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bytes"
+
+)
+
+//the generator is splitmix64, its outputs are fixed forever for a seed
+func TestKeyGenerator(t *testing.T) {
+	zero:= NewKeyGenerator(0)
+	if value:= zero.Uint64(); value != 0xe220a8397b1dcdaf{
+		t.Fatalf("Unexpected first value for seed 0, %x", value)
+	}
+
+	first, second:= NewKeyGenerator(3), NewKeyGenerator(3)
+	for i := 0; i < 100; i++ {
+		length:= first.Intn(40)
+		if length != second.Intn(40){
+			t.Fatal("Generators with the same seed disagree")
+		}
+		if !bytes.Equal( first.Key(length), second.Key(length) ){
+			t.Fatal("Generators with the same seed made different keys", length)
+		}
+	}
+
+	if bytes.Equal( NewKeyGenerator(3).Key(16), NewKeyGenerator(4).Key(16) ){
+		t.Error("Generators with different seeds made the same key")
+	}
+
+	//a short fill is the start of a longer one
+	if !bytes.Equal( NewKeyGenerator(5).Key(5), NewKeyGenerator(5).Key(8)[:5] ){
+		t.Error("A partial word wasn't filled from the next value")
+	}
+
+	aGenerator:= NewKeyGenerator(6)
+	for i := 0; i < 1000; i++ {
+		if value:= aGenerator.Intn(7); value < 0 || value >= 7{
+			t.Fatal("Intn went out of range", value)
+		}
+		if value:= aGenerator.Float64(); value < 0 || value >= 1{
+			t.Fatal("Float64 went out of range", value)
+		}
+	}
+}
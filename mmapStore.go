@@ -0,0 +1,42 @@
+package bloomFilter
+
+import(
+	"iter" //for walking the store's words
+	"os" //for the file behind the mapping
+)
+
+//a BitStore whose words are a file mapped into memory, so a filter built on one
+//persists as it's added to and reopens with everything it held. Pages are only
+//read in as they're touched, a filter far larger than memory still opens instantly.
+//
+//the words are in the machine's byte order, files only move between machines that
+//share it. Writes reach the file whenever the OS gets to them, Sync forces them
+//there. Not safe for concurrent use. Only available on linux and darwin, elsewhere
+//OpenMmapStore returns errors.ErrUnsupported
+type MmapStore struct{
+	file *os.File
+
+	//the mapping, and the same memory as words
+	data []byte
+	words []uint64
+}
+
+func (aStore *MmapStore) SetBit( index int ) {
+	aStore.words[index/64]|= 1 << (uint(index)%64)
+}
+
+func (aStore *MmapStore) GetBit( index int ) bool {
+	return aStore.words[index/64] & ( 1 << (uint(index)%64) ) != 0
+}
+
+func (aStore *MmapStore) Len() int {
+	return 64*len(aStore.words)
+}
+
+func (aStore *MmapStore) Words() iter.Seq2[int, uint64] {
+	return sliceWords(aStore.words)
+}
+
+func (aStore *MmapStore) Clear() {
+	clear(aStore.words)
+}
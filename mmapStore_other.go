@@ -0,0 +1,22 @@
+//go:build !(linux || darwin)
+
+package bloomFilter
+
+import(
+	"errors" //for reporting there's no mapping here
+)
+
+//maps files only on linux and darwin, returns errors.ErrUnsupported here
+func OpenMmapStore( fileName string, length int ) (*MmapStore, error) {
+	return nil, errors.ErrUnsupported
+}
+
+//never reached, there's no store to sync
+func (aStore *MmapStore) Sync() error {
+	return errors.ErrUnsupported
+}
+
+//never reached, there's no store to close
+func (aStore *MmapStore) Close() error {
+	return errors.ErrUnsupported
+}
@@ -0,0 +1,58 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"errors"
+	"path/filepath"
+
+)
+
+//a filter on a mapped file reopens with everything it held
+func TestMmapStorePersists(t *testing.T) {
+	randomKeys:= testKeys()
+	keys:= deltaKeys( randomKeys, 1000 )
+	fileName:= filepath.Join( t.TempDir(), "filter.bits" )
+
+	aStore, err:= OpenMmapStore( fileName, 1 << 16 )
+	if errors.Is( err, errors.ErrUnsupported ){
+		t.Skip("No mmap here")
+	}
+	if err!=nil{
+		t.Fatal("Failed to open a mapped store", err)
+	}
+
+	aFilter:= BloomFilter{HashIterations: 4, DataDepth: 2}
+	aFilter.BuildOn(aStore)
+	for _,aKey:= range keys {
+		aFilter.Add(aKey)
+	}
+	stats:= aFilter.Stats()
+	if err:= aStore.Sync(); err!=nil{
+		t.Fatal("Failed to sync a mapped store", err)
+	}
+	if err:= aStore.Close(); err!=nil{
+		t.Fatal("Failed to close a mapped store", err)
+	}
+
+	if _, err:= OpenMmapStore( fileName, 1 << 17 ); err != ErrIncompatible{
+		t.Error("Opened a mapped store at the wrong size", err)
+	}
+
+	reopened, err:= OpenMmapStore( fileName, 1 << 16 )
+	if err!=nil{
+		t.Fatal("Failed to reopen a mapped store", err)
+	}
+	defer reopened.Close()
+
+	aFilter = BloomFilter{HashIterations: 4, DataDepth: 2}
+	aFilter.BuildOn(reopened)
+	if aFilter.Stats() != stats{
+		t.Fatal("Reopened store differs", aFilter.Stats(), stats)
+	}
+	for i,aKey:= range keys {
+		if !aFilter.CheckMembership(aKey){
+			t.Fatal("Reopened store lost an item", i)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+//go:build linux || darwin
+
+package bloomFilter
+
+import(
+	"os" //for the file behind the mapping
+	"syscall" //for mapping it
+	"unsafe" //for viewing the mapping as words
+)
+
+//opens the named file as a store of at least the given amount of bits, rounded up
+//to whole words, creating it zeroed if it doesn't exist. Returns ErrIncompatible
+//for an existing file of another size.
+//
+//Close the store once done with it, after which the filter on it can't be used
+func OpenMmapStore( fileName string, length int ) (*MmapStore, error) {
+	words:= (length + 63) / 64
+
+	file, err:= os.OpenFile( fileName, os.O_RDWR|os.O_CREATE, 0664 )
+	if err!=nil{
+		return nil, err
+	}
+
+	info, err:= file.Stat()
+	if err == nil && info.Size() == 0{
+		err = file.Truncate( int64(words)*8 )
+	}else if err == nil && info.Size() != int64(words)*8{
+		err = ErrIncompatible
+	}
+	if err!=nil{
+		file.Close()
+		return nil, err
+	}
+
+	data, err:= syscall.Mmap( int( file.Fd() ), 0, words*8, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED )
+	if err!=nil{
+		file.Close()
+		return nil, err
+	}
+
+	//mappings start on a page, which is aligned for any word
+	return &MmapStore{ file: file, data: data,
+		words: unsafe.Slice( (*uint64)( unsafe.Pointer( &data[0] ) ), words ) }, nil
+}
+
+//writes every changed page out to the file, returning once they're there
+func (aStore *MmapStore) Sync() error {
+	_, _, errno:= syscall.Syscall( syscall.SYS_MSYNC, uintptr( unsafe.Pointer( &aStore.data[0] ) ),
+		uintptr( len(aStore.data) ), syscall.MS_SYNC )
+	if errno != 0{
+		return errno
+	}
+
+	return nil
+}
+
+//unmaps the store and closes its file. Changes still reach the file without a
+//Sync, but only once the OS writes them
+func (aStore *MmapStore) Close() error {
+	err:= syscall.Munmap(aStore.data)
+	aStore.data, aStore.words = nil, nil
+
+	closeErr:= aStore.file.Close()
+	if err!=nil{
+		return err
+	}
+
+	return closeErr
+}
@@ -0,0 +1,45 @@
+package bloomFilter
+
+import(
+	"encoding/binary" //for reading blocks of the data
+)
+
+//MurmurHash64A multiplier, RedisBloom also uses it as its first seed
+const murmur64AM = 0xc6a4a7935bd1e995
+
+//MurmurHash64A from MurmurHash2, the 64 bit hash RedisBloom's filters use.
+//
+//the reference reads its 8 byte blocks as native integers, which for every
+//platform Redis runs on means little endian.
+//works on the data in place so it doesn't allocate
+func murmurHash64A( data []byte, seed uint64 ) uint64 {
+	const r = 47
+
+	h:= seed ^ ( uint64( len(data) ) * murmur64AM )
+
+	for len(data) >= 8 {
+		k:= binary.LittleEndian.Uint64(data)
+		data = data[8:]
+
+		k*= murmur64AM
+		k^= k >> r
+		k*= murmur64AM
+
+		h^= k
+		h*= murmur64AM
+	}
+
+	//the tail, up to 7 bytes
+	if len(data) > 0{
+		for i := len(data) - 1; i >= 0; i-- {
+			h^= uint64( data[i] ) << (8*uint(i))
+		}
+		h*= murmur64AM
+	}
+
+	h^= h >> r
+	h*= murmur64AM
+	h^= h >> r
+
+	return h
+}
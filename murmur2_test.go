@@ -0,0 +1,38 @@
+package bloomFilter
+
+import (
+
+	"testing"
+
+)
+
+//MurmurHash64A of each input with RedisBloom's seed and with 0.
+//with 0 "a" gives 0x071717d2d36b6b11, as in published MurmurHash2 tables
+func TestMurmurHash64A(t *testing.T) {
+	vectors:= []struct{
+		input string
+		seeded, unseeded uint64
+	}{
+		{ "", 0x1ab11ea5a7b2c56e, 0 },
+		{ "a", 0x4292cee227b9150a, 0x071717d2d36b6b11 },
+		{ "hello", 0x5ba5b8a59803e699, 0x1e68d17c457bf117 },
+		{ "The quick brown fox jumps over the lazy dog", 0xc7a616a28f4a74d6, 0x5589ca33042a861b },
+	}
+
+	for _,aVector:= range vectors {
+		if seeded:= murmurHash64A( []byte(aVector.input), redisHashSeed ); seeded != aVector.seeded{
+			t.Errorf("MurmurHash64A of %q with RedisBloom's seed gave %x", aVector.input, seeded)
+		}
+		if unseeded:= murmurHash64A( []byte(aVector.input), 0 ); unseeded != aVector.unseeded{
+			t.Errorf("MurmurHash64A of %q gave %x", aVector.input, unseeded)
+		}
+	}
+
+	data:= []byte("The quick brown fox jumps over the lazy dog")
+	allocations:= testing.AllocsPerRun( 100, func() {
+		murmurHash64A( data, redisHashSeed )
+	})
+	if allocations != 0{
+		t.Error("MurmurHash64A allocated", allocations)
+	}
+}
@@ -0,0 +1,89 @@
+package bloomFilter
+
+import(
+	"encoding/binary" //for reading blocks of the data
+	"math/bits" //for the rotations
+)
+
+//murmur3 x64 128 constants
+const(
+	murmurC1 = 0x87c37b91114253d5
+	murmurC2 = 0x4cf5ad432745937f
+)
+
+//MurmurHash3_x64_128 of the data, returning both halves.
+//
+//this is the variant Guava's Hashing.murmur3_128 implements, its
+//HashCode's bytes are h1 then h2, each little endian.
+//works on the data in place so it doesn't allocate
+func murmur3Sum128( data []byte, seed uint32 ) (h1, h2 uint64) {
+	h1, h2 = uint64(seed), uint64(seed)
+	length:= len(data)
+
+	for len(data) >= 16 {
+		k1:= binary.LittleEndian.Uint64( data[0:8] )
+		k2:= binary.LittleEndian.Uint64( data[8:16] )
+		data = data[16:]
+
+		h1^= murmurMixK1(k1)
+		h1 = bits.RotateLeft64( h1, 27 ) + h2
+		h1 = h1*5 + 0x52dce729
+
+		h2^= murmurMixK2(k2)
+		h2 = bits.RotateLeft64( h2, 31 ) + h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	//the tail, up to 15 bytes, zero padded into the two halves of a block
+	var k1, k2 uint64
+	for i := len(data) - 1; i >= 0; i-- {
+		if i >= 8{
+			k2^= uint64( data[i] ) << (8*uint(i-8))
+		}else{
+			k1^= uint64( data[i] ) << (8*uint(i))
+		}
+	}
+	if len(data) > 8{
+		h2^= murmurMixK2(k2)
+	}
+	if len(data) > 0{
+		h1^= murmurMixK1(k1)
+	}
+
+	h1^= uint64(length)
+	h2^= uint64(length)
+
+	h1+= h2
+	h2+= h1
+
+	h1 = murmurFmix64(h1)
+	h2 = murmurFmix64(h2)
+
+	h1+= h2
+	h2+= h1
+
+	return h1, h2
+}
+
+func murmurMixK1( k1 uint64 ) uint64 {
+	k1*= murmurC1
+	k1 = bits.RotateLeft64( k1, 31 )
+	return k1 * murmurC2
+}
+
+func murmurMixK2( k2 uint64 ) uint64 {
+	k2*= murmurC2
+	k2 = bits.RotateLeft64( k2, 33 )
+	return k2 * murmurC1
+}
+
+//the finalizer, forces every bit of the input to affect every bit of the output
+func murmurFmix64( k uint64 ) uint64 {
+	k^= k >> 33
+	k*= 0xff51afd7ed558ccd
+	k^= k >> 33
+	k*= 0xc4ceb9fe1a85ec53
+	k^= k >> 33
+
+	return k
+}
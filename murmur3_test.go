@@ -0,0 +1,41 @@
+package bloomFilter
+
+import (
+
+	"testing"
+
+)
+
+//the vectors from Guava's Murmur3Hash128Test, h1 and h2 of murmur3_128(seed).hashBytes
+func TestMurmur3(t *testing.T) {
+	vectors:= []struct{
+		seed uint32
+		h1, h2 uint64
+		input string
+	}{
+		{ 0, 0x629942693e10f867, 0x92db0b82baeb5347, "hell" },
+		{ 1, 0xa78ddff5adae8d10, 0x128900ef20900135, "hello" },
+		{ 2, 0x8a486b23f422e826, 0xf962a2c58947765f, "hello " },
+		{ 3, 0x2ea59f466f6bed8c, 0xc610990acc428a17, "hello w" },
+		{ 4, 0x79f6305a386c572c, 0x46305aed3483b94e, "hello wo" },
+		{ 5, 0xc2219d213ec1f1b5, 0xa1d8e2e0a52785bd, "hello wor" },
+		{ 0, 0xe34bbc7bbc071b6c, 0x7a433ca9c49a9347, "The quick brown fox jumps over the lazy dog" },
+		{ 0, 0x658ca970ff85269a, 0x43fee3eaa68e5c3e, "The quick brown fox jumps over the lazy cog" },
+		{ 0, 0, 0, "" },
+	}
+
+	for _,aVector:= range vectors {
+		h1, h2:= murmur3Sum128( []byte(aVector.input), aVector.seed )
+		if h1 != aVector.h1 || h2 != aVector.h2{
+			t.Errorf("murmur3 of %q with seed %d gave %x %x", aVector.input, aVector.seed, h1, h2)
+		}
+	}
+
+	data:= []byte("The quick brown fox jumps over the lazy dog")
+	allocations:= testing.AllocsPerRun( 100, func() {
+		murmur3Sum128( data, 0 )
+	})
+	if allocations != 0{
+		t.Error("murmur3 allocated", allocations)
+	}
+}
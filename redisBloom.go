@@ -0,0 +1,438 @@
+package bloomFilter
+
+import(
+	"encoding/binary" //for RedisBloom's packed little endian header
+	"errors" //for refusing adds to a full non scaling filter
+	"math" //for RedisBloom's layer sizing
+)
+
+//returned when an item is added to a full ScalableFilter that isn't allowed to scale,
+//RedisBloom answers 'non scaling filter is full' in the same place
+var ErrFull = errors.New("bloomFilter: non scaling filter is full")
+
+//the option bits RedisBloom keeps in a scalable filter's header
+const(
+	//layers are exactly capacity * bits per entry bits rather than
+	//rounded up to a power of two. BF.RESERVE always sets it
+	RedisOptionNoRound uint32 = 1
+
+	//capacity was given as log2 of the bits wanted
+	RedisOptionEntriesAreBits uint32 = 2
+
+	//layers hash with 64 bit MurmurHash64A, the only hashing supported here.
+	//BF.RESERVE always sets it
+	RedisOptionForce64 uint32 = 4
+
+	//Add fails with ErrFull instead of adding a layer, BF.RESERVE ... NONSCALING
+	RedisOptionNoScaling uint32 = 8
+)
+
+//each new layer allows half the false positive rate of the one before,
+//RedisBloom's ERROR_TIGHTENING_RATIO
+const redisErrorTightening = 0.5
+
+//the rounded ln(2) squared and ln(2) RedisBloom sizes layers with.
+//using them rather than math.Ln2 keeps BitsPerEntry the same bits as RedisBloom's,
+//short of math.Log and libm's log rounding differently
+const(
+	redisLn2Squared = 0.480453013918201
+	redisLn2 = 0.693147180559945
+)
+
+//the most bytes ScanDump returns at once.
+//a var so tests can split small layers into several chunks
+var redisChunkSize = 16 << 20
+
+//sizes of RedisBloom's packed dumpedChainHeader and dumpedChainLink
+const(
+	redisHeaderSize = 8 + 4 + 4 + 4
+	redisLinkSize = 8 + 8 + 8 + 8 + 8 + 4 + 8 + 1
+)
+
+//one layer of a ScalableFilter along with what RedisBloom records about it
+type ScalableLayer struct{
+	//the layer's buckets, always using RedisMurmur64A
+	Filter BloomFilter
+
+	//items the layer was sized for, RedisBloom's entries
+	Capacity uint64
+
+	//the false positive rate the layer was sized for and
+	//the bits per entry that took
+	ErrorRate float64
+	BitsPerEntry float64
+
+	//items added to this layer
+	Count uint64
+
+	//log2 of the buckets when the layer was rounded up to
+	//a power of two, 0 when it wasn't. Indices are taken modulo
+	//2^N2 then, rather than every bit the layer's words hold
+	N2 uint8
+}
+
+//a scalable bloom filter as RedisBloom keeps it, compatible with its
+//BF.SCANDUMP and BF.LOADCHUNK chunks so filters can move between a Redis
+//instance and this package without re-adding every key.
+//
+//items go into the newest layer. Once it holds its Capacity another layer is
+//added with Growth times the capacity and half the error rate, so the combined
+//false positive rate stays bounded however many items arrive. A lookup checks
+//every layer.
+//
+//only filters using RedisOptionForce64, which every filter BF.RESERVE or BF.ADD
+//creates has, can be loaded.
+type ScalableFilter struct{
+	//the layers, oldest first
+	Layers []ScalableLayer
+
+	//items added across all layers
+	Count uint64
+
+	//RedisOption bits
+	Options uint32
+
+	//how many times the capacity of the last layer the next one gets, BF.RESERVE's EXPANSION
+	Growth uint32
+}
+
+//builds a filter as BF.RESERVE key errorRate capacity EXPANSION growth [NONSCALING] would.
+//
+//panics if errorRate isn't between 0 and 1, capacity or growth are 0
+//or the first layer would be larger than MaxSerializedSize
+func NewScalableFilter( capacity uint64, errorRate float64, growth uint32, scaling bool ) *ScalableFilter {
+	if !(errorRate > 0 && errorRate < 1) || capacity == 0 || growth == 0{
+		panic("a scalable filter needs an error rate between 0 and 1 and a nonzero capacity and growth")
+	}
+
+	aFilter:= &ScalableFilter{ Options: RedisOptionNoRound | RedisOptionForce64, Growth: growth }
+	if !scaling{
+		aFilter.Options|= RedisOptionNoScaling
+	}
+
+	err:= aFilter.addLayer( capacity, errorRate )
+	if err!=nil{
+		panic("a scalable filter's first layer can't be larger than MaxSerializedSize")
+	}
+
+	return aFilter
+}
+
+//adds a new, empty, layer sized as RedisBloom's bloom_init would size it.
+//
+//bloom_init takes n2 as logb of the bits wanted plus one, so an exact power of
+//two is doubled just as any other amount is rounded up. It then rounds the bytes
+//up to whole words and sets bits to all of them, which is what indices are taken
+//modulo of unless n2 is set.
+//
+//returns ErrTooLarge rather than make a layer of more than MaxSerializedSize bytes
+func (aFilter *ScalableFilter) addLayer( capacity uint64, errorRate float64 ) error {
+	layer:= ScalableLayer{ Capacity: capacity, ErrorRate: errorRate }
+	layer.BitsPerEntry = -( math.Log(errorRate) / redisLn2Squared )
+
+	wanted:= float64(capacity) * layer.BitsPerEntry
+	if !( wanted < float64(MaxSerializedSize) * 8 ){
+		return ErrTooLarge
+	}
+
+	bits:= max( uint64(wanted), 1 )
+	if aFilter.Options & RedisOptionNoRound == 0{
+		layer.N2 = uint8( max( math.Logb(wanted), 0 ) ) + 1
+		bits = 1 << layer.N2
+	}else{
+		bits = (bits + 63) / 64 * 64
+	}
+
+	layer.Filter = BloomFilter{ HashIterations: int( math.Ceil( redisLn2 * layer.BitsPerEntry ) ),
+		Strategy: RedisMurmur64A, Size: int(bits) }
+	layer.Filter.BuildBuckets()
+
+	aFilter.Layers = append( aFilter.Layers, layer )
+
+	return nil
+}
+
+//hashes the data once for every layer
+func (aFilter *ScalableFilter) hash( data []byte ) Digest {
+	hashIterations:= 0
+	for i := range aFilter.Layers {
+		hashIterations = max( hashIterations, aFilter.Layers[i].Filter.HashIterations )
+	}
+
+	return newDigest( data, hashIterations, 0, RedisMurmur64A )
+}
+
+//checks the digest against every layer, newest first as they're the fullest
+func (aFilter *ScalableFilter) checkDigest( aDigest Digest ) bool {
+	for i := len(aFilter.Layers) - 1; i >= 0; i-- {
+		if found, _:= aFilter.Layers[i].Filter.CheckDigest(aDigest); found{
+			return true
+		}
+	}
+
+	return false
+}
+
+//takes an array of bytes and checks its membership in any layer
+func (aFilter *ScalableFilter) CheckMembership( data []byte ) bool {
+	return aFilter.checkDigest( aFilter.hash(data) )
+}
+
+//adds the data and reports whether it was already a member, exactly as BF.ADD.
+//items already in any layer aren't added again so they don't count towards
+//a layer's capacity. Returns ErrFull if a new layer is needed but not allowed
+//and ErrTooLarge if it would be larger than MaxSerializedSize
+func (aFilter *ScalableFilter) AddIfAbsent( data []byte ) (wasPresent bool, err error) {
+	aDigest:= aFilter.hash(data)
+	if aFilter.checkDigest(aDigest){
+		return true, nil
+	}
+
+	last:= &aFilter.Layers[ len(aFilter.Layers) - 1 ]
+	if last.Count >= last.Capacity{
+		if aFilter.Options & RedisOptionNoScaling != 0{
+			return false, ErrFull
+		}
+
+		capacity:= last.Capacity * uint64(aFilter.Growth)
+		if capacity / uint64(aFilter.Growth) != last.Capacity{
+			return false, ErrTooLarge
+		}
+
+		err:= aFilter.addLayer( capacity, last.ErrorRate * redisErrorTightening )
+		if err!=nil{
+			return false, err
+		}
+		last = &aFilter.Layers[ len(aFilter.Layers) - 1 ]
+
+		//the new layer may hash more times than the digest covers
+		aDigest = aFilter.hash(data)
+	}
+
+	last.Filter.AddDigest(aDigest)
+	last.Count++
+	aFilter.Count++
+
+	return false, nil
+}
+
+//takes an array of bytes and adds it to the newest layer, see AddIfAbsent
+func (aFilter *ScalableFilter) Add( data []byte ) error {
+	_, err:= aFilter.AddIfAbsent(data)
+	return err
+}
+
+//checks the layers are ones RedisBloom could have made and this package can use:
+//at least one layer, each a valid RedisMurmur64A filter whose buckets are a power
+//of two when N2 says so, sensible error rates and RedisOptionForce64 set.
+//
+//returns ErrCorrupt or, without RedisOptionForce64, ErrUnsupportedStrategy
+func (aFilter *ScalableFilter) Validate() error {
+	if aFilter.Options & RedisOptionForce64 == 0{
+		return ErrUnsupportedStrategy
+	}
+	if len(aFilter.Layers) == 0 || len(aFilter.Layers) > math.MaxUint32{
+		return ErrCorrupt
+	}
+	if aFilter.Growth == 0 && aFilter.Options & RedisOptionNoScaling == 0{
+		return ErrCorrupt
+	}
+
+	for i := range aFilter.Layers {
+		layer:= &aFilter.Layers[i]
+
+		if layer.Filter.Strategy != RedisMurmur64A || layer.Filter.Validate() != nil{
+			return ErrCorrupt
+		}
+		if !(layer.ErrorRate > 0 && layer.ErrorRate < 1){
+			return ErrCorrupt
+		}
+		if layer.N2 > 62 || ( layer.N2 > 0 && layer.Filter.Size != 1 << layer.N2 ){
+			return ErrCorrupt
+		}
+	}
+
+	return nil
+}
+
+//the bytes of every layer in order, the offsets chunks are addressed by
+func (aFilter *ScalableFilter) layerBytes( anIndex int ) int {
+	return len( aFilter.Layers[anIndex].Filter.IntBuckets ) * 8
+}
+
+//finds the layer holding the byte at position across all layers
+//and the offset into it, -1 if it's past the last layer
+func (aFilter *ScalableFilter) locate( position int64 ) (int, int) {
+	var seek int64
+	for i := range aFilter.Layers {
+		length:= int64( aFilter.layerBytes(i) )
+		if position < seek + length{
+			return i, int( position - seek )
+		}
+		seek+= length
+	}
+
+	return -1, 0
+}
+
+//one step of BF.SCANDUMP. Call with 0 first then with whatever iterator the
+//previous call returned until it returns 0. The first call returns the header
+//and every later one a chunk of a layer's buckets.
+//
+//BF.LOADCHUNK on Redis, or LoadChunk here, takes each returned iterator
+//and chunk as they are
+func (aFilter *ScalableFilter) ScanDump( iterator int64 ) (int64, []byte) {
+	if iterator == 0{
+		return 1, aFilter.encodeHeader()
+	}
+	if iterator < 0{
+		return 0, nil
+	}
+
+	layer, offset:= aFilter.locate( iterator - 1 )
+	if layer < 0{
+		return 0, nil
+	}
+
+	length:= min( redisChunkSize, aFilter.layerBytes(layer) - offset )
+
+	//buckets are little endian words so bucket x is bit x%8 of byte x/8,
+	//just as RedisBloom lays its bytes out
+	chunk:= make( []byte, length )
+	words:= aFilter.Layers[layer].Filter.IntBuckets
+	for i := range chunk {
+		position:= offset + i
+		chunk[i] = byte( words[position/8] >> (8*uint(position%8)) )
+	}
+
+	return iterator + int64(length), chunk
+}
+
+//one step of BF.LOADCHUNK. The iterator 1 chunk is the header and replaces
+//everything in the filter with empty layers, every later chunk fills in part of
+//a layer. Iterators and chunks are exactly what BF.SCANDUMP, or ScanDump, returned.
+//
+//returns ErrCorrupt for chunks that don't fit the layers, see ScalableFilter.Validate
+//for headers, and ErrTooLarge for headers describing more than MaxSerializedSize bytes
+func (aFilter *ScalableFilter) LoadChunk( iterator int64, data []byte ) error {
+	if iterator == 1{
+		return aFilter.decodeHeader(data)
+	}
+
+	//the iterator points just past the chunk
+	if iterator <= 0 || iterator < int64( len(data) ){
+		return ErrCorrupt
+	}
+	iterator-= int64( len(data) )
+
+	layer, offset:= aFilter.locate( iterator - 1 )
+	if layer < 0 || len(data) > aFilter.layerBytes(layer) - offset{
+		return ErrCorrupt
+	}
+
+	words:= aFilter.Layers[layer].Filter.IntBuckets
+	for i,aByte:= range data {
+		position:= offset + i
+		shift:= 8*uint(position%8)
+		words[position/8] = words[position/8] &^ (0xff << shift) | uint64(aByte) << shift
+	}
+
+	return nil
+}
+
+//RedisBloom's packed dumpedChainHeader followed by a dumpedChainLink per layer
+func (aFilter *ScalableFilter) encodeHeader() []byte {
+	header:= make( []byte, 0, redisHeaderSize + redisLinkSize*len(aFilter.Layers) )
+
+	header = binary.LittleEndian.AppendUint64( header, aFilter.Count )
+	header = binary.LittleEndian.AppendUint32( header, uint32( len(aFilter.Layers) ) )
+	header = binary.LittleEndian.AppendUint32( header, aFilter.Options )
+	header = binary.LittleEndian.AppendUint32( header, aFilter.Growth )
+
+	for i := range aFilter.Layers {
+		layer:= &aFilter.Layers[i]
+
+		header = binary.LittleEndian.AppendUint64( header, uint64( aFilter.layerBytes(i) ) )
+		header = binary.LittleEndian.AppendUint64( header, uint64( aFilter.layerBytes(i) ) * 8 )
+		header = binary.LittleEndian.AppendUint64( header, layer.Count )
+		header = binary.LittleEndian.AppendUint64( header, math.Float64bits(layer.ErrorRate) )
+		header = binary.LittleEndian.AppendUint64( header, math.Float64bits(layer.BitsPerEntry) )
+		header = binary.LittleEndian.AppendUint32( header, uint32( layer.Filter.HashIterations ) )
+		header = binary.LittleEndian.AppendUint64( header, layer.Capacity )
+		header = append( header, layer.N2 )
+	}
+
+	return header
+}
+
+//the counterpart to encodeHeader, builds empty layers for the chunks to fill
+func (aFilter *ScalableFilter) decodeHeader( header []byte ) error {
+	if len(header) < redisHeaderSize{
+		return ErrCorrupt
+	}
+
+	layers:= int64( binary.LittleEndian.Uint32( header[8:] ) )
+	if int64( len(header) ) != redisHeaderSize + redisLinkSize*layers{
+		return ErrCorrupt
+	}
+
+	decoded:= ScalableFilter{
+		Count: binary.LittleEndian.Uint64( header[0:] ),
+		Options: binary.LittleEndian.Uint32( header[12:] ),
+		Growth: binary.LittleEndian.Uint32( header[16:] ),
+		Layers: make( []ScalableLayer, layers ),
+	}
+
+	//checked before allocating anything, the header alone
+	//could otherwise ask for any amount of memory
+	var total uint64
+	for i := range decoded.Layers {
+		link:= header[ redisHeaderSize + redisLinkSize*i : ]
+
+		bytes:= binary.LittleEndian.Uint64( link[0:] )
+		bits:= binary.LittleEndian.Uint64( link[8:] )
+		if bytes > uint64(MaxSerializedSize) || bits > math.MaxInt64{
+			return ErrTooLarge
+		}
+		total+= bytes
+
+		//bloom_init always sets the bits to every bit of the whole words
+		//it allocates, a power of two layer only uses the first 2^N2 of them
+		if bytes == 0 || bytes % 8 != 0 || bits != bytes*8{
+			return ErrCorrupt
+		}
+		n2:= link[52]
+		if n2 > 62 || ( n2 > 0 && ( 1 << n2 > bits || 1 << n2 <= bits - 64 ) ){
+			return ErrCorrupt
+		}
+		if n2 > 0{
+			bits = 1 << n2
+		}
+
+		decoded.Layers[i] = ScalableLayer{
+			Filter: BloomFilter{ Strategy: RedisMurmur64A, Size: int(bits),
+				HashIterations: int( binary.LittleEndian.Uint32( link[40:] ) ) },
+			Count: binary.LittleEndian.Uint64( link[16:] ),
+			ErrorRate: math.Float64frombits( binary.LittleEndian.Uint64( link[24:] ) ),
+			BitsPerEntry: math.Float64frombits( binary.LittleEndian.Uint64( link[32:] ) ),
+			Capacity: binary.LittleEndian.Uint64( link[44:] ),
+			N2: n2,
+		}
+	}
+	if total > uint64(MaxSerializedSize){
+		return ErrTooLarge
+	}
+
+	for i := range decoded.Layers {
+		decoded.Layers[i].Filter.BuildBuckets()
+	}
+
+	err:= decoded.Validate()
+	if err!=nil{
+		return err
+	}
+
+	*aFilter = decoded
+
+	return nil
+}
@@ -0,0 +1,506 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+)
+
+//a chunk of BF.SCANDUMP output and the iterator it came with
+type redisChunk struct{
+	iterator int64
+	chunk string
+}
+
+//what BF.SCANDUMP should give for a filter from BF.RESERVE key 0.01 100 EXPANSION 2
+//followed by BF.ADD of "item-0" to "item-249", as iterator and chunk pairs.
+//
+//these are reference vectors, not a capture. They were built by a separate
+//reimplementation of RedisBloom's SBChain, bloom_init and MurmurHash64A following
+//its sources, so they only guard against regressions. TestRedisCapturedDump checks
+//the same things against a real server's output, see testdata/redisbloom
+var redisDump = []redisChunk{
+	{ 1, "fa000000000000000200000005000000020000007800000000000000c00300000000000064000000000000007b14ae47e17a843f88168ac58c2b2340070000006400000000000000001801000000000000c00800000000000096000000000000007b14ae47e17a743fe9862fb2350e264008000000c80000000000000000" },
+	{ 121, "591e647205f3dbe7cf83dc6943f8df043f0f44df757cc9d0f9bfdf4147a7785abd7303be796891dbc9a53033fc5f12c6894a4c6031eb89bc6ac5561715a7b77d918a8361649bd257fc9f2b2c8dd3fab2f31123c88a3a5827b156b4226819f864ae76146aee2ae7f9731e95a3e6332158279f4d8296cf4f17" },
+	{ 401, "023a854084694c08d81709852b79084d01c4e09708305607228a9e068c071c434cf1001d86e9a79a6403886b1c421f05544c332a4875a2c6ae12a495e82b88a20642b57428f3f6056b5d2e4093b4a7c4207511fc441a10650682148fbd2f8e4354304cc0a2b450bd182c3020d59610581088890af760719501f01d9537412ca99eb7aae1d0d81e34013d18d5362c22169e01728970a44002811cd7680ca719ae58369596d4f78808943758a1c80d4932d488d02a8e28baa3593b6a12178b23411ef564c21f8284c31535430c07a31b4cb9104252734ab5758b60ab1ef4909908215e8ecc012c8d694309299a9040e638f280c32816ee1948efe6018560bbdaa31adf7f385e914074116e80822daad96457f61008d1287561" },
+}
+
+//of "probe-0" to "probe-2999", the false positives of the reference filter
+var redisFalsePositives = []int{ 11, 38, 52, 158, 191, 345, 475, 544, 636, 743, 772, 795, 830, 859, 870, 908, 930, 978, 1006,
+	1062, 1371, 1422, 1494, 1537, 1570, 1578, 1579, 1761, 1807, 1971, 2341, 2392, 2422, 2454,
+	2640, 2975 }
+
+//loads every chunk of a dump in order
+func loadRedisDump( t *testing.T, dump []redisChunk ) *ScalableFilter {
+	aFilter:= &ScalableFilter{}
+	for _,aChunk:= range dump {
+		data, _:= hex.DecodeString(aChunk.chunk)
+		err:= aFilter.LoadChunk( aChunk.iterator, data )
+		if err!=nil{
+			t.Fatal("Failed to load a RedisBloom chunk", aChunk.iterator, err)
+		}
+	}
+
+	return aFilter
+}
+
+//dumps every chunk of a filter as iterator and chunk pairs
+func scanDumpAll( aFilter *ScalableFilter ) (iterators []int64, chunks [][]byte) {
+	for iterator, chunk:= aFilter.ScanDump(0); iterator != 0; iterator, chunk = aFilter.ScanDump(iterator) {
+		iterators = append( iterators, iterator )
+		chunks = append( chunks, chunk )
+	}
+
+	return iterators, chunks
+}
+
+func TestRedisDump(t *testing.T) {
+	checkRedisDump( t, redisDump, redisFalsePositives )
+}
+
+//the same checks against a dump from a RedisBloom server, when one has been captured
+func TestRedisCapturedDump(t *testing.T) {
+	captured, err:= os.ReadFile( filepath.Join( "testdata", "redisbloom", "scandump.txt" ) )
+	if os.IsNotExist(err){
+		t.Skip("No dump captured from RedisBloom yet, see testdata/redisbloom/README.md")
+	}
+	if err!=nil{
+		t.Fatal("Failed to read the captured dump", err)
+	}
+
+	var dump []redisChunk
+	var falsePositives []int
+	for _,aLine:= range strings.Split( string(captured), "\n" ) {
+		fields:= strings.Fields(aLine)
+		switch{
+		case len(fields) == 3 && fields[0] == "chunk":
+			iterator, err:= strconv.ParseInt( fields[1], 10, 64 )
+			if err!=nil{
+				t.Fatal("Captured dump has a bad iterator", aLine)
+			}
+			dump = append( dump, redisChunk{ iterator, fields[2] } )
+		case len(fields) == 2 && fields[0] == "positive":
+			aProbe, err:= strconv.Atoi( fields[1] )
+			if err!=nil{
+				t.Fatal("Captured dump has a bad probe", aLine)
+			}
+			falsePositives = append( falsePositives, aProbe )
+		}
+	}
+	if len(dump) == 0{
+		t.Fatal("Captured dump has no chunks")
+	}
+
+	checkRedisDump( t, dump, falsePositives )
+}
+
+//captures testdata/redisbloom/scandump.txt from the RedisBloom server at
+//REDISBLOOM_ADDR, skipped unless it's set. See testdata/redisbloom/README.md
+func TestCaptureRedisDump(t *testing.T) {
+	address:= os.Getenv("REDISBLOOM_ADDR")
+	if address == ""{
+		t.Skip("REDISBLOOM_ADDR isn't set")
+	}
+
+	connection, err:= net.Dial( "tcp", address )
+	if err!=nil{
+		t.Fatal("Failed to reach RedisBloom", err)
+	}
+	defer connection.Close()
+	server:= bufio.NewReadWriter( bufio.NewReader(connection), bufio.NewWriter(connection) )
+
+	call:= func( arguments ...string ) any {
+		reply, err:= redisCall( server, arguments... )
+		if err!=nil{
+			t.Fatal("RedisBloom refused a command", arguments[0], err)
+		}
+		return reply
+	}
+
+	var capture strings.Builder
+	for _,aLine:= range strings.Split( call( "INFO", "server" ).(string), "\r\n" ) {
+		if strings.HasPrefix( aLine, "redis_version:" ){
+			fmt.Fprintf( &capture, "# %s\n", aLine )
+		}
+	}
+	for _,aModule:= range call( "MODULE", "LIST" ).([]any) {
+		fmt.Fprintf( &capture, "# module %v\n", aModule )
+	}
+	fmt.Fprintf( &capture, "# BF.RESERVE key 0.01 100 EXPANSION 2, BF.ADD key item-0 to item-249, BF.SCANDUMP, BF.EXISTS key probe-0 to probe-2999\n" )
+
+	key:= "goFilter:capture"
+	call( "DEL", key )
+	call( "BF.RESERVE", key, "0.01", "100", "EXPANSION", "2" )
+	for i := 0; i < 250; i++ {
+		call( "BF.ADD", key, fmt.Sprintf( "item-%d", i ) )
+	}
+
+	for iterator:= int64(0); ; {
+		reply:= call( "BF.SCANDUMP", key, strconv.FormatInt( iterator, 10 ) ).([]any)
+		iterator = reply[0].(int64)
+		if iterator == 0{
+			break
+		}
+		fmt.Fprintf( &capture, "chunk %d %s\n", iterator, hex.EncodeToString( []byte( reply[1].(string) ) ) )
+	}
+	for i := 0; i < 3000; i++ {
+		if call( "BF.EXISTS", key, fmt.Sprintf( "probe-%d", i ) ).(int64) == 1{
+			fmt.Fprintf( &capture, "positive %d\n", i )
+		}
+	}
+	call( "DEL", key )
+
+	err = os.WriteFile( filepath.Join( "testdata", "redisbloom", "scandump.txt" ), []byte( capture.String() ), 0664 )
+	if err!=nil{
+		t.Fatal("Failed to write the capture", err)
+	}
+}
+
+//sends a command over RESP and reads its reply, as a string, an int64,
+//nil or a slice of those
+func redisCall( server *bufio.ReadWriter, arguments ...string ) (any, error) {
+	fmt.Fprintf( server, "*%d\r\n", len(arguments) )
+	for _,anArgument:= range arguments {
+		fmt.Fprintf( server, "$%d\r\n%s\r\n", len(anArgument), anArgument )
+	}
+	err:= server.Flush()
+	if err!=nil{
+		return nil, err
+	}
+
+	return redisReply(server.Reader)
+}
+
+func redisReply( reader *bufio.Reader ) (any, error) {
+	line, err:= reader.ReadString('\n')
+	if err!=nil{
+		return nil, err
+	}
+	if len(line) < 3{
+		return nil, fmt.Errorf( "short reply %q", line )
+	}
+	kind, body:= line[0], line[1:len(line)-2]
+
+	switch kind{
+	case '+':
+		return body, nil
+	case '-':
+		return nil, errors.New(body)
+	case ':':
+		return strconv.ParseInt( body, 10, 64 )
+	case '$', '*':
+		length, err:= strconv.Atoi(body)
+		if err!=nil || length < 0{
+			return nil, err
+		}
+
+		if kind == '$'{
+			data:= make( []byte, length + 2 )
+			_, err = io.ReadFull( reader, data )
+			return string( data[:length] ), err
+		}
+
+		elements:= make( []any, length )
+		for i := range elements {
+			elements[i], err = redisReply(reader)
+			if err!=nil{
+				return nil, err
+			}
+		}
+		return elements, nil
+	}
+
+	return nil, fmt.Errorf( "unknown reply %q", line )
+}
+
+//a dump of the filter TestRedisDump describes has to load with the right shape, answer
+//every probe as RedisBloom did and come back chunk for chunk when dumped again
+func checkRedisDump( t *testing.T, dump []redisChunk, falsePositives []int ) {
+	aFilter:= loadRedisDump( t, dump )
+
+	if len(aFilter.Layers) != 2 || aFilter.Count != 250 || aFilter.Growth != 2 ||
+		aFilter.Options != RedisOptionNoRound | RedisOptionForce64{
+		t.Fatal("Dumped filter has the wrong shape", len(aFilter.Layers), aFilter.Count, aFilter.Options)
+	}
+	shapes:= []struct{
+		size, hashIterations int
+		capacity, count uint64
+	}{
+		{ 960, 7, 100, 100 },
+		{ 2240, 8, 200, 150 },
+	}
+	for i,aShape:= range shapes {
+		layer:= aFilter.Layers[i]
+		if layer.Filter.Size != aShape.size || layer.Filter.HashIterations != aShape.hashIterations ||
+			layer.Capacity != aShape.capacity || layer.Count != aShape.count{
+			t.Error("Dumped layer has the wrong shape", i, layer.Filter.Size, layer.Filter.HashIterations,
+				layer.Capacity, layer.Count)
+		}
+	}
+
+	for i := 0; i < 250; i++ {
+		if !aFilter.CheckMembership( []byte( fmt.Sprintf( "item-%d", i ) ) ){
+			t.Error("Dumped filter lost an item", i)
+		}
+	}
+
+	positives:= map[int]bool{}
+	for _,aProbe:= range falsePositives {
+		positives[aProbe] = true
+	}
+	for i := 0; i < 3000; i++ {
+		if aFilter.CheckMembership( []byte( fmt.Sprintf( "probe-%d", i ) ) ) != positives[i]{
+			t.Error("Dumped filter disagrees with RedisBloom about a probe", i)
+		}
+	}
+
+	//dumping the loaded filter, and one built from scratch, gives back the same chunks
+	built:= NewScalableFilter( 100, 0.01, 2, true )
+	for i := 0; i < 250; i++ {
+		err:= built.Add( []byte( fmt.Sprintf( "item-%d", i ) ) )
+		if err!=nil{
+			t.Fatal("Failed to add to a scalable filter", err)
+		}
+	}
+
+	//Go's math.Log and C's log can round differently, which only ever moves
+	//the recorded BitsPerEntry by an ulp
+	for i := range built.Layers {
+		if math.Abs( built.Layers[i].BitsPerEntry - aFilter.Layers[i].BitsPerEntry ) > 1e-12{
+			t.Error("Built layer has the wrong bits per entry", i, built.Layers[i].BitsPerEntry)
+		}
+		built.Layers[i].BitsPerEntry = aFilter.Layers[i].BitsPerEntry
+	}
+
+	for _,dumped:= range []*ScalableFilter{ aFilter, built } {
+		iterators, chunks:= scanDumpAll(dumped)
+		if len(chunks) != len(dump){
+			t.Fatal("Dump has the wrong amount of chunks", len(chunks))
+		}
+		for i,aChunk:= range dump {
+			if iterators[i] != aChunk.iterator || hex.EncodeToString(chunks[i]) != aChunk.chunk{
+				t.Errorf("Chunk %d differs from RedisBloom's, %d %x", i, iterators[i], chunks[i])
+			}
+		}
+	}
+}
+
+//filters round trip through chunks of any size and keep scaling once loaded
+func TestScalableFilter(t *testing.T) {
+	defer func( size int ) { redisChunkSize = size }( redisChunkSize )
+
+	randomKeys:= testKeys()
+
+	aFilter:= NewScalableFilter( 500, 0.001, 4, true )
+	testBytes:= make([][]byte, 5000)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(12)
+		aFilter.Add(testBytes[i])
+	}
+	if len(aFilter.Layers) != 3{
+		t.Fatal("Scalable filter didn't scale as expected", len(aFilter.Layers))
+	}
+
+	for _,size:= range []int{ 1, 7, 64, 1000, 16 << 20 } {
+		redisChunkSize = size
+
+		loaded:= &ScalableFilter{}
+		iterators, chunks:= scanDumpAll(aFilter)
+		for i := range chunks {
+			if len(chunks[i]) > size && i > 0{
+				t.Fatal("Chunk was larger than the chunk size", size, len(chunks[i]))
+			}
+			err:= loaded.LoadChunk( iterators[i], chunks[i] )
+			if err!=nil{
+				t.Fatal("Failed to load a chunk", size, i, err)
+			}
+		}
+
+		for i := range aFilter.Layers {
+			if !slices.Equal( aFilter.Layers[i].Filter.IntBuckets, loaded.Layers[i].Filter.IntBuckets ){
+				t.Fatal("Loaded layer differs", size, i)
+			}
+		}
+		for i := range testBytes {
+			if !loaded.CheckMembership(testBytes[i]){
+				t.Fatal("Loaded filter lost an item", size, i)
+			}
+		}
+	}
+
+	//the error rate overall stays near the first layer's
+	falsePositives:= 0
+	for i := 0; i < 20000; i++ {
+		if aFilter.CheckMembership( randomKeys.Key(13) ){
+			falsePositives++
+		}
+	}
+	if rate:= float64(falsePositives) / 20000; rate > 0.004{
+		t.Error("Scalable filter's false positive rate is too high", rate)
+	}
+
+	allocations:= testing.AllocsPerRun( 100, func() {
+		aFilter.Layers[0].Filter.CheckMembership(testBytes[0])
+	})
+	if allocations != 0{
+		t.Error("RedisMurmur64A lookup allocated", allocations)
+	}
+
+	full:= NewScalableFilter( 10, 0.01, 2, false )
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = full.Add( randomKeys.Key(12) )
+	}
+	if err != ErrFull || len(full.Layers) != 1{
+		t.Error("Non scaling filter didn't fill up", err, len(full.Layers))
+	}
+}
+
+//layers rounded up to a power of two, as bloom_init makes them without
+//RedisOptionNoRound, record every bit of their words but only use 2^N2
+func TestScalableRoundedLayers(t *testing.T) {
+	shapes:= []struct{
+		capacity uint64
+		errorRate float64
+		n2 uint8
+		size, headerBits int
+	}{
+		//958.5 bits wanted
+		{ 100, 0.01, 10, 1024, 1024 },
+		//1.44 bits wanted, in a word as every layer is
+		{ 1, 0.5, 1, 2, 64 },
+	}
+
+	for _,aShape:= range shapes {
+		aFilter:= &ScalableFilter{ Options: RedisOptionForce64, Growth: 2 }
+		err:= aFilter.addLayer( aShape.capacity, aShape.errorRate )
+		if err!=nil{
+			t.Fatal("Failed to add a rounded layer", err)
+		}
+
+		layer:= aFilter.Layers[0]
+		if layer.N2 != aShape.n2 || layer.Filter.Size != aShape.size{
+			t.Error("Rounded layer has the wrong shape", aShape.capacity, layer.N2, layer.Filter.Size)
+		}
+
+		aFilter.Add( []byte("rounded") )
+
+		iterators, chunks:= scanDumpAll(aFilter)
+		if bits:= binary.LittleEndian.Uint64( chunks[0][redisHeaderSize + 8:] ); bits != uint64(aShape.headerBits){
+			t.Error("Rounded layer's header has the wrong bits", aShape.capacity, bits)
+		}
+
+		loaded:= &ScalableFilter{}
+		for i := range chunks {
+			err:= loaded.LoadChunk( iterators[i], chunks[i] )
+			if err!=nil{
+				t.Fatal("Failed to load a rounded layer", aShape.capacity, err)
+			}
+		}
+		if loaded.Layers[0].N2 != aShape.n2 || loaded.Layers[0].Filter.Size != aShape.size ||
+			!loaded.CheckMembership( []byte("rounded") ){
+			t.Error("Loaded rounded layer differs", aShape.capacity, loaded.Layers[0].N2, loaded.Layers[0].Filter.Size)
+		}
+	}
+}
+
+func TestRedisRejects(t *testing.T) {
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+	MaxSerializedSize = 1 << 16
+
+	header, _:= hex.DecodeString( redisDump[0].chunk )
+	broken:= func( offset int, value ...byte ) []byte {
+		changed:= bytes.Clone(header)
+		copy( changed[offset:], value )
+		return changed
+	}
+
+	//offsets of the first layer's fields
+	const link = redisHeaderSize
+
+	headers:= map[string]struct{
+		data []byte
+		err error
+	}{
+		"short": { header[:10], ErrCorrupt },
+		"truncated": { header[:len(header)-1], ErrCorrupt },
+		"no layers": { broken( 8, 0 ), ErrCorrupt },
+		"32 bit hashes": { broken( 12, 1 ), ErrUnsupportedStrategy },
+		"no growth": { broken( 16, 0 ), ErrCorrupt },
+		"bytes and bits disagree": { broken( link, 0x80 ), ErrCorrupt },
+		"bits short of the words": { broken( link + 8, 0xbe ), ErrCorrupt },
+		"no bits": { broken( link + 8, 0, 0 ), ErrCorrupt },
+		"no hashes": { broken( link + 40, 0 ), ErrCorrupt },
+		"bad error rate": { broken( link + 31, 0xf0 ), ErrCorrupt },
+		"bad n2": { broken( link + 52, 3 ), ErrCorrupt },
+		"huge": { broken( link, 0, 0, 0, 0, 0, 0, 0, 1 ), ErrTooLarge },
+	}
+
+	for name,aCase:= range headers {
+		if err:= (&ScalableFilter{}).LoadChunk( 1, aCase.data ); err != aCase.err{
+			t.Error("Broken header gave the wrong error", name, err)
+		}
+	}
+
+	aFilter:= loadRedisDump( t, redisDump )
+	chunk, _:= hex.DecodeString( redisDump[1].chunk )
+	chunks:= map[string]struct{
+		iterator int64
+		data []byte
+	}{
+		"before the start": { 0, chunk },
+		"negative": { -5, chunk },
+		"overruns its layer": { 122, chunk },
+		"past the end": { 1000, chunk },
+	}
+
+	for name,aCase:= range chunks {
+		if err:= aFilter.LoadChunk( aCase.iterator, aCase.data ); err != ErrCorrupt{
+			t.Error("Broken chunk was loaded", name, err)
+		}
+	}
+
+	if (&ScalableFilter{ Options: RedisOptionForce64 }).Validate() != ErrCorrupt{
+		t.Error("A filter without layers validated")
+	}
+}
+
+func FuzzLoadChunk(f *testing.F) {
+	//headers can otherwise ask for gigabytes
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+	MaxSerializedSize = 1 << 20
+
+	header, _:= hex.DecodeString( redisDump[0].chunk )
+	chunk, _:= hex.DecodeString( redisDump[1].chunk )
+	f.Add( header, int64(121), chunk )
+
+	f.Fuzz(func( t *testing.T, header []byte, iterator int64, chunk []byte ) {
+		aFilter:= &ScalableFilter{}
+		if aFilter.LoadChunk( 1, header ) != nil{
+			return
+		}
+		if aFilter.Validate() != nil{
+			t.Fatal("LoadChunk accepted an invalid header")
+		}
+
+		aFilter.LoadChunk( iterator, chunk )
+
+		if aFilter.Add(chunk) == nil && !aFilter.CheckMembership(chunk){
+			t.Fatal("Loaded filter lost an item")
+		}
+	})
+}
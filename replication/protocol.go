@@ -0,0 +1,219 @@
+package replication
+
+import(
+	"bufio" //for framing messages on the connection
+	"encoding/binary" //for the little endian words and varints
+	"errors" //for protocol violations
+	"io" //for reading messages
+)
+
+//returned when the other end sends something the protocol doesn't allow,
+//a message out of order, an unknown one or words outside the filter
+var ErrProtocol = errors.New("replication: peer broke the protocol")
+
+//opens every connection, versioned so the protocol can change
+const helloMagic = "goFilterReplica\x01"
+
+//the kinds of message, each the first byte of its message
+const(
+	//primary to follower, first: helloMagic, the filter's constants and the epoch
+	kindHello byte = 'H'
+
+	//follower to primary in reply: whether it's seen the epoch and, if so,
+	//the last sequence number it applied
+	kindResume byte = 'R'
+
+	//either way, instead of the above: the filters have different constants
+	kindRefuse byte = 'X'
+
+	//primary to follower: every nonzero word, as of a sequence number
+	kindSnapshot byte = 'S'
+
+	//primary to follower: the words changed in one sequence number
+	kindBatch byte = 'B'
+)
+
+//a sequence number's worth of changes, words in increasing order each
+//with the mask to or into it
+type batch struct{
+	sequence uint64
+	words []int
+	masks []uint64
+}
+
+//buffers messages for one connection
+type messageWriter struct{
+	writer *bufio.Writer
+	scratch [binary.MaxVarintLen64]byte
+}
+
+func newMessageWriter( writer io.Writer ) *messageWriter {
+	return &messageWriter{ writer: bufio.NewWriter(writer) }
+}
+
+func (aWriter *messageWriter) uvarint( value uint64 ) {
+	aWriter.writer.Write( aWriter.scratch[ : binary.PutUvarint( aWriter.scratch[:], value ) ] )
+}
+
+func (aWriter *messageWriter) word( value uint64 ) {
+	binary.LittleEndian.PutUint64( aWriter.scratch[:8], value )
+	aWriter.writer.Write( aWriter.scratch[:8] )
+}
+
+func (aWriter *messageWriter) hello( constants [7]uint64, epoch uint64 ) {
+	aWriter.writer.WriteByte(kindHello)
+	aWriter.writer.WriteString(helloMagic)
+	for _,aConstant:= range constants {
+		aWriter.uvarint(aConstant)
+	}
+	aWriter.word(epoch)
+}
+
+func (aWriter *messageWriter) resume( seen bool, sequence uint64 ) {
+	aWriter.writer.WriteByte(kindResume)
+	if seen{
+		aWriter.writer.WriteByte(1)
+	}else{
+		aWriter.writer.WriteByte(0)
+	}
+	aWriter.uvarint(sequence)
+}
+
+func (aWriter *messageWriter) refuse() {
+	aWriter.writer.WriteByte(kindRefuse)
+}
+
+//a snapshot or a batch, the words as gaps from the one before
+func (aWriter *messageWriter) changes( kind byte, aBatch *batch ) {
+	aWriter.writer.WriteByte(kind)
+	aWriter.uvarint(aBatch.sequence)
+	aWriter.uvarint( uint64( len(aBatch.words) ) )
+
+	next:= 0
+	for i,aWord:= range aBatch.words {
+		aWriter.uvarint( uint64( aWord - next ) )
+		aWriter.word( aBatch.masks[i] )
+		next = aWord + 1
+	}
+}
+
+func (aWriter *messageWriter) flush() error {
+	return aWriter.writer.Flush()
+}
+
+//reads messages from one connection, treating everything as untrusted
+type messageReader struct{
+	reader *bufio.Reader
+}
+
+func newMessageReader( reader io.Reader ) *messageReader {
+	return &messageReader{ reader: bufio.NewReader(reader) }
+}
+
+//what a failed read means. Running out mid message is the peer's fault
+func protocolError( err error ) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF{
+		return ErrProtocol
+	}
+
+	return err
+}
+
+//the next message's kind. io.EOF means the peer closed between messages
+func (aReader *messageReader) kind() (byte, error) {
+	return aReader.reader.ReadByte()
+}
+
+func (aReader *messageReader) uvarint() (uint64, error) {
+	value, err:= binary.ReadUvarint(aReader.reader)
+	if err!=nil{
+		return 0, protocolError(err)
+	}
+
+	return value, nil
+}
+
+func (aReader *messageReader) word() (uint64, error) {
+	var word [8]byte
+	_, err:= io.ReadFull( aReader.reader, word[:] )
+	if err!=nil{
+		return 0, protocolError(err)
+	}
+
+	return binary.LittleEndian.Uint64( word[:] ), nil
+}
+
+//the rest of a hello, once its kind has been read
+func (aReader *messageReader) hello() (constants [7]uint64, epoch uint64, err error) {
+	magic:= make( []byte, len(helloMagic) )
+	_, err = io.ReadFull( aReader.reader, magic )
+	if err!=nil{
+		return constants, 0, protocolError(err)
+	}
+	if string(magic) != helloMagic{
+		return constants, 0, ErrProtocol
+	}
+
+	for i := range constants {
+		constants[i], err = aReader.uvarint()
+		if err!=nil{
+			return constants, 0, err
+		}
+	}
+
+	epoch, err = aReader.word()
+	return constants, epoch, err
+}
+
+//the rest of a resume, once its kind has been read
+func (aReader *messageReader) resume() (seen bool, sequence uint64, err error) {
+	flag, err:= aReader.reader.ReadByte()
+	if err!=nil{
+		return false, 0, protocolError(err)
+	}
+	if flag > 1{
+		return false, 0, ErrProtocol
+	}
+
+	sequence, err = aReader.uvarint()
+	return flag == 1, sequence, err
+}
+
+//the rest of a snapshot or batch, once its kind has been read.
+//words have to be in increasing order and within the filter's words
+func (aReader *messageReader) changes( words int, apply func( word int, mask uint64 ) ) (uint64, error) {
+	sequence, err:= aReader.uvarint()
+	if err!=nil{
+		return 0, err
+	}
+
+	count, err:= aReader.uvarint()
+	if err!=nil{
+		return 0, err
+	}
+	if count > uint64(words){
+		return 0, ErrProtocol
+	}
+
+	next:= 0
+	for i := uint64(0); i < count; i++ {
+		gap, err:= aReader.uvarint()
+		if err!=nil{
+			return 0, err
+		}
+		if gap >= uint64( words - next ){
+			return 0, ErrProtocol
+		}
+
+		mask, err:= aReader.word()
+		if err!=nil{
+			return 0, err
+		}
+
+		aWord:= next + int(gap)
+		apply( aWord, mask )
+		next = aWord + 1
+	}
+
+	return sequence, nil
+}
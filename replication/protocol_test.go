@@ -0,0 +1,103 @@
+package replication
+
+import (
+
+	"testing"
+	"bytes"
+	"io"
+
+)
+
+//a connection that reads from a fixed stream and drops whatever is written
+type scriptedConn struct{
+	io.Reader
+}
+
+func (scriptedConn) Write( data []byte ) (int, error) {
+	return len(data), nil
+}
+
+//every message round trips through the writer and reader
+func TestMessages(t *testing.T) {
+	var stream bytes.Buffer
+	writer:= newMessageWriter(&stream)
+
+	constants:= newTestFilter(2).Constants()
+	sent:= &batch{ sequence: 1 << 40, words: []int{ 0, 1, 900, 1023 }, masks: []uint64{ 1, 1 << 63, 0xdead, ^uint64(0) } }
+
+	writer.hello( constants, 0xfeed )
+	writer.resume( true, 12 )
+	writer.changes( kindBatch, sent )
+	writer.refuse()
+	writer.flush()
+
+	reader:= newMessageReader(&stream)
+
+	kind, _:= reader.kind()
+	gotConstants, epoch, err:= reader.hello()
+	if kind != kindHello || err != nil || gotConstants != constants || epoch != 0xfeed{
+		t.Fatal("Hello didn't round trip", kind, err, gotConstants, epoch)
+	}
+
+	kind, _ = reader.kind()
+	seen, sequence, err:= reader.resume()
+	if kind != kindResume || err != nil || !seen || sequence != 12{
+		t.Fatal("Resume didn't round trip", kind, err, seen, sequence)
+	}
+
+	received:= &batch{}
+	kind, _ = reader.kind()
+	received.sequence, err = reader.changes( 1024, func( word int, mask uint64 ) {
+		received.words = append( received.words, word )
+		received.masks = append( received.masks, mask )
+	})
+	if kind != kindBatch || err != nil || received.sequence != sent.sequence ||
+		!slicesEqual( received.words, sent.words ) || !slicesEqual( received.masks, sent.masks ){
+		t.Fatal("Batch didn't round trip", kind, err, received)
+	}
+
+	//the same batch is out of range for a smaller filter
+	stream.Reset()
+	writer.changes( kindBatch, sent )
+	writer.flush()
+	reader.kind()
+	if _, err:= reader.changes( 1000, func( int, uint64 ) {} ); err != ErrProtocol{
+		t.Error("Words past the filter were accepted", err)
+	}
+}
+
+func slicesEqual[ T comparable ]( a, b []T ) bool {
+	if len(a) != len(b){
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i]{
+			return false
+		}
+	}
+
+	return true
+}
+
+//whatever a primary sends, a follower mustn't panic or break its filter
+func FuzzFollow(f *testing.F) {
+	follower:= NewReplica( newTestFilter(1), Options{} )
+
+	var stream bytes.Buffer
+	writer:= newMessageWriter(&stream)
+	writer.hello( follower.constants, 1 )
+	writer.changes( kindSnapshot, &batch{ sequence: 2, words: []int{ 0, 3 }, masks: []uint64{ 5, 6 } } )
+	writer.changes( kindBatch, &batch{ sequence: 3, words: []int{ 1 }, masks: []uint64{ 7 } } )
+	writer.flush()
+	f.Add( stream.Bytes() )
+
+	f.Fuzz(func( t *testing.T, data []byte ) {
+		aReplica:= NewReplica( newTestFilter(1), Options{} )
+		aReplica.Follow( scriptedConn{ bytes.NewReader(data) } )
+
+		snapshot:= aReplica.Filter().Snapshot()
+		if snapshot.Validate() != nil{
+			t.Fatal("Following broke the filter")
+		}
+	})
+}
@@ -0,0 +1,355 @@
+//Package replication keeps copies of a bloom filter in step across processes.
+//
+//a Replica wraps a filter and ships the words that change in it, as a word
+//index and a mask to or in, to any other Replica following it over a
+//connection. Changes are published in numbered batches. A follower that
+//reconnects picks up from the last batch it applied, as long as the primary
+//still holds the batches after it. Otherwise, or the first time, it's sent a
+//snapshot of every word instead.
+//
+//oring bits is commutative and idempotent, so applying a batch twice or in
+//among other changes is harmless. That makes multiple primaries work too: have
+//every Replica both Serve and Follow the others and each ends up with the union
+//of everything added anywhere. Changes merged from one peer are published onward
+//to the rest, and peers stop passing a change along once it changes nothing.
+//
+//connections are any io.ReadWriter, a net.Conn or either end of a net.Pipe.
+//Replication carries adds only. A filter that's cleared with BuildBuckets is
+//still seen as full by its followers.
+package replication
+
+import(
+	"io" //for the connections
+	"math/rand/v2" //for picking epochs
+	"sync" //for waking Serve when batches are published
+	"time" //for publishing on a timer
+
+	bloomFilter "github.com/Everlag/goFilter"
+)
+
+//batches kept for resuming when Options.Retain isn't set
+const DefaultRetain = 1024
+
+//how a Replica publishes its changes
+type Options struct{
+	//how often changes are collected into a batch and sent to followers.
+	//0 leaves it to explicit Publish calls
+	PublishInterval time.Duration
+
+	//how many of the latest batches are kept so reconnecting followers can catch up
+	//with just what they missed. Followers further behind get a snapshot
+	Retain int
+}
+
+//one copy of a replicated filter. See the package documentation
+type Replica struct{
+	filter *bloomFilter.ConcurrentFilter
+	constants [7]uint64
+	options Options
+
+	//changes from before a restart can't be told apart from
+	//new ones, so each Replica numbers its batches in its own epoch
+	epoch uint64
+
+	lock sync.Mutex
+	published *sync.Cond
+
+	//the last batch published and the latest batches, oldest first
+	sequence uint64
+	batches []*batch
+
+	//for each epoch followed, the last batch applied from it
+	positions map[uint64]uint64
+
+	closed bool
+	stop chan struct{}
+	stopped chan struct{}
+}
+
+//wraps a built filter for replication. It starts tracking changes, so must
+//not be tracking them for anything else, and from then on must only be used
+//through Filter.
+//
+//whatever the filter already holds reaches followers through their first snapshot
+func NewReplica( aBloomFilter *bloomFilter.BloomFilter, options Options ) *Replica {
+	if options.Retain <= 0{
+		options.Retain = DefaultRetain
+	}
+
+	aBloomFilter.TrackChanges()
+
+	aReplica:= &Replica{
+		filter: bloomFilter.NewConcurrentFilter(aBloomFilter),
+		constants: aBloomFilter.Constants(),
+		options: options,
+		epoch: rand.Uint64(),
+		positions: map[uint64]uint64{},
+	}
+	aReplica.published = sync.NewCond(&aReplica.lock)
+
+	if options.PublishInterval > 0{
+		aReplica.stop = make( chan struct{} )
+		aReplica.stopped = make( chan struct{} )
+		go aReplica.publishEvery( options.PublishInterval )
+	}
+
+	return aReplica
+}
+
+//the filter being replicated, add to and check it here
+func (aReplica *Replica) Filter() *bloomFilter.ConcurrentFilter {
+	return aReplica.filter
+}
+
+//publishes on a timer until Close
+func (aReplica *Replica) publishEvery( interval time.Duration ) {
+	defer close(aReplica.stopped)
+
+	ticker:= time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select{
+		case <-aReplica.stop:
+			return
+		case <-ticker.C:
+			aReplica.Publish()
+		}
+	}
+}
+
+//collects every word changed since the last batch into a new one for followers,
+//returning the sequence number of the latest batch. Nothing is published if
+//nothing changed
+func (aReplica *Replica) Publish() uint64 {
+	aReplica.lock.Lock()
+	defer aReplica.lock.Unlock()
+
+	aBatch:= &batch{ sequence: aReplica.sequence + 1 }
+	aReplica.filter.TakeChanges(func( word int, value uint64 ) {
+		aBatch.words = append( aBatch.words, word )
+		aBatch.masks = append( aBatch.masks, value )
+	})
+	if len(aBatch.words) == 0{
+		return aReplica.sequence
+	}
+
+	aReplica.sequence = aBatch.sequence
+	aReplica.batches = append( aReplica.batches, aBatch )
+	if len(aReplica.batches) > aReplica.options.Retain{
+		aReplica.batches = append( aReplica.batches[:0], aReplica.batches[ len(aReplica.batches) - aReplica.options.Retain : ]... )
+	}
+
+	aReplica.published.Broadcast()
+
+	return aReplica.sequence
+}
+
+//whether a follower that applied up to the given batch can catch up
+//from the batches held. Called with the lock held
+func (aReplica *Replica) canResume( sequence uint64 ) bool {
+	if sequence > aReplica.sequence{
+		return false
+	}
+	if sequence == aReplica.sequence{
+		return true
+	}
+
+	return len(aReplica.batches) > 0 && aReplica.batches[0].sequence <= sequence + 1
+}
+
+//every nonzero word as of the latest batch. Called with the lock held,
+//so everything published so far is already in the words
+func (aReplica *Replica) snapshot() *batch {
+	snapshot:= aReplica.filter.Snapshot()
+
+	aBatch:= &batch{ sequence: aReplica.sequence }
+	for i,aWord:= range snapshot.IntBuckets {
+		if aWord != 0{
+			aBatch.words = append( aBatch.words, i )
+			aBatch.masks = append( aBatch.masks, aWord )
+		}
+	}
+
+	return aBatch
+}
+
+//sends this replica's changes to the follower on the other end of the connection
+//until either end goes away or Close is called, catching it up first.
+//
+//returns nil once the follower hangs up or Close is called, the caller still
+//closes the connection. Returns ErrIncompatible if the follower's filter
+//has other constants
+func (aReplica *Replica) Serve( conn io.ReadWriter ) error {
+	writer:= newMessageWriter(conn)
+	reader:= newMessageReader(conn)
+
+	writer.hello( aReplica.constants, aReplica.epoch )
+	err:= writer.flush()
+	if err!=nil{
+		return err
+	}
+
+	kind, err:= reader.kind()
+	if err!=nil{
+		return protocolError(err)
+	}
+	var seen bool
+	var position uint64
+	switch kind{
+	case kindRefuse:
+		return bloomFilter.ErrIncompatible
+	case kindResume:
+		seen, position, err = reader.resume()
+		if err!=nil{
+			return err
+		}
+	default:
+		return ErrProtocol
+	}
+
+	//the follower says nothing more, a read ending means it's gone
+	gone:= false
+	go func() {
+		io.Copy( io.Discard, reader.reader )
+
+		aReplica.lock.Lock()
+		gone = true
+		aReplica.published.Broadcast()
+		aReplica.lock.Unlock()
+	}()
+
+	aReplica.lock.Lock()
+	needsSnapshot:= !seen || !aReplica.canResume(position)
+	for {
+		var toSend []*batch
+		kind:= kindBatch
+
+		for !needsSnapshot && aReplica.sequence == position && !aReplica.closed && !gone{
+			aReplica.published.Wait()
+		}
+		if aReplica.closed || gone{
+			aReplica.lock.Unlock()
+			return nil
+		}
+
+		if needsSnapshot || !aReplica.canResume(position){
+			toSend = []*batch{ aReplica.snapshot() }
+			kind = kindSnapshot
+			needsSnapshot = false
+		}else{
+			for _,aBatch:= range aReplica.batches {
+				if aBatch.sequence > position{
+					toSend = append( toSend, aBatch )
+				}
+			}
+		}
+		aReplica.lock.Unlock()
+
+		//batches are never changed once published, so they're sent without the lock
+		for _,aBatch:= range toSend {
+			writer.changes( kind, aBatch )
+			position = aBatch.sequence
+		}
+		err:= writer.flush()
+		if err!=nil{
+			return err
+		}
+
+		aReplica.lock.Lock()
+	}
+}
+
+//applies the changes of the primary on the other end of the connection until
+//it goes away, resuming from the last batch applied from it if it's still
+//the same primary.
+//
+//returns nil once the primary hangs up between messages, the caller still
+//closes the connection. Returns ErrIncompatible if the primary's filter has other
+//constants and ErrProtocol if it sends anything unexpected. Changes from a
+//message cut short may already be merged, which is harmless.
+func (aReplica *Replica) Follow( conn io.ReadWriter ) error {
+	writer:= newMessageWriter(conn)
+	reader:= newMessageReader(conn)
+
+	kind, err:= reader.kind()
+	if err!=nil{
+		return protocolError(err)
+	}
+	if kind != kindHello{
+		return ErrProtocol
+	}
+	constants, epoch, err:= reader.hello()
+	if err!=nil{
+		return err
+	}
+
+	if constants != aReplica.constants{
+		writer.refuse()
+		writer.flush()
+		return bloomFilter.ErrIncompatible
+	}
+
+	aReplica.lock.Lock()
+	position, seen:= aReplica.positions[epoch]
+	aReplica.lock.Unlock()
+
+	writer.resume( seen, position )
+	err = writer.flush()
+	if err!=nil{
+		return err
+	}
+
+	words:= int( aReplica.constants[6] )
+	merge:= func( word int, mask uint64 ) {
+		aReplica.filter.MergeWord( word, mask )
+	}
+
+	for {
+		kind, err:= reader.kind()
+		if err == io.EOF{
+			return nil
+		}
+		if err!=nil{
+			return err
+		}
+
+		if kind != kindSnapshot && kind != kindBatch{
+			return ErrProtocol
+		}
+
+		sequence, err:= reader.changes( words, merge )
+		if err!=nil{
+			return err
+		}
+
+		//a snapshot can only ever move a follower forward
+		//and batches have to follow on from each other
+		if kind == kindSnapshot && seen && sequence < position{
+			return ErrProtocol
+		}
+		if kind == kindBatch && ( !seen || sequence != position + 1 ){
+			return ErrProtocol
+		}
+
+		seen, position = true, sequence
+		aReplica.lock.Lock()
+		aReplica.positions[epoch] = position
+		aReplica.lock.Unlock()
+	}
+}
+
+//stops publishing on a timer and ends every Serve. Follow calls end when their
+//connections are closed. The filter itself carries on working
+func (aReplica *Replica) Close() {
+	if aReplica.stop!=nil{
+		close(aReplica.stop)
+		<-aReplica.stopped
+		aReplica.stop = nil
+	}
+
+	aReplica.lock.Lock()
+	aReplica.closed = true
+	aReplica.published.Broadcast()
+	aReplica.lock.Unlock()
+}
@@ -0,0 +1,277 @@
+package replication
+
+import (
+
+	"testing"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+
+	bloomFilter "github.com/Everlag/goFilter"
+
+)
+
+func newTestFilter( dataDepth int ) *bloomFilter.BloomFilter {
+	aBloomFilter:= &bloomFilter.BloomFilter{ HashIterations: 4, DataDepth: dataDepth }
+	aBloomFilter.BuildBuckets()
+
+	return aBloomFilter
+}
+
+func addKeys( aReplica *Replica, prefix string, count int ) {
+	for i := 0; i < count; i++ {
+		aReplica.Filter().Add( []byte( fmt.Sprintf( "%s-%d", prefix, i ) ) )
+	}
+}
+
+//waits for every replica to hold the same words, failing after a while
+func waitConverged( t *testing.T, replicas ...*Replica ) {
+	deadline:= time.Now().Add( 10 * time.Second )
+	for {
+		first:= replicas[0].Filter().Snapshot()
+
+		converged:= true
+		for _,aReplica:= range replicas[1:] {
+			other:= aReplica.Filter().Snapshot()
+			if !slices.Equal( first.IntBuckets, other.IntBuckets ){
+				converged = false
+			}
+		}
+		if converged{
+			return
+		}
+
+		if time.Now().After(deadline){
+			t.Fatal("Replicas never converged")
+		}
+		time.Sleep( time.Millisecond )
+	}
+}
+
+//counts the bytes read through it
+type countingConn struct{
+	net.Conn
+	lock sync.Mutex
+	read int
+}
+
+func (aConn *countingConn) Read( data []byte ) (int, error) {
+	read, err:= aConn.Conn.Read(data)
+
+	aConn.lock.Lock()
+	aConn.read+= read
+	aConn.lock.Unlock()
+
+	return read, err
+}
+
+func (aConn *countingConn) bytesRead() int {
+	aConn.lock.Lock()
+	defer aConn.lock.Unlock()
+
+	return aConn.read
+}
+
+//connects a follower to a primary over a pipe, returning the follower's end
+//and a function hanging up the primary that reports both ends' errors
+func connect( t *testing.T, primary, follower *Replica ) (*countingConn, func() (error, error)) {
+	primaryEnd, followerEnd:= net.Pipe()
+	counted:= &countingConn{ Conn: followerEnd }
+
+	served:= make( chan error, 1 )
+	followed:= make( chan error, 1 )
+	go func() { served <- primary.Serve(primaryEnd) }()
+	go func() { followed <- follower.Follow(counted) }()
+
+	return counted, func() (error, error) {
+		primaryEnd.Close()
+		followed:= <-followed
+		followerEnd.Close()
+		return <-served, followed
+	}
+}
+
+func TestPrimaryFollower(t *testing.T) {
+	primary:= NewReplica( newTestFilter(3), Options{ Retain: 2 } )
+	follower:= NewReplica( newTestFilter(3), Options{} )
+	defer primary.Close()
+	defer follower.Close()
+
+	//what's there before replicating starts arrives as a snapshot
+	addKeys( primary, "before", 20000 )
+
+	conn, disconnect:= connect( t, primary, follower )
+	waitConverged( t, primary, follower )
+	snapshotSize:= conn.bytesRead()
+
+	for i := 0; i < 5; i++ {
+		addKeys( primary, fmt.Sprint( "live", i ), 100 )
+		primary.Publish()
+	}
+	waitConverged( t, primary, follower )
+
+	if served, followed:= disconnect(); served != nil || followed != nil{
+		t.Fatal("Replication ended badly", served, followed)
+	}
+
+	//missing one batch, caught up with just that batch
+	addKeys( primary, "missed", 100 )
+	primary.Publish()
+
+	conn, disconnect = connect( t, primary, follower )
+	waitConverged( t, primary, follower )
+	disconnect()
+	if conn.bytesRead() > snapshotSize / 10{
+		t.Error("Resuming sent a snapshot", conn.bytesRead(), snapshotSize)
+	}
+
+	//missing more batches than are kept, caught up with a snapshot
+	for i := 0; i < 3; i++ {
+		addKeys( primary, fmt.Sprint( "lost", i ), 100 )
+		primary.Publish()
+	}
+
+	conn, disconnect = connect( t, primary, follower )
+	waitConverged( t, primary, follower )
+	disconnect()
+	if conn.bytesRead() < snapshotSize{
+		t.Error("Falling too far behind didn't send a snapshot", conn.bytesRead(), snapshotSize)
+	}
+
+	//nothing changed publishes nothing
+	sequence:= primary.Publish()
+	if primary.Publish() != sequence{
+		t.Error("An empty batch was published")
+	}
+}
+
+//every replica serves and follows every other, they all end up with every key
+func TestMultiPrimary(t *testing.T) {
+	const peers = 3
+
+	replicas:= make( []*Replica, peers )
+	for i := range replicas {
+		replicas[i] = NewReplica( newTestFilter(2), Options{ PublishInterval: time.Millisecond } )
+	}
+
+	var disconnects []func() (error, error)
+	for i := range replicas {
+		for j := range replicas {
+			if i != j{
+				_, disconnect:= connect( t, replicas[i], replicas[j] )
+				disconnects = append( disconnects, disconnect )
+			}
+		}
+	}
+
+	var group sync.WaitGroup
+	for i,aReplica:= range replicas {
+		group.Add(1)
+		go func() {
+			defer group.Done()
+			for round := 0; round < 10; round++ {
+				addKeys( aReplica, fmt.Sprint( "peer", i, "-", round ), 50 )
+				time.Sleep( time.Millisecond )
+			}
+		}()
+	}
+	group.Wait()
+
+	waitConverged( t, replicas... )
+	for i := range replicas {
+		for round := 0; round < 10; round++ {
+			for k := 0; k < 50; k++ {
+				if !replicas[0].Filter().CheckMembership( []byte( fmt.Sprintf( "peer%d-%d-%d", i, round, k ) ) ){
+					t.Fatal("Merged filter lost a key", i, round, k)
+				}
+			}
+		}
+	}
+
+	//once converged, changes stop bouncing between peers
+	time.Sleep( 20 * time.Millisecond )
+	settled:= make( []uint64, peers )
+	for i,aReplica:= range replicas {
+		settled[i] = aReplica.Publish()
+	}
+	time.Sleep( 20 * time.Millisecond )
+	for i,aReplica:= range replicas {
+		if aReplica.Publish() != settled[i]{
+			t.Error("Peers kept publishing after converging", i)
+		}
+	}
+
+	for _,aReplica:= range replicas {
+		aReplica.Close()
+	}
+	for _,disconnect:= range disconnects {
+		if served, followed:= disconnect(); served != nil || followed != nil{
+			t.Error("Replication ended badly", served, followed)
+		}
+	}
+}
+
+func TestIncompatibleReplicas(t *testing.T) {
+	primary:= NewReplica( newTestFilter(2), Options{} )
+	follower:= NewReplica( newTestFilter(1), Options{} )
+
+	primaryEnd, followerEnd:= net.Pipe()
+	defer primaryEnd.Close()
+	defer followerEnd.Close()
+
+	served:= make( chan error, 1 )
+	go func() { served <- primary.Serve(primaryEnd) }()
+	followed:= follower.Follow(followerEnd)
+	if served:= <-served; served != bloomFilter.ErrIncompatible || followed != bloomFilter.ErrIncompatible{
+		t.Error("Replicas with different filters connected", served, followed)
+	}
+}
+
+//a primary that hangs up mid message is a protocol error, between messages it isn't
+func TestFollowerHangUp(t *testing.T) {
+	follower:= NewReplica( newTestFilter(1), Options{} )
+
+	stream:= func( extra []byte ) error {
+		primaryEnd, followerEnd:= net.Pipe()
+		go func() {
+			writer:= newMessageWriter(primaryEnd)
+			writer.hello( follower.constants, 7 )
+			writer.flush()
+
+			reader:= newMessageReader(primaryEnd)
+			reader.kind()
+			reader.resume()
+
+			writer.changes( kindSnapshot, &batch{ sequence: 3, words: []int{ 1, 2 }, masks: []uint64{ 1, 2 } } )
+			writer.flush()
+			primaryEnd.Write(extra)
+			primaryEnd.Close()
+		}()
+
+		err:= follower.Follow(followerEnd)
+		followerEnd.Close()
+		return err
+	}
+
+	if err:= stream(nil); err != nil{
+		t.Error("Clean hang up was an error", err)
+	}
+	if err:= stream( []byte{ kindBatch, 4 } ); err != ErrProtocol{
+		t.Error("Hang up mid batch wasn't a protocol error", err)
+	}
+	if err:= stream( []byte{ kindBatch, 9, 0 } ); err != ErrProtocol{
+		t.Error("Skipping batches wasn't a protocol error", err)
+	}
+	if err:= stream( []byte{ kindBatch, 4, 1, 10, 0, 0, 0, 0, 0, 0, 0, 0 } ); err != ErrProtocol{
+		t.Error("A word past the end wasn't a protocol error", err)
+	}
+	if err:= stream( []byte{ 'Z' } ); err != ErrProtocol{
+		t.Error("An unknown message wasn't a protocol error", err)
+	}
+
+	if follower.positions[7] != 3{
+		t.Error("Follower lost its position", follower.positions[7])
+	}
+}
@@ -0,0 +1,490 @@
+package bloomFilter
+
+import(
+	"bufio" //for writing bitmaps a container at a time
+	"encoding/binary" //for the format's little endian fields
+	"io" //for streaming bitmaps
+	"math/bits" //for counting values and runs in words
+	"slices" //for searching sorted containers
+)
+
+//Roaring bitmaps split 32 bit values by their top 16 bits into chunks of 65536,
+//each held by whichever of three containers is smallest for it: a sorted array
+//of values, a bitmap or a list of runs. The portable format, which the Java, C
+//and Go libraries all read and write, is described at
+//https://github.com/RoaringBitmap/RoaringFormatSpec
+const(
+	//opens a bitmap with no run containers, the container count follows
+	roaringCookieNoRuns = 12346
+
+	//opens a bitmap with run containers in its low 16 bits,
+	//the container count less one in its high 16 bits
+	roaringCookie = 12347
+
+	//bitmaps opened by roaringCookie only have offsets from this many containers
+	roaringNoOffsetThreshold = 4
+
+	//the most values an array container holds, a bitmap is smaller past it
+	roaringArrayMax = 4096
+
+	//words in a bitmap container, one bit for each value in the chunk
+	roaringBitmapWords = 1024
+
+	//runs take 4 bytes each, past this many a bitmap is smaller
+	roaringRunMax = 2047
+)
+
+//one chunk's values, the low 16 bits of each
+type roaringContainer interface{
+	contains( low uint16 ) bool
+
+	//adds the value, returning the container to use from then
+	//on and whether the value wasn't there before
+	add( low uint16 ) (roaringContainer, bool)
+
+	cardinality() int
+
+	//ors every value into the chunk's words, which may be
+	//fewer than roaringBitmapWords for a small filter
+	orInto( words []uint64 )
+
+	//bytes in the portable format and writing them
+	size() int
+	write( writer *bufio.Writer )
+}
+
+//sorted values, for chunks holding up to roaringArrayMax of them
+type arrayContainer struct{
+	values []uint16
+}
+
+func (aContainer *arrayContainer) contains( low uint16 ) bool {
+	_, found:= slices.BinarySearch( aContainer.values, low )
+	return found
+}
+
+func (aContainer *arrayContainer) add( low uint16 ) (roaringContainer, bool) {
+	position, found:= slices.BinarySearch( aContainer.values, low )
+	if found{
+		return aContainer, false
+	}
+
+	if len(aContainer.values) == roaringArrayMax{
+		aBitmap:= &bitmapContainer{ words: make( []uint64, roaringBitmapWords ) }
+		aContainer.orInto(aBitmap.words)
+		aBitmap.count = len(aContainer.values)
+		return aBitmap.add(low)
+	}
+
+	aContainer.values = slices.Insert( aContainer.values, position, low )
+	return aContainer, true
+}
+
+func (aContainer *arrayContainer) cardinality() int {
+	return len(aContainer.values)
+}
+
+func (aContainer *arrayContainer) orInto( words []uint64 ) {
+	for _,aValue:= range aContainer.values {
+		words[aValue/64]|= 1 << (aValue%64)
+	}
+}
+
+func (aContainer *arrayContainer) size() int {
+	return 2*len(aContainer.values)
+}
+
+func (aContainer *arrayContainer) write( writer *bufio.Writer ) {
+	for _,aValue:= range aContainer.values {
+		writeUint16( writer, aValue )
+	}
+}
+
+//a bit for every value in the chunk
+type bitmapContainer struct{
+	words []uint64
+	count int
+}
+
+func (aContainer *bitmapContainer) contains( low uint16 ) bool {
+	return aContainer.words[low/64] & ( 1 << (low%64) ) != 0
+}
+
+func (aContainer *bitmapContainer) add( low uint16 ) (roaringContainer, bool) {
+	if aContainer.contains(low){
+		return aContainer, false
+	}
+
+	aContainer.words[low/64]|= 1 << (low%64)
+	aContainer.count++
+	return aContainer, true
+}
+
+func (aContainer *bitmapContainer) cardinality() int {
+	return aContainer.count
+}
+
+func (aContainer *bitmapContainer) orInto( words []uint64 ) {
+	for i := range words {
+		words[i]|= aContainer.words[i]
+	}
+}
+
+func (aContainer *bitmapContainer) size() int {
+	return 8*roaringBitmapWords
+}
+
+func (aContainer *bitmapContainer) write( writer *bufio.Writer ) {
+	var word [8]byte
+	for _,aWord:= range aContainer.words {
+		binary.LittleEndian.PutUint64( word[:], aWord )
+		writer.Write( word[:] )
+	}
+}
+
+//an inclusive run of values
+type roaringRun struct{
+	start, last uint16
+}
+
+//sorted, disjoint runs of values, for chunks filled in long stretches
+type runContainer struct{
+	runs []roaringRun
+	count int
+}
+
+//the first run that ends at or after the value
+func (aContainer *runContainer) search( low uint16 ) int {
+	position, _:= slices.BinarySearchFunc( aContainer.runs, low, func( aRun roaringRun, low uint16 ) int {
+		return int(aRun.last) - int(low)
+	})
+	return position
+}
+
+func (aContainer *runContainer) contains( low uint16 ) bool {
+	position:= aContainer.search(low)
+	return position < len(aContainer.runs) && aContainer.runs[position].start <= low
+}
+
+func (aContainer *runContainer) add( low uint16 ) (roaringContainer, bool) {
+	position:= aContainer.search(low)
+	if position < len(aContainer.runs) && aContainer.runs[position].start <= low{
+		return aContainer, false
+	}
+	aContainer.count++
+
+	//extends the run before, the run after or both
+	joinsBefore:= position > 0 && int(aContainer.runs[position - 1].last) + 1 == int(low)
+	joinsAfter:= position < len(aContainer.runs) && int(aContainer.runs[position].start) == int(low) + 1
+	switch{
+	case joinsBefore && joinsAfter:
+		aContainer.runs[position - 1].last = aContainer.runs[position].last
+		aContainer.runs = slices.Delete( aContainer.runs, position, position + 1 )
+	case joinsBefore:
+		aContainer.runs[position - 1].last = low
+	case joinsAfter:
+		aContainer.runs[position].start = low
+	default:
+		aContainer.runs = slices.Insert( aContainer.runs, position, roaringRun{ low, low } )
+	}
+
+	if len(aContainer.runs) > roaringRunMax{
+		aBitmap:= &bitmapContainer{ words: make( []uint64, roaringBitmapWords ), count: aContainer.count }
+		aContainer.orInto(aBitmap.words)
+		return aBitmap, true
+	}
+
+	return aContainer, true
+}
+
+func (aContainer *runContainer) cardinality() int {
+	return aContainer.count
+}
+
+func (aContainer *runContainer) orInto( words []uint64 ) {
+	for _,aRun:= range aContainer.runs {
+		for aValue := int(aRun.start); aValue <= int(aRun.last); aValue++ {
+			words[aValue/64]|= 1 << (uint(aValue)%64)
+		}
+	}
+}
+
+func (aContainer *runContainer) size() int {
+	return 2 + 4*len(aContainer.runs)
+}
+
+func (aContainer *runContainer) write( writer *bufio.Writer ) {
+	writeUint16( writer, uint16( len(aContainer.runs) ) )
+	for _,aRun:= range aContainer.runs {
+		writeUint16( writer, aRun.start )
+		writeUint16( writer, aRun.last - aRun.start )
+	}
+}
+
+func writeUint16( writer *bufio.Writer, value uint16 ) {
+	writer.WriteByte( byte(value) )
+	writer.WriteByte( byte(value >> 8) )
+}
+
+//the smallest container holding the set bits of a chunk's words, nil if there are none.
+//runs are only used when strictly smaller, as the Roaring libraries do
+func containerFromWords( words []uint64 ) roaringContainer {
+	count, runs:= 0, 0
+	var carry uint64
+	for _,aWord:= range words {
+		count+= bits.OnesCount64(aWord)
+		//a run starts at every set bit whose lower neighbour is unset
+		runs+= bits.OnesCount64( aWord &^ ( aWord << 1 | carry ) )
+		carry = aWord >> 63
+	}
+
+	if count == 0{
+		return nil
+	}
+
+	if 2 + 4*runs < min( 2*count, 8*roaringBitmapWords ){
+		aContainer:= &runContainer{ runs: make( []roaringRun, 0, runs ), count: count }
+		inRun:= false
+		for i := 0; i < len(words)*64; i++ {
+			set:= words[i/64] & ( 1 << (uint(i)%64) ) != 0
+			switch{
+			case set && !inRun:
+				aContainer.runs = append( aContainer.runs, roaringRun{ uint16(i), uint16(i) } )
+			case set:
+				aContainer.runs[ len(aContainer.runs) - 1 ].last = uint16(i)
+			}
+			inRun = set
+		}
+		return aContainer
+	}
+
+	if count <= roaringArrayMax{
+		aContainer:= &arrayContainer{ values: make( []uint16, 0, count ) }
+		for i,aWord:= range words {
+			for aWord != 0{
+				aContainer.values = append( aContainer.values, uint16( i*64 + bits.TrailingZeros64(aWord) ) )
+				aWord&= aWord - 1
+			}
+		}
+		return aContainer
+	}
+
+	aContainer:= &bitmapContainer{ words: make( []uint64, roaringBitmapWords ), count: count }
+	copy( aContainer.words, words )
+	return aContainer
+}
+
+//writes containers, keyed by the high 16 bits of their values, in the portable format
+func writeRoaring( writer io.Writer, keys []uint16, containers []roaringContainer ) error {
+	buffered:= bufio.NewWriter(writer)
+	var scratch [4]byte
+	putUint32:= func( value uint32 ) {
+		binary.LittleEndian.PutUint32( scratch[:], value )
+		buffered.Write( scratch[:] )
+	}
+
+	hasRuns:= false
+	for _,aContainer:= range containers {
+		if _, isRun:= aContainer.(*runContainer); isRun{
+			hasRuns = true
+		}
+	}
+
+	//the headers, then the containers start at their offsets
+	offset:= 0
+	if hasRuns{
+		putUint32( roaringCookie | uint32( len(containers) - 1 ) << 16 )
+
+		runFlags:= make( []byte, ( len(containers) + 7 ) / 8 )
+		for i,aContainer:= range containers {
+			if _, isRun:= aContainer.(*runContainer); isRun{
+				runFlags[i/8]|= 1 << (i%8)
+			}
+		}
+		buffered.Write(runFlags)
+		offset = 4 + len(runFlags) + 4*len(containers)
+	}else{
+		putUint32(roaringCookieNoRuns)
+		putUint32( uint32( len(containers) ) )
+		offset = 8 + 4*len(containers)
+	}
+
+	for i,aContainer:= range containers {
+		writeUint16( buffered, keys[i] )
+		writeUint16( buffered, uint16( aContainer.cardinality() - 1 ) )
+	}
+
+	if !hasRuns || len(containers) >= roaringNoOffsetThreshold{
+		offset+= 4*len(containers)
+		for _,aContainer:= range containers {
+			putUint32( uint32(offset) )
+			offset+= aContainer.size()
+		}
+	}
+
+	for _,aContainer:= range containers {
+		aContainer.write(buffered)
+	}
+
+	return buffered.Flush()
+}
+
+//reads a bitmap in the portable format, reading no further than it describes.
+//every value has to be below limit.
+//
+//returns ErrCorrupt for a malformed or truncated bitmap, ErrIncompatible for
+//values from limit on and ErrTooLarge past MaxSerializedSize
+func readRoaring( reader io.Reader, limit uint64 ) ([]uint16, []roaringContainer, error) {
+	limited:= &io.LimitedReader{ R: reader, N: MaxSerializedSize }
+	fail:= func( err error ) ([]uint16, []roaringContainer, error) {
+		if limited.N == 0{
+			return nil, nil, ErrTooLarge
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF{
+			return nil, nil, ErrCorrupt
+		}
+		return nil, nil, err
+	}
+	//every read is sized by what came before, no larger than a container
+	read:= func( length int ) ([]byte, error) {
+		data:= make( []byte, length )
+		_, err:= io.ReadFull( limited, data )
+		return data, err
+	}
+
+	header, err:= read(4)
+	if err!=nil{
+		return fail(err)
+	}
+	cookie:= binary.LittleEndian.Uint32(header)
+
+	var count int
+	var runFlags []byte
+	switch{
+	case cookie & 0xFFFF == roaringCookie:
+		count = int( cookie >> 16 ) + 1
+		runFlags, err = read( (count + 7) / 8 )
+	case cookie == roaringCookieNoRuns:
+		header, err = read(4)
+		if err == nil{
+			count = int( binary.LittleEndian.Uint32(header) )
+		}
+	default:
+		return nil, nil, ErrCorrupt
+	}
+	if err!=nil{
+		return fail(err)
+	}
+	if count > 1 << 16{
+		return nil, nil, ErrCorrupt
+	}
+
+	descriptions, err:= read( 4*count )
+	if err!=nil{
+		return fail(err)
+	}
+
+	//containers follow each other, so the offsets say nothing new
+	if runFlags == nil || count >= roaringNoOffsetThreshold{
+		if _, err:= read( 4*count ); err!=nil{
+			return fail(err)
+		}
+	}
+
+	keys:= make( []uint16, count )
+	containers:= make( []roaringContainer, count )
+	for i := range containers {
+		keys[i] = binary.LittleEndian.Uint16( descriptions[4*i:] )
+		cardinality:= int( binary.LittleEndian.Uint16( descriptions[4*i + 2:] ) ) + 1
+
+		if i > 0 && keys[i] <= keys[i - 1]{
+			return nil, nil, ErrCorrupt
+		}
+
+		isRun:= runFlags != nil && runFlags[i/8] & ( 1 << (i%8) ) != 0
+		switch{
+		case isRun:
+			header, err:= read(2)
+			if err!=nil{
+				return fail(err)
+			}
+			data, err:= read( 4*int( binary.LittleEndian.Uint16(header) ) )
+			if err!=nil{
+				return fail(err)
+			}
+
+			aContainer:= &runContainer{ runs: make( []roaringRun, len(data) / 4 ) }
+			for j := range aContainer.runs {
+				start:= int( binary.LittleEndian.Uint16( data[4*j:] ) )
+				last:= start + int( binary.LittleEndian.Uint16( data[4*j + 2:] ) )
+				if last > 0xFFFF || ( j > 0 && start <= int(aContainer.runs[j - 1].last) ){
+					return nil, nil, ErrCorrupt
+				}
+
+				aContainer.runs[j] = roaringRun{ uint16(start), uint16(last) }
+				aContainer.count+= last - start + 1
+			}
+			if len(aContainer.runs) == 0 || aContainer.count != cardinality{
+				return nil, nil, ErrCorrupt
+			}
+			containers[i] = aContainer
+
+		case cardinality > roaringArrayMax:
+			data, err:= read( 8*roaringBitmapWords )
+			if err!=nil{
+				return fail(err)
+			}
+
+			aContainer:= &bitmapContainer{ words: make( []uint64, roaringBitmapWords ), count: cardinality }
+			set:= 0
+			for j := range aContainer.words {
+				aContainer.words[j] = binary.LittleEndian.Uint64( data[8*j:] )
+				set+= bits.OnesCount64( aContainer.words[j] )
+			}
+			if set != cardinality{
+				return nil, nil, ErrCorrupt
+			}
+			containers[i] = aContainer
+
+		default:
+			data, err:= read( 2*cardinality )
+			if err!=nil{
+				return fail(err)
+			}
+
+			aContainer:= &arrayContainer{ values: make( []uint16, cardinality ) }
+			for j := range aContainer.values {
+				aContainer.values[j] = binary.LittleEndian.Uint16( data[2*j:] )
+				if j > 0 && aContainer.values[j] <= aContainer.values[j - 1]{
+					return nil, nil, ErrCorrupt
+				}
+			}
+			containers[i] = aContainer
+		}
+
+		//the last chunk may run past the end of the filter
+		if last:= lastValue(containers[i]); uint64(keys[i]) << 16 + uint64(last) >= limit{
+			return nil, nil, ErrIncompatible
+		}
+	}
+
+	return keys, containers, nil
+}
+
+//the highest value in a container
+func lastValue( aContainer roaringContainer ) uint16 {
+	switch typed:= aContainer.(type){
+	case *arrayContainer:
+		return typed.values[ len(typed.values) - 1 ]
+	case *runContainer:
+		return typed.runs[ len(typed.runs) - 1 ].last
+	case *bitmapContainer:
+		for i := len(typed.words) - 1; i >= 0; i-- {
+			if typed.words[i] != 0{
+				return uint16( i*64 + 63 - bits.LeadingZeros64( typed.words[i] ) )
+			}
+		}
+	}
+
+	return 0
+}
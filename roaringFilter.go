@@ -0,0 +1,392 @@
+package bloomFilter
+
+import(
+	"bytes" //for the bitmap in serialized filters
+	"io" //for streaming bitmaps
+	"math" //for the stats' estimates
+	"slices" //for keeping containers sorted
+)
+
+//a bloom filter keeping the positions of its set buckets in Roaring containers.
+//
+//each 65536 buckets are a chunk, held by an array of set positions while they're
+//few, a bitmap once there are more than 4096 and, after RunOptimize, runs where
+//those are smaller. Chunks with nothing set take nothing. At low fill that's 2
+//bytes a set bucket, far less than the dense array, and WriteRoaring writes the
+//portable Roaring format so other Roaring libraries can read the set buckets.
+//
+//every chunk is a bitmap by around 1/16 fill, from which the dense array is
+//smaller. So once the fill reaches a chosen threshold the filter switches to
+//the dense array, see NewRoaringFilter. It hashes exactly like a BloomFilter
+//with the same constants, Dense converts it into one. Filters of up to 2^32
+//buckets fit, every filter DataDepth allows does.
+type RoaringFilter struct{
+	//the constants, IntBuckets is only set once the filter is dense
+	filter BloomFilter
+
+	//the high 16 bits of each chunk's buckets, sorted, and its container
+	keys []uint16
+	containers []roaringContainer
+
+	//buckets set while the filter isn't dense
+	set int
+
+	//the fill at which the filter goes dense, 0 for never
+	denseAt float64
+}
+
+//a Roaring filter with the constants of the given filter, built or not.
+//the contents of a built filter, on IntBuckets or a store, are copied in.
+//
+//once at least denseAt of the buckets are set the filter goes dense, as
+//Densify. 0 keeps it in containers however full it gets.
+//
+//panics if the constants fail Validate, a built filter doesn't have
+//the IntBuckets they call for or there are more than 2^32 buckets
+func NewRoaringFilter( aBloomFilter *BloomFilter, denseAt float64 ) *RoaringFilter {
+	constants:= *aBloomFilter
+	constants.IntBuckets, constants.dirty, constants.store = nil, nil, nil
+
+	//nil only for a filter that was never built
+	built:= aBloomFilter.words()
+
+	//BuildBuckets rounds Guava's bits up to whole words
+	if constants.Strategy == Murmur128Mitz64 && built == nil{
+		constants.Size = (constants.Size + 63) / 64 * 64
+	}
+
+	if constants.validateConstants()!=nil{
+		panic("a roaring filter needs the constants of a valid filter")
+	}
+	if uint64( constants.bucketCount() ) > 1 << 32{
+		panic("a roaring filter holds at most 2^32 buckets")
+	}
+	if built != nil && len(built) != constants.wordCount(){
+		panic("a built filter needs all of its IntBuckets to make a roaring one")
+	}
+
+	aFilter:= &RoaringFilter{ filter: constants, denseAt: denseAt }
+	aFilter.fromWords(built)
+	aFilter.checkDensity()
+
+	return aFilter
+}
+
+//replaces the containers with the smallest ones holding the words
+func (aFilter *RoaringFilter) fromWords( words []uint64 ) {
+	aFilter.keys, aFilter.containers, aFilter.set = nil, nil, 0
+
+	for start := 0; start < len(words); start+= roaringBitmapWords {
+		aContainer:= containerFromWords( words[ start : min( start + roaringBitmapWords, len(words) ) ] )
+		if aContainer == nil{
+			continue
+		}
+
+		aFilter.keys = append( aFilter.keys, uint16( start / roaringBitmapWords ) )
+		aFilter.containers = append( aFilter.containers, aContainer )
+		aFilter.set+= aContainer.cardinality()
+	}
+}
+
+//goes dense if the fill has reached denseAt
+func (aFilter *RoaringFilter) checkDensity() {
+	if aFilter.denseAt > 0 && float64(aFilter.set) >= aFilter.denseAt*float64( aFilter.filter.bucketCount() ){
+		aFilter.Densify()
+	}
+}
+
+//moves every container into one array of IntBuckets, as BuildBuckets
+//allocates, and drops the containers. Does nothing to a filter that's
+//already dense
+func (aFilter *RoaringFilter) Densify() {
+	if aFilter.filter.IntBuckets != nil{
+		return
+	}
+
+	aFilter.filter.IntBuckets = aFilter.words()
+	aFilter.keys, aFilter.containers, aFilter.set = nil, nil, 0
+}
+
+//the containers as IntBuckets
+func (aFilter *RoaringFilter) words() []uint64 {
+	words:= make( []uint64, aFilter.filter.wordCount() )
+	for i,aKey:= range aFilter.keys {
+		start:= int(aKey)*roaringBitmapWords
+		aFilter.containers[i].orInto( words[ start : min( start + roaringBitmapWords, len(words) ) ] )
+	}
+
+	return words
+}
+
+//whether the filter has gone dense, see Densify
+func (aFilter *RoaringFilter) IsDense() bool {
+	return aFilter.filter.IntBuckets != nil
+}
+
+//sets the given bucket to filled
+func (aFilter *RoaringFilter) Set( index int ) {
+	if aFilter.IsDense(){
+		aFilter.filter.Set(index)
+		return
+	}
+
+	key:= uint16( index >> 16 )
+	position, found:= slices.BinarySearch( aFilter.keys, key )
+	if !found{
+		aFilter.keys = slices.Insert( aFilter.keys, position, key )
+		aFilter.containers = slices.Insert( aFilter.containers, position, roaringContainer( &arrayContainer{} ) )
+	}
+
+	aContainer, added:= aFilter.containers[position].add( uint16(index) )
+	aFilter.containers[position] = aContainer
+	if added{
+		aFilter.set++
+		aFilter.checkDensity()
+	}
+}
+
+//returns whether the given bucket is filled or not
+func (aFilter *RoaringFilter) Get( index int ) bool {
+	if aFilter.IsDense(){
+		return aFilter.filter.Get(index)
+	}
+
+	position, found:= slices.BinarySearch( aFilter.keys, uint16( index >> 16 ) )
+
+	return found && aFilter.containers[position].contains( uint16(index) )
+}
+
+//takes an array of bytes and adds it to the filter, see BloomFilter.Add
+func (aFilter *RoaringFilter) Add( data []byte ) {
+	iterator:= aFilter.filter.newIterator(data)
+	for i := 0; i < aFilter.filter.HashIterations; i++ {
+		aFilter.Set( iterator.next() )
+	}
+}
+
+//takes an array of bytes and checks its membership in the filter, see BloomFilter.CheckMembership
+func (aFilter *RoaringFilter) CheckMembership( data []byte ) bool {
+	iterator:= aFilter.filter.newIterator(data)
+	for i := 0; i < aFilter.filter.HashIterations; i++ {
+		if !aFilter.Get( iterator.next() ){
+			return false
+		}
+	}
+
+	return true
+}
+
+//adds the data and reports whether it was already a member, see BloomFilter.AddIfAbsent
+func (aFilter *RoaringFilter) AddIfAbsent( data []byte ) (wasPresent bool) {
+	wasPresent = true
+
+	iterator:= aFilter.filter.newIterator(data)
+	for i := 0; i < aFilter.filter.HashIterations; i++ {
+		anIndex:= iterator.next()
+
+		if !aFilter.Get(anIndex){
+			wasPresent = false
+			aFilter.Set(anIndex)
+		}
+	}
+
+	return wasPresent
+}
+
+//converts each container to runs where that's smaller, and back where it isn't.
+//Adds only ever make arrays and bitmaps, so call this before writing a filter
+//holding long stretches of set buckets. Does nothing to a dense filter
+func (aFilter *RoaringFilter) RunOptimize() {
+	if aFilter.IsDense(){
+		return
+	}
+
+	words:= make( []uint64, roaringBitmapWords )
+	for i,aContainer:= range aFilter.containers {
+		clear(words)
+		aContainer.orInto(words)
+		aFilter.containers[i] = containerFromWords(words)
+	}
+}
+
+//a copy of the filter as a BloomFilter, with every IntBucket allocated
+func (aFilter *RoaringFilter) Dense() BloomFilter {
+	aBloomFilter:= aFilter.filter
+	if aFilter.IsDense(){
+		aBloomFilter.IntBuckets = slices.Clone( aFilter.filter.IntBuckets )
+	}else{
+		aBloomFilter.IntBuckets = aFilter.words()
+	}
+
+	return aBloomFilter
+}
+
+//how full a Roaring filter is and how its containers hold it
+type RoaringStats struct{
+	FilterStats
+
+	//containers of each kind, all 0 once the filter is dense
+	ArrayContainers int
+	BitmapContainers int
+	RunContainers int
+
+	//what the containers take in the portable format, near what they
+	//take in memory. What IntBuckets take once the filter is dense
+	Bytes int
+
+	Dense bool
+}
+
+//reports how full the filter is, as BloomFilter.Stats, along with its containers
+func (aFilter *RoaringFilter) Stats() RoaringStats {
+	stats:= RoaringStats{ Dense: aFilter.IsDense() }
+
+	if stats.Dense{
+		stats.SetBuckets = aFilter.filter.popCount()
+		stats.Bytes = 8*len(aFilter.filter.IntBuckets)
+	}
+	for _,aContainer:= range aFilter.containers {
+		switch aContainer.(type){
+		case *arrayContainer:
+			stats.ArrayContainers++
+		case *bitmapContainer:
+			stats.BitmapContainers++
+		case *runContainer:
+			stats.RunContainers++
+		}
+
+		stats.SetBuckets+= aContainer.cardinality()
+		stats.Bytes+= aContainer.size() + 8
+	}
+
+	stats.Buckets = aFilter.filter.bucketCount()
+	stats.FillRatio = float64(stats.SetBuckets) / float64(stats.Buckets)
+	stats.EstimatedFPR = math.Pow( stats.FillRatio, float64(aFilter.filter.HashIterations) )
+
+	stats.EstimatedItems = math.Inf(1)
+	if stats.SetBuckets < stats.Buckets{
+		stats.EstimatedItems = estimateFromSetBuckets( float64(stats.SetBuckets), float64(stats.Buckets),
+			float64(aFilter.filter.HashIterations) )
+	}
+
+	return stats
+}
+
+//writes the positions of the set buckets as a portable Roaring bitmap, which
+//any Roaring library can read. The filter's constants aren't written, see
+//Serialize for keeping those. A dense filter is written in the smallest
+//containers for it, as if RunOptimize had been called
+func (aFilter *RoaringFilter) WriteRoaring( writer io.Writer ) error {
+	if aFilter.IsDense(){
+		written:= &RoaringFilter{ filter: aFilter.filter }
+		written.fromWords(aFilter.filter.IntBuckets)
+		return writeRoaring( writer, written.keys, written.containers )
+	}
+
+	return writeRoaring( writer, aFilter.keys, aFilter.containers )
+}
+
+//replaces the filter's buckets with those set in a portable Roaring bitmap, as
+//written by WriteRoaring or any Roaring library. Only what the bitmap describes
+//is read, so bitmaps can follow each other in one stream.
+//
+//nothing changes unless the whole bitmap is read. Returns ErrCorrupt for a
+//malformed or truncated bitmap, ErrIncompatible for one with buckets past the
+//filter's and ErrTooLarge past MaxSerializedSize. The filter goes dense if
+//the bitmap fills it past its threshold
+func (aFilter *RoaringFilter) ReadRoaring( reader io.Reader ) error {
+	keys, containers, err:= readRoaring( reader, uint64( aFilter.filter.bucketCount() ) )
+	if err!=nil{
+		return err
+	}
+
+	aFilter.keys, aFilter.containers, aFilter.set = keys, containers, 0
+	for _,aContainer:= range containers {
+		aFilter.set+= aContainer.cardinality()
+	}
+
+	if aFilter.IsDense(){
+		aFilter.filter.IntBuckets = aFilter.words()
+		aFilter.keys, aFilter.containers, aFilter.set = nil, nil, 0
+		return nil
+	}
+	aFilter.checkDensity()
+
+	return nil
+}
+
+//what a Roaring filter is serialized as: its constants, with no IntBuckets,
+//and its set buckets as a portable Roaring bitmap
+type roaringFilterFile struct{
+	Filter BloomFilter
+	DenseAt float64
+	Bitmap []byte
+}
+
+//serializes the filter's constants and its buckets in the portable Roaring
+//format, see BloomFilter.Serialize and WriteRoaring
+func (aFilter *RoaringFilter) Serialize( fileName string, compress bool ) error {
+	file:= roaringFilterFile{ Filter: aFilter.filter, DenseAt: aFilter.denseAt }
+	file.Filter.IntBuckets = nil
+
+	var bitmap bytes.Buffer
+	err:= aFilter.WriteRoaring(&bitmap)
+	if err!=nil{
+		return err
+	}
+	file.Bitmap = bitmap.Bytes()
+
+	return writeSerialized( fileName, file, compress )
+}
+
+//attempts to deserialize a Roaring filter, the counterpart to RoaringFilter.Serialize.
+//like RetrieveFilter the file is treated as untrusted
+func RetrieveRoaringFilter( fileName string, compressed bool ) (*RoaringFilter, error) {
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return nil, err
+	}
+
+	return parseRoaringFilter( data, compressed )
+}
+
+//the parsing half of RetrieveRoaringFilter. The constants have to pass Validate
+//and the bitmap has to be whole, with nothing after it
+func parseRoaringFilter( data []byte, compressed bool ) (*RoaringFilter, error) {
+	var file roaringFilterFile
+
+	err:= decodeSerialized( data, compressed, &file )
+	if err!=nil{
+		return nil, err
+	}
+
+	if file.Filter.IntBuckets != nil || math.IsNaN(file.DenseAt){
+		return nil, ErrCorrupt
+	}
+	err = file.Filter.validateConstants()
+	if err!=nil{
+		return nil, err
+	}
+	if uint64( file.Filter.bucketCount() ) > 1 << 32{
+		return nil, ErrCorrupt
+	}
+
+	//a dense filter from a small file could otherwise fill memory,
+	//so it can be no larger than a file holding it dense could be
+	if file.DenseAt > 0 && int64( file.Filter.wordCount() ) > MaxSerializedSize / 8{
+		return nil, ErrTooLarge
+	}
+
+	aFilter:= NewRoaringFilter( &file.Filter, file.DenseAt )
+
+	reader:= bytes.NewReader(file.Bitmap)
+	err = aFilter.ReadRoaring(reader)
+	if err!=nil{
+		return nil, err
+	}
+	if reader.Len() != 0{
+		return nil, ErrCorrupt
+	}
+
+	return aFilter, nil
+}
@@ -0,0 +1,171 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"path/filepath"
+	"slices"
+
+)
+
+//a DataDepth 4 filter holding few items takes a couple of bytes a bucket
+func TestRoaringFilter(t *testing.T) {
+	randomKeys:= testKeys()
+	aFilter:= NewRoaringFilter( &BloomFilter{HashIterations: 4, DataDepth: 4}, 0 )
+
+	keys:= deltaKeys( randomKeys, 10000 )
+	for i,aKey:= range keys {
+		if aFilter.AddIfAbsent(aKey){
+			t.Fatal("Roaring filter claimed a new item was present", i)
+		}
+	}
+	for i,aKey:= range keys {
+		if !aFilter.CheckMembership(aKey){
+			t.Fatal("Roaring filter lost an item", i)
+		}
+	}
+
+	stats:= aFilter.Stats()
+	if stats.Dense || stats.BitmapContainers != 0 || stats.ArrayContainers > 1 << 16{
+		t.Fatal("Roaring filter has the wrong containers", stats)
+	}
+	if stats.Bytes > 3*stats.SetBuckets + 8*stats.ArrayContainers{
+		t.Error("Roaring filter takes too much", stats.Bytes, stats.SetBuckets)
+	}
+	if stats.SetBuckets > 4*len(keys) || stats.EstimatedItems < 9500 || stats.EstimatedItems > 10500{
+		t.Error("Roaring stats are off", stats.FilterStats)
+	}
+
+	allocations:= testing.AllocsPerRun( 100, func() {
+		aFilter.CheckMembership( keys[0] )
+	})
+	if allocations != 0{
+		t.Error("Checking an item allocated", allocations)
+	}
+}
+
+//a Roaring filter sets exactly the buckets a dense one does, dense or not
+func TestRoaringMatchesDense(t *testing.T) {
+	randomKeys:= testKeys()
+
+	for _,denseAt:= range []float64{ 0, 0.001 } {
+		dense:= BloomFilter{HashIterations: 3, DataDepth: 3, Seed: 7}
+		dense.BuildBuckets()
+		aFilter:= NewRoaringFilter( &BloomFilter{HashIterations: 3, DataDepth: 3, Seed: 7}, denseAt )
+
+		for _,aKey:= range deltaKeys( randomKeys, 20000 ) {
+			dense.Add(aKey)
+			aFilter.Add(aKey)
+		}
+
+		stats:= aFilter.Stats()
+		if stats.Dense != ( denseAt > 0 ){
+			t.Error("Roaring filter went dense at the wrong time", denseAt, stats)
+		}
+		if converted:= aFilter.Dense(); !slices.Equal( converted.IntBuckets, dense.IntBuckets ){
+			t.Error("Roaring filter set other buckets than a dense one", denseAt)
+		}
+		if stats.SetBuckets != dense.popCount(){
+			t.Error("Roaring filter counted its buckets wrongly", stats.SetBuckets, dense.popCount())
+		}
+	}
+
+	//a built filter's contents carry over, in any strategy
+	redis:= BloomFilter{HashIterations: 5, Strategy: RedisMurmur64A, Size: 100001}
+	redis.BuildBuckets()
+	keys:= deltaKeys( randomKeys, 50 )
+	for _,aKey:= range keys {
+		redis.Add(aKey)
+	}
+
+	aFilter:= NewRoaringFilter( &redis, 0 )
+	for i,aKey:= range keys {
+		if !aFilter.CheckMembership(aKey){
+			t.Fatal("Roaring copy of a filter lost an item", i)
+		}
+	}
+	if converted:= aFilter.Dense(); !slices.Equal( converted.IntBuckets, redis.IntBuckets ){
+		t.Error("Roaring copy of a filter converted back wrongly")
+	}
+
+	//so do the contents of one built on a store
+	stored:= BloomFilter{HashIterations: 5, Strategy: RedisMurmur64A, Size: 100001}
+	stored.BuildOn( NewHeapStore(100001) )
+	for _,aKey:= range keys {
+		stored.Add(aKey)
+	}
+	if converted:= NewRoaringFilter( &stored, 0 ).Dense(); !slices.Equal( converted.IntBuckets, redis.IntBuckets ) || converted.Store() != nil{
+		t.Error("Roaring copy of a filter on a store converted wrongly")
+	}
+
+	defer func() {
+		if recover() == nil{
+			t.Error("A roaring filter was made with more than 2^32 buckets")
+		}
+	}()
+	NewRoaringFilter( &BloomFilter{HashIterations: 4, Strategy: RedisMurmur64A, Size: 1 << 33}, 0 )
+}
+
+func TestRoaringSerialize(t *testing.T) {
+	randomKeys:= testKeys()
+	keys:= deltaKeys( randomKeys, 3000 )
+
+	for _,denseAt:= range []float64{ 0, 0.0001 } {
+		aFilter:= NewRoaringFilter( &BloomFilter{HashIterations: 4, DataDepth: 3}, denseAt )
+		for _,aKey:= range keys {
+			aFilter.Add(aKey)
+		}
+
+		fileName:= filepath.Join( t.TempDir(), "roaringFilter.json" )
+		if err:= aFilter.Serialize( fileName, true ); err!=nil{
+			t.Fatal("Failed to serialize the roaring filter!", err)
+		}
+
+		retrieved, err:= RetrieveRoaringFilter( fileName, true )
+		if err!=nil{
+			t.Fatal("Failed to deserialize the roaring filter!", err)
+		}
+		if retrieved.Stats() != aFilter.Stats(){
+			t.Fatal("Retrieved roaring filter differs", retrieved.Stats(), aFilter.Stats())
+		}
+		for i,aKey:= range keys {
+			if !retrieved.CheckMembership(aKey){
+				t.Fatal("Retrieved roaring filter lost an item", i)
+			}
+		}
+	}
+}
+
+//anything parseRoaringFilter accepts has to be usable without panicking
+func FuzzParseRoaringFilter(f *testing.F) {
+	seed:= NewRoaringFilter( &BloomFilter{HashIterations: 3, DataDepth: 1}, 0 )
+	seed.Add( []byte("seed") )
+	addSerializedSeeds( f, seed.Serialize )
+
+	f.Add( []byte(`{"Filter":{"HashIterations":3,"DataDepth":2},"DenseAt":0.5,"Bitmap":"OzAAAAEAAAkAAQABAAkA"}`), false )
+
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+	MaxSerializedSize = 1 << 16
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseRoaringFilter( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add(data)
+		if !aFilter.CheckMembership(data){
+			t.Fatal("Parsed roaring filter lost an item")
+		}
+		aFilter.RunOptimize()
+		stats:= aFilter.Stats()
+		if stats.Buckets > 1 << 24{
+			return
+		}
+
+		dense:= aFilter.Dense()
+		if dense.Validate()!=nil || !dense.CheckMembership(data) || dense.popCount() != stats.SetBuckets{
+			t.Fatal("Parsed roaring filter converted wrongly")
+		}
+	})
+}
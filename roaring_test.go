@@ -0,0 +1,165 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bytes"
+	"encoding/hex"
+
+)
+
+func roaringSet( values ...int ) *RoaringFilter {
+	aFilter:= NewRoaringFilter( &BloomFilter{HashIterations: 1, DataDepth: 3}, 0 )
+	for _,aValue:= range values {
+		aFilter.Set(aValue)
+	}
+
+	return aFilter
+}
+
+func writtenRoaring( t *testing.T, aFilter *RoaringFilter ) []byte {
+	var written bytes.Buffer
+	if err:= aFilter.WriteRoaring(&written); err!=nil{
+		t.Fatal("Failed to write a bitmap", err)
+	}
+
+	return written.Bytes()
+}
+
+//bitmaps laid out by hand from the format specification
+func TestRoaringFormat(t *testing.T) {
+	cases:= []struct{
+		name string
+		aFilter *RoaringFilter
+		expected string
+	}{
+		//cookie, count, keys and cardinalities less one, offsets, then two arrays
+		{"arrays", roaringSet( 1, 2, 3, 2 << 16 | 5 ),
+			"3a300000" + "02000000" + "00000200" + "02000000" + "18000000" + "1e000000" +
+			"010002000300" + "0500"},
+
+		//cookie with the count less one, the run flags and no offsets for so few containers
+		{"runs", roaringSet( 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 2 << 16 | 5 ),
+			"3b300100" + "01" + "00000900" + "02000000" +
+			"0100" + "01000900" + "0500"},
+	}
+
+	for _,aCase:= range cases {
+		aCase.aFilter.RunOptimize()
+
+		written:= writtenRoaring( t, aCase.aFilter )
+		if hex.EncodeToString(written) != aCase.expected{
+			t.Error("Bitmap was written wrongly", aCase.name, hex.EncodeToString(written))
+		}
+
+		//and read back the same, whatever the filter held before
+		read:= roaringSet( 77 )
+		if err:= read.ReadRoaring( bytes.NewReader(written) ); err!=nil{
+			t.Fatal("Failed to read a bitmap", aCase.name, err)
+		}
+		if read.Get(77) || !read.Get(1) || !read.Get( 2 << 16 | 5 ) || read.Stats() != aCase.aFilter.Stats(){
+			t.Error("Bitmap was read wrongly", aCase.name, read.Stats())
+		}
+	}
+}
+
+//the data set of the format specification's test files, in every container
+func TestRoaringContainers(t *testing.T) {
+	var values []int
+	for k := 0; k < 100000; k+= 1000 {
+		values = append( values, k )
+	}
+	for k := 100000; k < 200000; k++ {
+		values = append( values, 3*k )
+	}
+	for k := 700000; k < 800000; k++ {
+		values = append( values, k )
+	}
+	aFilter:= roaringSet( values... )
+
+	//a filter only ever adds arrays and bitmaps
+	stats:= aFilter.Stats()
+	if stats.SetBuckets != len(values) || stats.RunContainers != 0 || stats.ArrayContainers == 0 || stats.BitmapContainers == 0{
+		t.Fatal("Containers were built wrongly", stats)
+	}
+
+	for _,optimize:= range []bool{ false, true } {
+		if optimize{
+			aFilter.RunOptimize()
+			if optimized:= aFilter.Stats(); optimized.RunContainers != 3 || optimized.Bytes >= stats.Bytes{
+				t.Fatal("Runs weren't used where they're smaller", optimized)
+			}
+		}
+
+		read:= roaringSet()
+		if err:= read.ReadRoaring( bytes.NewReader( writtenRoaring( t, aFilter ) ) ); err!=nil{
+			t.Fatal("Failed to read a bitmap", err)
+		}
+		for _,aValue:= range values {
+			if !read.Get(aValue){
+				t.Fatal("Bitmap lost a value", aValue)
+			}
+		}
+		if read.Stats() != aFilter.Stats(){
+			t.Error("Bitmap came back differently", read.Stats(), aFilter.Stats())
+		}
+	}
+
+	//adding inside, between and beside runs keeps them disjoint
+	for _,aValue:= range []int{ 750000, 699999, 800000, 800002, 800001, 65535 << 4 } {
+		aFilter.Set(aValue)
+		values = append( values, aValue )
+	}
+	if aFilter.Stats().SetBuckets != len(values) - 1{
+		t.Error("Adding to runs counted wrongly", aFilter.Stats().SetBuckets)
+	}
+	for _,aValue:= range values {
+		if !aFilter.Get(aValue){
+			t.Fatal("Adding to runs lost a value", aValue)
+		}
+	}
+	if aFilter.Get(800003) || aFilter.Get(699998){
+		t.Error("Adding to runs set too much")
+	}
+}
+
+func TestRoaringMalformed(t *testing.T) {
+	valid:= writtenRoaring( t, roaringSet( 1, 2, 3, 2 << 16 | 5 ) )
+
+	//every truncation is refused
+	for length := range valid {
+		if err:= roaringSet().ReadRoaring( bytes.NewReader( valid[:length] ) ); err != ErrCorrupt{
+			t.Fatal("Read a truncated bitmap", length, err)
+		}
+	}
+
+	cases:= []struct{
+		name, bitmap string
+		expected error
+	}{
+		{"cookie", "3c300000" + "00000000", ErrCorrupt},
+		{"unsorted keys", "3a300000" + "02000000" + "02000000" + "00000000" + "00000000" + "00000000" + "0100" + "0100", ErrCorrupt},
+		{"unsorted values", "3a300000" + "01000000" + "00000100" + "00000000" + "02000100", ErrCorrupt},
+		{"runs overlap", "3b300000" + "01" + "00000500" + "0200" + "01000200" + "03000100", ErrCorrupt},
+		{"runs cardinality", "3b300000" + "01" + "00000900" + "0100" + "01000200", ErrCorrupt},
+		{"run wraps", "3b300000" + "01" + "00000100" + "0100" + "ffff0100", ErrCorrupt},
+		{"past the filter", "3a300000" + "01000000" + "00010000" + "00000000" + "0100", ErrIncompatible},
+	}
+
+	for _,aCase:= range cases {
+		bitmap, _:= hex.DecodeString(aCase.bitmap)
+		aFilter:= roaringSet(5)
+		if err:= aFilter.ReadRoaring( bytes.NewReader(bitmap) ); err != aCase.expected{
+			t.Error("Malformed bitmap wasn't refused", aCase.name, err)
+		}
+		if !aFilter.Get(5){
+			t.Error("A refused bitmap changed the filter", aCase.name)
+		}
+	}
+
+	//a bitmap container's popcount must match its cardinality
+	bitmap:= append( []byte{ 0x3a, 0x30, 0, 0, 1, 0, 0, 0, 0, 0, 0xff, 0x10, 0, 0, 0, 0 }, make( []byte, 8192 )... )
+	if err:= roaringSet().ReadRoaring( bytes.NewReader(bitmap) ); err != ErrCorrupt{
+		t.Error("Read a bitmap container with the wrong cardinality", err)
+	}
+}
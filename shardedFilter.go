@@ -0,0 +1,227 @@
+package bloomFilter
+
+import(
+	"errors" //for rejecting malformed sharded files
+	"sync" //for the per shard locks
+)
+
+//returned when a sharded filter has a shard count that isn't a power
+//of two up to 256, or shards that don't share the same constants.
+//shards always use SHA256Chain as routing takes the last byte of the first hash
+var ErrBadShards = errors.New("bloomFilter: shards must be a power of two up to 256 and share their constants")
+
+//a single shard, padded so neighbouring shards' locks
+//don't share a cache line
+type filterShard struct{
+	lock sync.RWMutex
+	filter BloomFilter
+
+	_ [64]byte
+}
+
+//a filter split into independent BloomFilter shards for write throughput.
+//
+//many writers on one ConcurrentFilter all bounce the same cache lines of a
+//single giant IntBuckets between cores. Here the last byte of each item's first
+//hash picks one of the shards and the item lives entirely inside it, so writers
+//mostly work on different shards under different locks.
+//
+//the last byte rather than the leading one, as the leading bytes of the hash are
+//the item's first index. Routing on them would give every item in a shard the same
+//low bits there, so first indices would only land in 1/shardCount of its buckets.
+//
+//the first hash is also the first link of the index chain so routing
+//doesn't cost any extra hashing.
+type ShardedFilter struct{
+	shards []filterShard
+}
+
+//builds a sharded filter. Every shard is a built BloomFilter with the given constants,
+//so the total memory is shardCount times that of one of them.
+//
+//shardCount has to be a power of two no larger than 256
+func NewShardedFilter( shardCount, hashIterations, dataDepth int ) (*ShardedFilter, error) {
+	return NewSeededShardedFilter( shardCount, hashIterations, dataDepth, 0 )
+}
+
+//builds a sharded filter whose shards all have the given Seed, see BloomFilter.Seed.
+//the seed picks the shard an item goes to as well as its buckets
+func NewSeededShardedFilter( shardCount, hashIterations, dataDepth int, seed uint64 ) (*ShardedFilter, error) {
+	if shardCount < 1 || shardCount > 256 || shardCount & (shardCount-1) != 0{
+		return nil, ErrBadShards
+	}
+
+	aFilter:= &ShardedFilter{ shards: make( []filterShard, shardCount ) }
+	for i := range aFilter.shards {
+		aFilter.shards[i].filter = BloomFilter{ HashIterations: hashIterations, DataDepth: dataDepth, Seed: seed }
+		aFilter.shards[i].filter.BuildBuckets()
+	}
+
+	return aFilter, nil
+}
+
+//the amount of shards
+func (aFilter *ShardedFilter) ShardCount() int {
+	return len(aFilter.shards)
+}
+
+//hashes the first link of the data's chain and picks its shard.
+//returns the shard, the iterator to carry on with and the first index
+func (aFilter *ShardedFilter) route( data []byte ) (*filterShard, indexIterator, int) {
+	//all shards share their constants so any one can set up the iterator
+	iterator:= aFilter.shards[0].filter.newIterator(data)
+	firstIndex:= iterator.next()
+
+	//the last byte is never part of the first index, which is read from the front
+	shard:= &aFilter.shards[ int(iterator.sum[len(iterator.sum)-1]) & (len(aFilter.shards)-1) ]
+
+	return shard, iterator, firstIndex
+}
+
+//takes an array of bytes and adds it to its shard
+func (aFilter *ShardedFilter) Add( data []byte ) {
+	shard, iterator, anIndex:= aFilter.route(data)
+
+	shard.lock.Lock()
+	for i := 0; i < shard.filter.HashIterations; i++ {
+		if i > 0{
+			anIndex = iterator.next()
+		}
+		shard.filter.Set(anIndex)
+	}
+	shard.lock.Unlock()
+}
+
+//takes an array of bytes and checks its membership in its shard
+func (aFilter *ShardedFilter) CheckMembership( data []byte ) bool {
+	shard, iterator, anIndex:= aFilter.route(data)
+
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+
+	for i := 0; i < shard.filter.HashIterations; i++ {
+		if i > 0{
+			anIndex = iterator.next()
+		}
+		if !shard.filter.Get(anIndex){
+			return false
+		}
+	}
+
+	return true
+}
+
+//adds the data and reports whether it was already a member.
+//the shard's lock is held throughout so exactly one of several
+//concurrent callers with the same data sees it as absent
+func (aFilter *ShardedFilter) AddIfAbsent( data []byte ) (wasPresent bool) {
+	shard, iterator, anIndex:= aFilter.route(data)
+
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	wasPresent = true
+	for i := 0; i < shard.filter.HashIterations; i++ {
+		if i > 0{
+			anIndex = iterator.next()
+		}
+		if !shard.filter.Get(anIndex){
+			wasPresent = false
+			shard.filter.Set(anIndex)
+		}
+	}
+
+	return wasPresent
+}
+
+//combined stats of every shard.
+//
+//each lookup only ever touches one shard so the false positive
+//rate is the average of the shards' rates
+func (aFilter *ShardedFilter) Stats() FilterStats {
+	var stats FilterStats
+
+	for i := range aFilter.shards {
+		shard:= &aFilter.shards[i]
+
+		shard.lock.RLock()
+		shardStats:= shard.filter.Stats()
+		shard.lock.RUnlock()
+
+		stats.Buckets+= shardStats.Buckets
+		stats.SetBuckets+= shardStats.SetBuckets
+		stats.EstimatedItems+= shardStats.EstimatedItems
+		stats.EstimatedFPR+= shardStats.EstimatedFPR / float64( len(aFilter.shards) )
+	}
+
+	stats.FillRatio = float64(stats.SetBuckets) / float64(stats.Buckets)
+
+	return stats
+}
+
+//what a sharded filter is serialized as
+type shardedFilterFile struct{
+	Shards []BloomFilter
+}
+
+//serializes every shard into a single file, see BloomFilter.Serialize.
+//each shard is locked in turn while it is copied out
+func (aFilter *ShardedFilter) Serialize( fileName string, compress bool ) error {
+	file:= shardedFilterFile{ Shards: make( []BloomFilter, len(aFilter.shards) ) }
+
+	for i := range aFilter.shards {
+		shard:= &aFilter.shards[i]
+
+		shard.lock.RLock()
+		file.Shards[i] = shard.filter
+		file.Shards[i].IntBuckets = append( []uint64(nil), shard.filter.IntBuckets... )
+		shard.lock.RUnlock()
+	}
+
+	return writeSerialized( fileName, file, compress )
+}
+
+//attempts to deserialize a sharded filter.
+//the counterpart to ShardedFilter.Serialize
+func RetrieveShardedFilter( fileName string, compressed bool ) (*ShardedFilter, error) {
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return nil, err
+	}
+
+	return parseShardedFilter( data, compressed )
+}
+
+//the parsing half of RetrieveShardedFilter.
+//every shard has to pass BloomFilter.Validate as well as share its constants
+func parseShardedFilter( data []byte, compressed bool ) (*ShardedFilter, error) {
+	var file shardedFilterFile
+
+	err:= decodeSerialized( data, compressed, &file )
+	if err!=nil{
+		return nil, err
+	}
+
+	shardCount:= len(file.Shards)
+	if shardCount < 1 || shardCount > 256 || shardCount & (shardCount-1) != 0{
+		return nil, ErrBadShards
+	}
+
+	aFilter:= &ShardedFilter{ shards: make( []filterShard, shardCount ) }
+	for i := range file.Shards {
+		first, shard:= file.Shards[0], file.Shards[i]
+		if shard.HashIterations != first.HashIterations || shard.DataDepth != first.DataDepth ||
+			shard.Folds != first.Folds || shard.Seed != first.Seed || shard.Strategy != SHA256Chain{
+			return nil, ErrBadShards
+		}
+
+		err = shard.Validate()
+		if err!=nil{
+			return nil, err
+		}
+
+		aFilter.shards[i].filter = shard
+	}
+
+	return aFilter, nil
+}
@@ -0,0 +1,169 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"fmt"
+	"path/filepath"
+	"sync"
+
+)
+
+func TestShardedFilter(t *testing.T) {
+	randomKeys:= testKeys()
+	if _, err:= NewShardedFilter( 3, standardHash, 2 ); err != ErrBadShards{
+		t.Error("A shard count that isn't a power of two was accepted")
+	}
+
+	workingFilter, err:= NewShardedFilter( 8, standardHash, 2 )
+	if err!=nil{
+		t.Fatal("Failed to build the sharded filter", err)
+	}
+
+	testBytes:= make([][]byte, 4000)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+	}
+
+	var wg sync.WaitGroup
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func( worker int ) {
+			defer wg.Done()
+			for i := worker; i < len(testBytes); i+= 4 {
+				workingFilter.Add(testBytes[i])
+			}
+		}( worker )
+	}
+	wg.Wait()
+
+	for i := range testBytes {
+		if !workingFilter.CheckMembership(testBytes[i]){
+			t.Fatal("Sharded filter lost an item", i)
+		}
+		if !workingFilter.AddIfAbsent(testBytes[i]){
+			t.Fatal("Sharded AddIfAbsent reported an added item as absent", i)
+		}
+	}
+
+	//every shard should have taken a share
+	for i := range workingFilter.shards {
+		if workingFilter.shards[i].filter.popCount() == 0{
+			t.Error("Shard received no items", i)
+		}
+	}
+
+	stats:= workingFilter.Stats()
+	if stats.Buckets != 8*65536 || stats.EstimatedItems < 3600 || stats.EstimatedItems > 4400{
+		t.Error("Sharded stats are off", stats)
+	}
+
+	fileName:= filepath.Join( t.TempDir(), "shardedFilter.json" )
+	err= workingFilter.Serialize( fileName, true )
+	if err!=nil{
+		t.Fatal("Failed to serialize the sharded filter!", err)
+	}
+
+	retrieved, err:= RetrieveShardedFilter( fileName, true )
+	if err!=nil{
+		t.Fatal("Failed to deserialize the sharded filter!", err)
+	}
+	if retrieved.ShardCount() != 8{
+		t.Fatal("Retrieved filter has the wrong amount of shards", retrieved.ShardCount())
+	}
+	for i := range testBytes {
+		if !retrieved.CheckMembership(testBytes[i]){
+			t.Fatal("Retrieved sharded filter lost an item", i)
+		}
+	}
+}
+
+//anything parseShardedFilter accepts has to be usable without panicking
+func FuzzParseShardedFilter(f *testing.F) {
+	seed, _:= NewShardedFilter( 2, 3, 1 )
+	seed.Add( []byte("seed") )
+	addSerializedSeeds( f, seed.Serialize )
+
+	f.Add( []byte(`{"Shards":[{"HashIterations":3,"DataDepth":1,"IntBuckets":[0,0,0,0]},{"HashIterations":3,"DataDepth":2,"IntBuckets":[]}]}`), false )
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseShardedFilter( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add(data)
+		if !aFilter.CheckMembership(data){
+			t.Fatal("Parsed sharded filter lost an item")
+		}
+		aFilter.AddIfAbsent( []byte("another") )
+		aFilter.Stats()
+	})
+}
+
+//adds from 1 to 64 goroutines at once to a sharded filter
+//and, for comparison, a single ConcurrentFilter
+func BenchmarkShardedAdd(b *testing.B) {
+	randomKeys:= testKeys()
+	keys:= make([][]byte, 4096)
+	for i := range keys {
+		keys[i] = randomKeys.Key(16)
+	}
+
+	for _,goroutines:= range []int{ 1, 2, 4, 8, 16, 32, 64 } {
+		sharded, _:= NewShardedFilter( 64, standardHash, 3 )
+		b.Run( fmt.Sprintf( "sharded-%d", goroutines ), func( b *testing.B ) {
+			benchmarkGoroutines( b, goroutines, keys, sharded.Add )
+		})
+
+		single:= BloomFilter{HashIterations: standardHash, DataDepth:3}
+		single.BuildBuckets()
+		concurrent:= NewConcurrentFilter(&single)
+		b.Run( fmt.Sprintf( "concurrent-%d", goroutines ), func( b *testing.B ) {
+			benchmarkGoroutines( b, goroutines, keys, concurrent.Add )
+		})
+	}
+}
+
+//splits b.N calls of operation over the given amount of goroutines
+func benchmarkGoroutines( b *testing.B, goroutines int, keys [][]byte, operation func( []byte ) ) {
+	var wg sync.WaitGroup
+	perGoroutine:= b.N / goroutines + 1
+
+	b.ResetTimer()
+
+	for worker := 0; worker < goroutines; worker++ {
+		wg.Add(1)
+		go func( worker int ) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				operation( keys[ (worker*perGoroutine + i) % len(keys) ] )
+			}
+		}( worker )
+	}
+	wg.Wait()
+}
+
+//routing mustn't correlate with the first index, otherwise each shard's first
+//indices would share their low bits and crowd into part of its buckets
+func TestShardedRoutingSpreadsFirstIndex(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter, err:= NewShardedFilter( 8, standardHash, 2 )
+	if err!=nil{
+		t.Fatal("Failed to build the sharded filter", err)
+	}
+
+	var residues [8]bool
+	for i := 0; i < 2000; i++ {
+		shard, _, firstIndex:= workingFilter.route( randomKeys.Key(8) )
+		if shard == &workingFilter.shards[0]{
+			residues[ firstIndex % 8 ] = true
+		}
+	}
+
+	for i := range residues {
+		if !residues[i]{
+			t.Error("No first index in shard 0 had these low bits", i)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package bloomFilter
+
+import(
+	"errors" //for refusing to estimate from a full filter
+	"math" //for the estimators
+	"math/bits" //for counting set buckets
+)
+
+//returned when a filter, or the union of two, has every bucket set.
+//there is no information left to estimate a cardinality from
+var ErrSaturated = errors.New("bloomFilter: every bucket is set, cardinality can't be estimated")
+
+//the estimated relationship between the sets behind two filters.
+//
+//every cardinality is estimated from bucket popcounts alone so the
+//original items are not needed
+type Comparison struct{
+	//estimated items in each filter
+	This float64
+	Other float64
+
+	//estimated items in either and in both filters
+	Union float64
+	Intersection float64
+
+	//estimated items in one filter but not the other
+	OnlyThis float64
+	OnlyOther float64
+
+	//Intersection / Union
+	Jaccard float64
+
+	//a rough 95% confidence interval for Jaccard
+	JaccardLow float64
+	JaccardHigh float64
+}
+
+//whether two filters hash the same way into the same amount of buckets,
+//so their buckets can be compared or combined one for one
+func (aBloomFilter *BloomFilter) sameConstants( other *BloomFilter ) bool {
+	return aBloomFilter.HashIterations == other.HashIterations && aBloomFilter.DataDepth == other.DataDepth &&
+		aBloomFilter.Folds == other.Folds && aBloomFilter.Seed == other.Seed &&
+		aBloomFilter.Strategy == other.Strategy && aBloomFilter.Size == other.Size &&
+		aBloomFilter.heldWords() == other.heldWords()
+}
+
+//estimates how many items were added to the filter from how many buckets are set.
+//
+//	n = -(m/k) * ln(1 - set/m)
+func (aBloomFilter *BloomFilter) EstimateCardinality() (float64, error) {
+	buckets:= aBloomFilter.bucketCount()
+	setBuckets:= aBloomFilter.popCount()
+
+	if setBuckets >= buckets{
+		return 0, ErrSaturated
+	}
+
+	return estimateFromSetBuckets( float64(setBuckets), float64(buckets),
+		float64(aBloomFilter.HashIterations) ), nil
+}
+
+//compares this filter with another built with the same constants.
+//
+//the union comes straight from the popcount of OR'd buckets. The intersection
+//uses the popcounts of both filters along with that of the AND'd buckets,
+//as described by Papapetrou, Siberski and Nejdl in 'Cardinality estimation
+//and dynamic length adaptation for Bloom filters'. Differences are the
+//size of each side less the intersection.
+func (aBloomFilter *BloomFilter) Compare( other *BloomFilter ) (Comparison, error) {
+
+	var result Comparison
+
+	if !aBloomFilter.sameConstants(other){
+		return result, ErrIncompatible
+	}
+
+	var thisSet, otherSet, orSet, andSet int
+	otherWords:= other.words()
+	for i,anInt:= range aBloomFilter.words(){
+		otherInt:= otherWords[i]
+
+		thisSet+= bits.OnesCount64(anInt)
+		otherSet+= bits.OnesCount64(otherInt)
+		orSet+= bits.OnesCount64(anInt | otherInt)
+		andSet+= bits.OnesCount64(anInt & otherInt)
+	}
+
+	buckets:= float64( aBloomFilter.bucketCount() )
+	hashIterations:= float64( aBloomFilter.HashIterations )
+
+	//the union saturating means both sides have too
+	if float64(orSet) >= buckets{
+		return result, ErrSaturated
+	}
+
+	result.This = estimateFromSetBuckets( float64(thisSet), buckets, hashIterations )
+	result.Other = estimateFromSetBuckets( float64(otherSet), buckets, hashIterations )
+	result.Union = estimateFromSetBuckets( float64(orSet), buckets, hashIterations )
+
+	//buckets set in both filters more often than chance would have it
+	//come from shared items
+	shared:= ( float64(andSet)*buckets - float64(thisSet)*float64(otherSet) ) / ( buckets - float64(orSet) )
+	if shared > 0{
+		result.Intersection = ( math.Log( buckets - shared ) - math.Log( buckets ) ) /
+			( hashIterations * math.Log( 1 - 1/buckets ) )
+	}
+
+	//estimates are noisy, keep them consistent with each other
+	result.Intersection = math.Min( result.Intersection, math.Min( result.This, result.Other ) )
+	result.OnlyThis = math.Max( result.This - result.Intersection, 0 )
+	result.OnlyOther = math.Max( result.Other - result.Intersection, 0 )
+
+	if result.Union == 0{
+		//two empty sets are the same set
+		result.Jaccard, result.JaccardLow, result.JaccardHigh = 1, 1, 1
+		return result, nil
+	}
+
+	result.Jaccard = math.Min( result.Intersection / result.Union, 1 )
+
+	//the delta method for the ratio. The intersection is derived from all three
+	//popcounts so its variance is taken as the sum of theirs, which overstates
+	//it somewhat as they are correlated.
+	unionVariance:= estimateVariance( result.Union, buckets, hashIterations )
+	intersectionVariance:= estimateVariance( result.This, buckets, hashIterations ) +
+		estimateVariance( result.Other, buckets, hashIterations ) + unionVariance
+
+	deviation:= math.Sqrt( intersectionVariance + result.Jaccard*result.Jaccard*unionVariance ) / result.Union
+
+	result.JaccardLow = math.Max( result.Jaccard - 1.96*deviation, 0 )
+	result.JaccardHigh = math.Min( result.Jaccard + 1.96*deviation, 1 )
+
+	return result, nil
+}
+
+//estimates the items in either filter, see Compare
+func (aBloomFilter *BloomFilter) EstimateUnion( other *BloomFilter ) (float64, error) {
+	result, err:= aBloomFilter.Compare(other)
+	return result.Union, err
+}
+
+//estimates the items in both filters, see Compare
+func (aBloomFilter *BloomFilter) EstimateIntersection( other *BloomFilter ) (float64, error) {
+	result, err:= aBloomFilter.Compare(other)
+	return result.Intersection, err
+}
+
+//estimates the items in this filter but not the other, see Compare
+func (aBloomFilter *BloomFilter) EstimateDifference( other *BloomFilter ) (float64, error) {
+	result, err:= aBloomFilter.Compare(other)
+	return result.OnlyThis, err
+}
+
+//estimates the Jaccard similarity of the two filters' sets along
+//with a rough 95% confidence interval, see Compare
+func (aBloomFilter *BloomFilter) Jaccard( other *BloomFilter ) (estimate, low, high float64, err error) {
+	result, err:= aBloomFilter.Compare(other)
+	return result.Jaccard, result.JaccardLow, result.JaccardHigh, err
+}
+
+//the cardinality estimate for a given amount of set buckets
+func estimateFromSetBuckets( setBuckets, buckets, hashIterations float64 ) float64 {
+	return -buckets / hashIterations * math.Log( 1 - setBuckets/buckets )
+}
+
+//the variance of estimateFromSetBuckets at the given cardinality
+//
+//	m * (e^(kn/m) - 1 - kn/m) / k^2
+func estimateVariance( cardinality, buckets, hashIterations float64 ) float64 {
+	load:= hashIterations * cardinality / buckets
+
+	return buckets * ( math.Exp(load) - 1 - load ) / ( hashIterations * hashIterations )
+}
@@ -0,0 +1,100 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"math"
+
+)
+
+//two overlapping populations with a known overlap
+func TestCompare(t *testing.T) {
+	randomKeys:= testKeys()
+	first:= BloomFilter{HashIterations: 4, DataDepth:2}
+	first.BuildBuckets()
+	second:= BloomFilter{HashIterations: 4, DataDepth:2}
+	second.BuildBuckets()
+
+	//items 0-2999 go in the first, 1500-4499 in the second
+	for i := 0; i < 4500; i++ {
+		data:= randomKeys.Key(8)
+		if i < 3000{
+			first.Add(data)
+		}
+		if i >= 1500{
+			second.Add(data)
+		}
+	}
+
+	result, err:= first.Compare(&second)
+	if err!=nil{
+		t.Fatal("Failed to compare matching filters", err)
+	}
+
+	expected:= []struct{
+		name string
+		estimate, truth float64
+	}{
+		{"this", result.This, 3000},
+		{"other", result.Other, 3000},
+		{"union", result.Union, 4500},
+		{"intersection", result.Intersection, 1500},
+		{"only this", result.OnlyThis, 1500},
+		{"only other", result.OnlyOther, 1500},
+	}
+
+	for _,anExpectation:= range expected {
+		if math.Abs( anExpectation.estimate - anExpectation.truth ) > 0.1*anExpectation.truth{
+			t.Error("Estimate is too far off for", anExpectation.name, anExpectation.estimate, anExpectation.truth)
+		}
+	}
+
+	if result.JaccardLow > 1.0/3 || result.JaccardHigh < 1.0/3{
+		t.Error("Jaccard interval does not contain the true similarity", result.JaccardLow, result.Jaccard, result.JaccardHigh)
+	}
+
+	if result.JaccardLow > result.Jaccard || result.JaccardHigh < result.Jaccard{
+		t.Error("Jaccard interval does not contain the estimate", result.JaccardLow, result.Jaccard, result.JaccardHigh)
+	}
+}
+
+//a filter compared to itself is identical and one compared
+//to an unrelated filter shares nothing
+func TestCompareExtremes(t *testing.T) {
+	randomKeys:= testKeys()
+	first:= BloomFilter{HashIterations: 4, DataDepth:2}
+	first.BuildBuckets()
+	second:= BloomFilter{HashIterations: 4, DataDepth:2}
+	second.BuildBuckets()
+
+	first.randomFill( randomKeys, 2000 )
+	second.randomFill( randomKeys, 2000 )
+
+	jaccard, _, high, err:= first.Jaccard(&first)
+	if err!=nil || jaccard < 0.99{
+		t.Error("A filter is not similar to itself", jaccard, err)
+	}
+	if high != 1{
+		t.Error("Self similarity interval should reach 1", high)
+	}
+
+	jaccard, low, _, err:= first.Jaccard(&second)
+	if err!=nil || jaccard > 0.05 || low != 0{
+		t.Error("Unrelated filters appear similar", jaccard, low, err)
+	}
+
+	mismatched:= BloomFilter{HashIterations: 3, DataDepth:2}
+	mismatched.BuildBuckets()
+	_, err= first.Compare(&mismatched)
+	if err != ErrIncompatible{
+		t.Error("Comparing filters with different hashing did not fail")
+	}
+
+	saturated:= BloomFilter{HashIterations: 4, DataDepth:1}
+	saturated.BuildBuckets()
+	saturated.randomFill( randomKeys, 2000 )
+	_, err= saturated.EstimateCardinality()
+	if err != ErrSaturated{
+		t.Error("A saturated filter produced an estimate")
+	}
+}
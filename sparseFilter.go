@@ -0,0 +1,234 @@
+package bloomFilter
+
+import(
+	"math" //for rejecting a NaN DenseAt
+)
+
+//a bloom filter whose IntBuckets are allocated a page at a time, as they're first set.
+//
+//BuildBuckets allocates every bucket a filter's constants call for up front, 512MB
+//at DataDepth 4 however few items it'll hold. A sparse filter starts with only a
+//table of pages, 24 bytes for each SparsePageWords IntBuckets, and allocates a
+//page on the first Set inside it. Checking buckets in a page never set allocates
+//nothing. Each item touches up to HashIterations pages, so this pays off while
+//the items added are few next to the pages.
+//
+//once enough of the pages are allocated the filter switches to the dense array
+//BuildBuckets would have made, see NewSparseFilter. It's a BloomFilter built on
+//a PagedStore, so it hashes exactly like one with the same constants and Dense
+//converts it into one.
+type SparseFilter struct{
+	//the constants, built on store
+	filter BloomFilter
+
+	store *PagedStore
+}
+
+//a sparse filter with the constants of the given filter, built or not.
+//the contents of a built filter, on IntBuckets or a store, are copied in,
+//a page for each nonzero page.
+//
+//once at least denseAt of the pages are allocated the filter goes dense, as
+//Densify. 0 keeps it sparse however full it gets.
+//
+//panics, as BuildBuckets would, if the constants fail Validate
+//or a built filter doesn't have the IntBuckets they call for
+func NewSparseFilter( aBloomFilter *BloomFilter, denseAt float64 ) *SparseFilter {
+	constants:= *aBloomFilter
+	constants.IntBuckets, constants.dirty, constants.store = nil, nil, nil
+
+	//nil only for a filter that was never built
+	built:= aBloomFilter.words()
+
+	//BuildBuckets rounds Guava's bits up to whole words
+	if constants.Strategy == Murmur128Mitz64 && built == nil{
+		constants.Size = (constants.Size + 63) / 64 * 64
+	}
+
+	if constants.validateConstants()!=nil{
+		panic("a sparse filter needs the constants of a valid filter")
+	}
+	if built != nil && len(built) != constants.wordCount(){
+		panic("a built filter needs all of its IntBuckets to make a sparse one")
+	}
+
+	aStore:= NewPagedStore( constants.bucketCount(), denseAt )
+	constants.BuildOn(aStore)
+	aFilter:= &SparseFilter{ filter: constants, store: aStore }
+
+	if built == nil{
+		return aFilter
+	}
+	for i := range aStore.pages {
+		start, end:= aStore.pageBounds(i)
+		if !allZero( built[start:end] ){
+			copy( aStore.page(i), built[start:end] )
+		}
+	}
+
+	return aFilter
+}
+
+//whether none of the words have a bucket set
+func allZero( words []uint64 ) bool {
+	for _,aWord:= range words {
+		if aWord != 0{
+			return false
+		}
+	}
+
+	return true
+}
+
+//moves every page into one array of IntBuckets, as BuildBuckets allocates,
+//so no more pages need allocating. Once most pages are allocated the page table
+//saves nothing. Does nothing to a filter that's already dense
+func (aFilter *SparseFilter) Densify() {
+	aFilter.store.Densify()
+}
+
+//whether the filter has gone dense, see Densify
+func (aFilter *SparseFilter) IsDense() bool {
+	return aFilter.store.IsDense()
+}
+
+//sets the given bucket to filled, allocating its page if need be
+func (aFilter *SparseFilter) Set( index int ) {
+	aFilter.filter.Set(index)
+}
+
+//returns whether the given bucket is filled or not. Never allocates
+func (aFilter *SparseFilter) Get( index int ) bool {
+	return aFilter.filter.Get(index)
+}
+
+//takes an array of bytes and adds it to the filter, see BloomFilter.Add
+func (aFilter *SparseFilter) Add( data []byte ) {
+	aFilter.filter.Add(data)
+}
+
+//takes an array of bytes and checks its membership in the filter, see BloomFilter.CheckMembership
+func (aFilter *SparseFilter) CheckMembership( data []byte ) bool {
+	return aFilter.filter.CheckMembership(data)
+}
+
+//adds the data and reports whether it was already a member, see BloomFilter.AddIfAbsent
+func (aFilter *SparseFilter) AddIfAbsent( data []byte ) (wasPresent bool) {
+	return aFilter.filter.AddIfAbsent(data)
+}
+
+//a copy of the filter as a BloomFilter, with every IntBucket allocated
+func (aFilter *SparseFilter) Dense() BloomFilter {
+	aBloomFilter:= aFilter.filter
+	aBloomFilter.IntBuckets, aBloomFilter.store = aFilter.filter.words(), nil
+
+	return aBloomFilter
+}
+
+//how full a sparse filter is and how much of it is allocated
+type SparseStats struct{
+	FilterStats
+
+	//pages the filter spans and how many of them are allocated,
+	//every one of them once the filter is dense
+	Pages int
+	AllocatedPages int
+
+	Dense bool
+}
+
+//reports how full the filter is, as BloomFilter.Stats, along with its pages
+func (aFilter *SparseFilter) Stats() SparseStats {
+	stats:= SparseStats{ FilterStats: aFilter.filter.Stats(), Dense: aFilter.IsDense() }
+	stats.Pages, stats.AllocatedPages = aFilter.store.Pages()
+
+	return stats
+}
+
+//what a sparse filter is serialized as: its constants, with no IntBuckets,
+//and every page holding a set bucket
+type sparseFilterFile struct{
+	Filter BloomFilter
+	DenseAt float64
+	PageWords int
+	Pages []sparsePage
+}
+
+type sparsePage struct{
+	Index int
+	Words []uint64
+}
+
+//serializes the filter's constants and populated pages, see BloomFilter.Serialize.
+//pages with nothing set, including a dense filter's, are left out
+func (aFilter *SparseFilter) Serialize( fileName string, compress bool ) error {
+	file:= sparseFilterFile{ Filter: aFilter.filter, DenseAt: aFilter.store.denseAt, PageWords: SparsePageWords }
+
+	for i,aPage:= range aFilter.store.pages {
+		if !allZero(aPage){
+			file.Pages = append( file.Pages, sparsePage{ Index: i, Words: aPage } )
+		}
+	}
+
+	return writeSerialized( fileName, file, compress )
+}
+
+//attempts to deserialize a sparse filter, the counterpart to SparseFilter.Serialize.
+//like RetrieveFilter the file is treated as untrusted
+func RetrieveSparseFilter( fileName string, compressed bool ) (*SparseFilter, error) {
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return nil, err
+	}
+
+	return parseSparseFilter( data, compressed )
+}
+
+//the parsing half of RetrieveSparseFilter. The constants have to pass
+//Validate and the pages have to be in order, each whole and inside the filter
+func parseSparseFilter( data []byte, compressed bool ) (*SparseFilter, error) {
+	var file sparseFilterFile
+
+	err:= decodeSerialized( data, compressed, &file )
+	if err!=nil{
+		return nil, err
+	}
+
+	if file.Filter.IntBuckets != nil || file.PageWords != SparsePageWords || math.IsNaN(file.DenseAt){
+		return nil, ErrCorrupt
+	}
+	err = file.Filter.validateConstants()
+	if err!=nil{
+		return nil, err
+	}
+
+	//the page table is all that's allocated up front, which a DataDepth 4 filter
+	//keeps to 3MB. The pages themselves can be no larger than the file
+	aFilter:= NewSparseFilter( &file.Filter, 0 )
+	aStore:= aFilter.store
+
+	last:= -1
+	for _,aPage:= range file.Pages {
+		if aPage.Index <= last || aPage.Index >= len(aStore.pages){
+			return nil, ErrCorrupt
+		}
+		start, end:= aStore.pageBounds(aPage.Index)
+		if len(aPage.Words) != end - start{
+			return nil, ErrCorrupt
+		}
+
+		aStore.pages[aPage.Index] = aPage.Words
+		aStore.allocated++
+		last = aPage.Index
+	}
+
+	//a dense filter from a small file could otherwise fill memory,
+	//so it can be no larger than a file holding it dense could be
+	aStore.denseAt = file.DenseAt
+	if aStore.denseAt > 0 && int64( aFilter.filter.wordCount() ) > MaxSerializedSize / 8{
+		return nil, ErrTooLarge
+	}
+	aStore.checkDensity()
+
+	return aFilter, nil
+}
@@ -0,0 +1,202 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"os"
+	"path/filepath"
+	"slices"
+
+)
+
+//a DataDepth 4 filter holding few items allocates a sliver of its pages
+func TestSparseFilter(t *testing.T) {
+	randomKeys:= testKeys()
+	aFilter:= NewSparseFilter( &BloomFilter{HashIterations: 4, DataDepth: 4}, 0 )
+
+	keys:= deltaKeys( randomKeys, 10000 )
+	for i,aKey:= range keys {
+		if aFilter.AddIfAbsent(aKey){
+			t.Fatal("Sparse filter claimed a new item was present", i)
+		}
+	}
+	for i,aKey:= range keys {
+		if !aFilter.CheckMembership(aKey){
+			t.Fatal("Sparse filter lost an item", i)
+		}
+	}
+
+	stats:= aFilter.Stats()
+	if stats.Pages != 1 << 17 || stats.Dense{
+		t.Fatal("Sparse filter has the wrong pages", stats.Pages, stats.Dense)
+	}
+	if stats.AllocatedPages > 4*len(keys) || stats.AllocatedPages < len(keys){
+		t.Error("Sparse filter allocated the wrong amount of pages", stats.AllocatedPages)
+	}
+	if stats.SetBuckets > 4*len(keys) || stats.EstimatedItems < 9500 || stats.EstimatedItems > 10500{
+		t.Error("Sparse stats are off", stats.FilterStats)
+	}
+
+	//checks of pages never set don't allocate them
+	absent:= deltaKeys( randomKeys, 100 )
+	allocations:= testing.AllocsPerRun( 100, func() {
+		for _,aKey:= range absent {
+			aFilter.CheckMembership(aKey)
+		}
+	})
+	if allocations != 0 || aFilter.Stats().AllocatedPages != stats.AllocatedPages{
+		t.Error("Checking absent items allocated", allocations)
+	}
+}
+
+//a sparse filter sets exactly the buckets a dense one does, dense or not
+func TestSparseMatchesDense(t *testing.T) {
+	randomKeys:= testKeys()
+
+	for _,denseAt:= range []float64{ 0, 0.5 } {
+		dense:= BloomFilter{HashIterations: 3, DataDepth: 3, Seed: 7}
+		dense.BuildBuckets()
+		aFilter:= NewSparseFilter( &BloomFilter{HashIterations: 3, DataDepth: 3, Seed: 7}, denseAt )
+
+		for _,aKey:= range deltaKeys( randomKeys, 200 ) {
+			dense.Add(aKey)
+			aFilter.Add(aKey)
+		}
+
+		if aFilter.IsDense() != ( denseAt > 0 ){
+			t.Error("Sparse filter went dense at the wrong time", denseAt, aFilter.Stats().AllocatedPages)
+		}
+		if converted:= aFilter.Dense(); !slices.Equal( converted.IntBuckets, dense.IntBuckets ){
+			t.Error("Sparse filter set other buckets than a dense one", denseAt)
+		}
+	}
+
+	//a built filter's contents carry over, in any strategy
+	guava:= BloomFilter{HashIterations: 5, Strategy: Murmur128Mitz64, Size: 100000}
+	guava.BuildBuckets()
+	keys:= deltaKeys( randomKeys, 50 )
+	for _,aKey:= range keys {
+		guava.Add(aKey)
+	}
+
+	aFilter:= NewSparseFilter( &guava, 0 )
+	for i,aKey:= range keys {
+		if !aFilter.CheckMembership(aKey){
+			t.Fatal("Sparse copy of a filter lost an item", i)
+		}
+	}
+	if converted:= aFilter.Dense(); !slices.Equal( converted.IntBuckets, guava.IntBuckets ) || converted.Size != guava.Size{
+		t.Error("Sparse copy of a filter converted back wrongly")
+	}
+	if stats:= aFilter.Stats(); stats.AllocatedPages > len(keys)*5 || stats.Pages != 4{
+		t.Error("Sparse copy allocated the wrong pages", stats.AllocatedPages, stats.Pages)
+	}
+
+	//so do the contents of one built on a store
+	stored:= BloomFilter{HashIterations: 5, Strategy: Murmur128Mitz64, Size: 100000}
+	stored.BuildOn( NewHeapStore(guava.Size) )
+	for _,aKey:= range keys {
+		stored.Add(aKey)
+	}
+	if converted:= NewSparseFilter( &stored, 0 ).Dense(); !slices.Equal( converted.IntBuckets, guava.IntBuckets ) || converted.Size != guava.Size{
+		t.Error("Sparse copy of a filter on a store converted wrongly")
+	}
+
+	//an unbuilt one is sized as BuildBuckets would
+	if unbuilt:= NewSparseFilter( &BloomFilter{HashIterations: 5, Strategy: Murmur128Mitz64, Size: 100000}, 0 ); unbuilt.Dense().Size != guava.Size{
+		t.Error("Unbuilt sparse filter was sized differently", unbuilt.Dense().Size)
+	}
+
+	defer func() {
+		if recover() == nil{
+			t.Error("A sparse filter was made with invalid constants")
+		}
+	}()
+	NewSparseFilter( &BloomFilter{HashIterations: 4, DataDepth: 5}, 0 )
+}
+
+//only populated pages are written and they all come back
+func TestSparseSerialize(t *testing.T) {
+	randomKeys:= testKeys()
+	aFilter:= NewSparseFilter( &BloomFilter{HashIterations: 4, DataDepth: 4}, 0.9 )
+	keys:= deltaKeys( randomKeys, 100 )
+	for _,aKey:= range keys {
+		aFilter.Add(aKey)
+	}
+
+	for _,compress:= range []bool{ false, true } {
+		fileName:= filepath.Join( t.TempDir(), "sparseFilter.json" )
+		if err:= aFilter.Serialize( fileName, compress ); err!=nil{
+			t.Fatal("Failed to serialize the sparse filter!", err)
+		}
+
+		//a dense DataDepth 4 filter would take gigabytes
+		info, err:= os.Stat(fileName)
+		if err!=nil || info.Size() > 2048*int64(len(keys))*4{
+			t.Error("Sparse filter serialized too much", info.Size(), err)
+		}
+
+		retrieved, err:= RetrieveSparseFilter( fileName, compress )
+		if err!=nil{
+			t.Fatal("Failed to deserialize the sparse filter!", err)
+		}
+		if retrieved.Stats() != aFilter.Stats(){
+			t.Fatal("Retrieved sparse filter differs", retrieved.Stats(), aFilter.Stats())
+		}
+		for i,aKey:= range keys {
+			if !retrieved.CheckMembership(aKey){
+				t.Fatal("Retrieved sparse filter lost an item", i)
+			}
+		}
+	}
+
+	//a dense filter only writes its populated pages too
+	small:= NewSparseFilter( &BloomFilter{HashIterations: 2, DataDepth: 3}, 0 )
+	small.Add( []byte("item") )
+	small.Densify()
+	fileName:= filepath.Join( t.TempDir(), "denseFilter.json" )
+	if err:= small.Serialize( fileName, false ); err!=nil{
+		t.Fatal("Failed to serialize the dense filter!", err)
+	}
+	retrieved, err:= RetrieveSparseFilter( fileName, false )
+	if err!=nil{
+		t.Fatal("Failed to deserialize the dense filter!", err)
+	}
+	if stats:= retrieved.Stats(); stats.AllocatedPages > 2 || stats.Dense || !retrieved.CheckMembership( []byte("item") ){
+		t.Error("Dense filter came back wrongly", stats)
+	}
+}
+
+//anything parseSparseFilter accepts has to be usable without panicking
+func FuzzParseSparseFilter(f *testing.F) {
+	seed:= NewSparseFilter( &BloomFilter{HashIterations: 3, DataDepth: 1}, 0 )
+	seed.Add( []byte("seed") )
+	addSerializedSeeds( f, seed.Serialize )
+
+	f.Add( []byte(`{"Filter":{"HashIterations":3,"DataDepth":1},"DenseAt":0.5,"PageWords":512,"Pages":[{"Index":0,"Words":[1,0,0,0]}]}`), false )
+	f.Add( []byte(`{"Filter":{"HashIterations":3,"Strategy":2,"Size":70},"PageWords":512,"Pages":[{"Index":0,"Words":[1,2]}]}`), false )
+
+	defer func( limit int64 ) { MaxSerializedSize = limit }( MaxSerializedSize )
+	MaxSerializedSize = 1 << 16
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseSparseFilter( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add(data)
+		if !aFilter.CheckMembership(data){
+			t.Fatal("Parsed sparse filter lost an item")
+		}
+		stats:= aFilter.Stats()
+		if stats.Buckets > 1 << 24{
+			return
+		}
+
+		dense:= aFilter.Dense()
+		if dense.Validate()!=nil || !dense.CheckMembership(data){
+			t.Fatal("Parsed sparse filter converted wrongly")
+		}
+	})
+}
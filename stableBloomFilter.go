@@ -0,0 +1,253 @@
+package bloomFilter
+
+import(
+	"fmt" //for yelling, same as BloomFilter
+	"math" //for the stable point estimates
+	"math/rand" //for picking which cells decay on each insert
+	"time" //for seeding the decay
+)
+
+//a stable bloom filter as described by Deng and Rafiei in
+//'Approximately Detecting Duplicates for Streaming Data using Stable Bloom Filters'
+//
+//a regular BloomFilter fed an unbounded stream eventually has every bit set and
+//claims everything is a member. Here each bucket is a small counter cell instead
+//of a bit. Every Add first decrements Decrements randomly chosen cells and then
+//sets the cells of the item to Max. Old items decay out of the filter so the
+//fraction of zeroed cells, and therefore the false positive rate, converges to
+//a fixed point rather than drifting towards 1.
+//
+//the price is false negatives: an item that has not been seen for a while may
+//have decayed out of the filter.
+//
+// Always call yourStableBloomFilter.BuildCells before doing anything else.
+type StableBloomFilter struct{
+	//how many times to run the filter's function, uses the same
+	//chained sha256 indexing as BloomFilter
+		//this is the k in terms of calculating accuracy
+	HashIterations int
+
+	//bytes of each hash used for an index. The filter has 2^(DataDepth*8) cells.
+		//cells are a byte wide so this stops at 3, 16MB of cells
+	DataDepth int
+
+	//the value a cell is set to when an item maps to it.
+	//this is the largest value a cell holds, 1 makes for a very forgetful filter
+	Max uint8
+
+	//how many random cells are decremented on each Add, the P in the paper
+	Decrements int
+
+	//mixed into the hashing exactly like BloomFilter.Seed. A nonzero seed
+	//also seeds the choice of decayed cells, so the same seed and the same
+	//adds always leave the same cells. 0 decays from the clock
+	Seed uint64
+
+	//the cells themselves, one byte per cell
+	Cells []uint8
+
+	//picks the cells to decrement, built by BuildCells
+	decayer *rand.Rand
+}
+
+//builds the cells for a stable bloom filter.
+	//like BloomFilter.BuildBuckets, this is essentially a reset switch
+func (aFilter *StableBloomFilter) BuildCells() {
+	//cells are 8 times the size of a BloomFilter's bits so we stop a level earlier
+	if aFilter.DataDepth > 3{
+		fmt.Println("you went above 3 for DataDepth on a stable filter.\n That means you just tried to create a 4294967296 byte array of cells.")
+		panic("a stable filter's cells are a byte each, keep DataDepth at 3 or below")
+	}
+
+	if aFilter.Max == 0{
+		panic("a Max of 0 means no cell can ever be set")
+	}
+
+	possibleCells:= intExponent( 2, aFilter.DataDepth*8 )
+
+	aFilter.Cells = make( []uint8, possibleCells )
+
+	aFilter.seedDecayer()
+}
+
+//literally BuildCells, for convention
+func (aFilter *StableBloomFilter) Reset() {
+	aFilter.BuildCells()
+}
+
+//sets up the source used to pick decremented cells.
+//a retrieved filter won't have one so this is also called lazily,
+//a seeded one then starts its decay sequence over from the beginning.
+func (aFilter *StableBloomFilter) seedDecayer() {
+	seed:= time.Now().UnixNano()
+	if aFilter.Seed != 0{
+		seed = int64(aFilter.Seed)
+	}
+
+	aFilter.decayer = rand.New( rand.NewSource(seed) )
+}
+
+//decrements Decrements randomly chosen cells, stopping at zero
+func (aFilter *StableBloomFilter) decay() {
+	if aFilter.decayer == nil{
+		aFilter.seedDecayer()
+	}
+
+	cellCount:= len(aFilter.Cells)
+	for i := 0; i < aFilter.Decrements; i++ {
+		cell:= aFilter.decayer.Intn(cellCount)
+		if aFilter.Cells[cell] > 0{
+			aFilter.Cells[cell]--
+		}
+	}
+}
+
+//takes an array of bytes and adds it to the filter.
+//the decay happens before the item's cells are set so a
+//freshly added item is always a member
+func (aFilter *StableBloomFilter) Add( data []byte ) {
+
+	aFilter.decay()
+
+	indices:= indicesOf( data, aFilter.HashIterations, aFilter.DataDepth, aFilter.Seed )
+	for _,anIndex:= range indices{
+		aFilter.Cells[anIndex] = aFilter.Max
+	}
+
+}
+
+//takes an array of bytes and checks its membership in the filter.
+//unlike BloomFilter this may return false for an item that was added
+//long enough ago
+func (aFilter *StableBloomFilter) CheckMembership( data []byte ) bool {
+
+	indices:= indicesOf( data, aFilter.HashIterations, aFilter.DataDepth, aFilter.Seed )
+
+	//any zeroed cell means the item is absent, or has decayed away
+	for _,anIndex:= range indices{
+		if aFilter.Cells[anIndex] == 0{
+			return false
+		}
+	}
+
+	return true
+}
+
+//a snapshot of the state of a stable bloom filter
+type StableStats struct{
+	//total cells and how many of them are currently zero
+	Cells int
+	ZeroCells int
+
+	//fraction of cells that are currently nonzero
+	FillRatio float64
+
+	//false positive rate at the current fill, (1 - zero fraction)^k
+	CurrentFPR float64
+
+	//the expected fraction of zeroed cells once the filter has stabilised
+	StableZeroRatio float64
+
+	//the false positive rate the filter converges to, regardless of how
+	//many more items are added
+	StableFPR float64
+}
+
+//reports the current and stable point false positive rates of the filter
+func (aFilter *StableBloomFilter) Stats() StableStats {
+
+	var stats StableStats
+
+	stats.Cells = len(aFilter.Cells)
+	for _,aCell:= range aFilter.Cells{
+		if aCell == 0{
+			stats.ZeroCells++
+		}
+	}
+
+	if stats.Cells == 0{
+		return stats
+	}
+
+	stats.FillRatio = 1 - float64(stats.ZeroCells) / float64(stats.Cells)
+	stats.CurrentFPR = math.Pow( stats.FillRatio, float64(aFilter.HashIterations) )
+
+	stats.StableZeroRatio = stableZeroRatio( float64(stats.Cells), float64(aFilter.HashIterations),
+		float64(aFilter.Decrements), float64(aFilter.Max) )
+	stats.StableFPR = math.Pow( 1 - stats.StableZeroRatio, float64(aFilter.HashIterations) )
+
+	return stats
+}
+
+//the limit of the probability a cell is zero, from theorem 1 of the paper:
+//
+//	(1 / (1 + 1/(P*(1/k - 1/m))))^Max
+func stableZeroRatio( cells, hashIterations, decrements, max float64 ) float64 {
+	//no decay means the filter saturates like a regular bloom filter
+	if decrements <= 0{
+		return 0
+	}
+
+	inner:= 1 / ( 1 + 1/( decrements * ( 1/hashIterations - 1/cells ) ) )
+
+	return math.Pow( inner, max )
+}
+
+//serializes a stable bloom filter, see BloomFilter.Serialize
+func (aFilter *StableBloomFilter) Serialize(fileName string, compress bool) error {
+	return writeSerialized( fileName, aFilter, compress )
+}
+
+//attempts to deserialize a file into a stable bloom filter.
+//the counterpart to StableBloomFilter.Serialize
+func RetrieveStableFilter(fileName string, compressed bool) (StableBloomFilter, error) {
+
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return StableBloomFilter{}, err
+	}
+
+	return parseStableFilter( data, compressed )
+}
+
+//the parsing half of RetrieveStableFilter
+func parseStableFilter(data []byte, compressed bool) (StableBloomFilter, error) {
+
+	var aFilter StableBloomFilter
+
+	err:= decodeSerialized( data, compressed, &aFilter )
+	if err!=nil{
+		return StableBloomFilter{}, err
+	}
+
+	err = aFilter.Validate()
+	if err!=nil{
+		return StableBloomFilter{}, err
+	}
+
+	return aFilter, nil
+}
+
+//checks DataDepth is between 1 and 3, HashIterations between 1 and
+//MaxHashIterations, Max isn't 0, Decrements is between 0 and the amount
+//of cells and that there are exactly 2^(DataDepth*8) cells.
+//
+//returns ErrCorrupt if any of them is broken
+func (aFilter *StableBloomFilter) Validate() error {
+	if aFilter.DataDepth < 1 || aFilter.DataDepth > 3{
+		return ErrCorrupt
+	}
+	if aFilter.HashIterations < 1 || aFilter.HashIterations > MaxHashIterations{
+		return ErrCorrupt
+	}
+	if aFilter.Max == 0{
+		return ErrCorrupt
+	}
+
+	cells:= 1 << uint( aFilter.DataDepth*8 )
+	if len(aFilter.Cells) != cells || aFilter.Decrements < 0 || aFilter.Decrements > cells{
+		return ErrCorrupt
+	}
+
+	return nil
+}
@@ -0,0 +1,138 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"math"
+	"path/filepath"
+
+)
+
+//every item is a member directly after being added, decay happens first
+func TestStableFilterRecentMembership(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= StableBloomFilter{HashIterations: 3, DataDepth:2, Max:3, Decrements:10}
+	workingFilter.BuildCells()
+
+	for i := 0; i < 10000; i++ {
+		data:= randomKeys.Key(8)
+		workingFilter.Add(data)
+
+		if !workingFilter.CheckMembership(data){
+			t.Fatal("Freshly added item was not a member", data)
+		}
+	}
+}
+
+//streams far more items than the filter has cells and makes sure the
+//false positive rate settles on the stable point rather than going to 1
+func TestStableFilterConverges(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= StableBloomFilter{HashIterations: 3, DataDepth:2, Max:3, Decrements:10}
+	workingFilter.BuildCells()
+
+	for i := 0; i < 200000; i++ {
+		workingFilter.Add( randomKeys.Key(8) )
+	}
+
+	stats:= workingFilter.Stats()
+
+	if stats.StableFPR <= 0 || stats.StableFPR >= 0.5{
+		t.Fatal("Stable point FPR is not sensible for the test filter", stats.StableFPR)
+	}
+
+	if math.Abs( stats.CurrentFPR - stats.StableFPR ) > 0.03{
+		t.Error("Current FPR did not converge to the stable point", stats.CurrentFPR, stats.StableFPR)
+	}
+
+	//now check it empirically with data that was never added
+	probes:= 20000
+	var positives int
+	for i := 0; i < probes; i++ {
+		if workingFilter.CheckMembership( randomKeys.Key(9) ){
+			positives++
+		}
+	}
+
+	observed:= float64(positives) / float64(probes)
+	if math.Abs( observed - stats.StableFPR ) > 0.03{
+		t.Error("Observed FPR is not near the stable point", observed, stats.StableFPR)
+	}
+}
+
+//anything parseStableFilter accepts has to be usable without panicking
+func FuzzParseStableFilter(f *testing.F) {
+	seed:= StableBloomFilter{HashIterations: 3, DataDepth: 1, Max: 3, Decrements: 2}
+	seed.BuildCells()
+	seed.Add( []byte("seed") )
+	addSerializedSeeds( f, seed.Serialize )
+
+	f.Add( []byte(`{"HashIterations":3,"DataDepth":3,"Max":3,"Decrements":2,"Cells":[1,2,3]}`), false )
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseStableFilter( data, compressed )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add(data)
+		if !aFilter.CheckMembership(data){
+			t.Fatal("Parsed stable filter lost a freshly added item")
+		}
+		aFilter.Stats()
+	})
+}
+
+//seeded stable filters given the same adds decay the same cells
+func TestStableFilterSeed(t *testing.T) {
+	randomKeys:= testKeys()
+
+	first:= StableBloomFilter{HashIterations: 3, DataDepth: 1, Max: 3, Decrements: 10, Seed: 5}
+	first.BuildCells()
+	second:= first
+	second.BuildCells()
+
+	for i := 0; i < 500; i++ {
+		data:= randomKeys.Key(8)
+		first.Add(data)
+		second.Add(data)
+	}
+
+	for i := range first.Cells {
+		if first.Cells[i] != second.Cells[i]{
+			t.Fatal("Stable filters with the same seed diverged at cell", i)
+		}
+	}
+}
+
+func TestStableFilterSerialize(t *testing.T) {
+	randomKeys:= testKeys()
+	workingFilter:= StableBloomFilter{HashIterations: 3, DataDepth:2, Max:3, Decrements:10}
+	workingFilter.BuildCells()
+
+	testBytes:= make([][]byte, 50)
+	for i := range testBytes {
+		testBytes[i] = randomKeys.Key(8)
+		workingFilter.Add( testBytes[i] )
+	}
+
+	fileName:= filepath.Join( t.TempDir(), "stableFilter.json" )
+	err:= workingFilter.Serialize(fileName, true)
+	if err!=nil{
+		t.Fatal("Failed to serialize the filter!", err)
+	}
+
+	retrieved, err:= RetrieveStableFilter(fileName, true)
+	if err!=nil{
+		t.Fatal("Failed to deserialize the filter!", err)
+	}
+
+	for i := range testBytes {
+		if workingFilter.CheckMembership(testBytes[i]) != retrieved.CheckMembership(testBytes[i]){
+			t.Error("Retrieved stable filter disagrees with the original", testBytes[i])
+		}
+	}
+
+	//the retrieved filter has no decayer yet, adding must still work
+	retrieved.Add( randomKeys.Key(8) )
+}
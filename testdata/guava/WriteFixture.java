@@ -0,0 +1,36 @@
+import com.google.common.hash.BloomFilter;
+import com.google.common.hash.Funnels;
+
+import java.io.FileOutputStream;
+import java.io.IOException;
+import java.io.OutputStream;
+import java.io.PrintWriter;
+import java.nio.charset.StandardCharsets;
+
+// Writes guava.bin and guava_probes.txt for TestGuavaJavaFixture.
+// The filter is the one guavaGolden in guava_test.go describes.
+public class WriteFixture {
+    public static void main(String[] args) throws IOException {
+        String guavaVersion = args.length > 0 ? args[0] : "unknown";
+
+        BloomFilter<CharSequence> filter =
+                BloomFilter.create(Funnels.stringFunnel(StandardCharsets.UTF_8), 10, 0.03);
+        String[] words = {"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf", "hotel", "india", "juliet"};
+        for (String word : words) {
+            filter.put(word);
+        }
+
+        try (OutputStream out = new FileOutputStream("guava.bin")) {
+            filter.writeTo(out);
+        }
+
+        try (PrintWriter probes = new PrintWriter("guava_probes.txt", "UTF-8")) {
+            probes.println("# guava " + guavaVersion + ", java " + System.getProperty("java.version"));
+            for (int i = 0; i < 2000; i++) {
+                if (filter.mightContain("probe-" + i)) {
+                    probes.println("positive " + i);
+                }
+            }
+        }
+    }
+}
@@ -0,0 +1,229 @@
+package bloomFilter
+
+import(
+	"encoding" //for encoding BinaryMarshaler keys
+	"errors" //for refusing a file written with another encoder
+	"fmt" //for naming encoders after their types
+	"reflect" //for naming BinaryMarshaler encoders after their types
+	"unsafe" //for viewing strings as bytes without copying
+)
+
+//returned when a typed filter is retrieved with a different
+//encoder to the one it was serialized with
+var ErrEncoderMismatch = errors.New("bloomFilter: filter was serialized with a different key encoder")
+
+//turns a key into the bytes a filter hashes.
+//
+//two filters only agree on a key if they encode it the same way, so an
+//encoder's Name has to change whenever its encoding does
+type Encoder[T any] interface{
+	//appends the encoding of the value to buffer and returns the result.
+	//may instead return bytes that alias the value itself
+	Encode( buffer []byte, value T ) []byte
+
+	//identifies the encoding, recorded when a typed filter is serialized
+	Name() string
+}
+
+//implemented as well by encoders whose encodings never exceed 16 bytes, such
+//as IntegerEncoder and UUIDEncoder. A typed filter then encodes keys into an array
+//on its own stack instead of passing Encode a buffer, which would escape through
+//the interface and be allocated on every call.
+//
+//the first length bytes of encoded must be what Encode would append
+type ArrayEncoder[T any] interface{
+	EncodeArray( value T ) (encoded [16]byte, length int)
+}
+
+//a BloomFilter taking keys of a single type.
+//
+//every key goes through the same Encoder so every caller
+//turns keys into bytes in exactly the same way
+type Filter[T any] struct{
+	filter *BloomFilter
+	encoder Encoder[T]
+
+	//the encoder again, nil unless it's an ArrayEncoder
+	arrayEncoder ArrayEncoder[T]
+}
+
+//wraps a built filter so it takes keys of type T
+func NewFilter[T any]( aBloomFilter *BloomFilter, encoder Encoder[T] ) *Filter[T] {
+	arrayEncoder, _:= encoder.(ArrayEncoder[T])
+	return &Filter[T]{ filter: aBloomFilter, encoder: encoder, arrayEncoder: arrayEncoder }
+}
+
+//the wrapped filter
+func (aFilter *Filter[T]) BloomFilter() *BloomFilter {
+	return aFilter.filter
+}
+
+//each method below encodes into an array of its own when the encoder is an
+//ArrayEncoder. Other encoders append to nil, so only allocate if they copy the
+//value, which StringEncoder doesn't
+
+//adds the key to the filter
+func (aFilter *Filter[T]) Add( value T ) {
+	if aFilter.arrayEncoder != nil{
+		encoded, length:= aFilter.arrayEncoder.EncodeArray(value)
+		aFilter.filter.Add( encoded[:length] )
+		return
+	}
+
+	aFilter.filter.Add( aFilter.encoder.Encode( nil, value ) )
+}
+
+//checks the key's membership in the filter
+func (aFilter *Filter[T]) CheckMembership( value T ) bool {
+	if aFilter.arrayEncoder != nil{
+		encoded, length:= aFilter.arrayEncoder.EncodeArray(value)
+		return aFilter.filter.CheckMembership( encoded[:length] )
+	}
+
+	return aFilter.filter.CheckMembership( aFilter.encoder.Encode( nil, value ) )
+}
+
+//adds the key and reports whether it was already a member, see BloomFilter.AddIfAbsent
+func (aFilter *Filter[T]) AddIfAbsent( value T ) bool {
+	if aFilter.arrayEncoder != nil{
+		encoded, length:= aFilter.arrayEncoder.EncodeArray(value)
+		return aFilter.filter.AddIfAbsent( encoded[:length] )
+	}
+
+	return aFilter.filter.AddIfAbsent( aFilter.encoder.Encode( nil, value ) )
+}
+
+//what a typed filter is serialized as, the filter along with
+//the name of the encoder its keys went through
+type typedFilterFile struct{
+	Encoder string
+	Filter *BloomFilter
+}
+
+//serializes the filter and the name of its encoder, see BloomFilter.Serialize
+func (aFilter *Filter[T]) Serialize( fileName string, compress bool ) error {
+	return writeSerialized( fileName, typedFilterFile{ Encoder: aFilter.encoder.Name(), Filter: aFilter.filter.written() }, compress )
+}
+
+//attempts to deserialize a typed filter.
+//the encoder given must have the same name as the one the filter was
+//serialized with, otherwise ErrEncoderMismatch is returned
+func RetrieveTypedFilter[T any]( fileName string, compressed bool, encoder Encoder[T] ) (*Filter[T], error) {
+
+	data, err:= readSerialized(fileName)
+	if err!=nil{
+		return nil, err
+	}
+
+	return parseTypedFilter( data, compressed, encoder )
+}
+
+//the parsing half of RetrieveTypedFilter
+func parseTypedFilter[T any]( data []byte, compressed bool, encoder Encoder[T] ) (*Filter[T], error) {
+
+	file:= typedFilterFile{ Filter: new(BloomFilter) }
+
+	err:= decodeSerialized( data, compressed, &file )
+	if err!=nil{
+		return nil, err
+	}
+
+	if file.Encoder != encoder.Name(){
+		return nil, ErrEncoderMismatch
+	}
+
+	//an explicit null replaces the filter allocated above
+	if file.Filter == nil{
+		return nil, ErrCorrupt
+	}
+	err = file.Filter.Validate()
+	if err!=nil{
+		return nil, err
+	}
+
+	return NewFilter( file.Filter, encoder ), nil
+}
+
+//encodes strings as their bytes. The string's memory is used
+//directly so nothing is copied
+type StringEncoder struct{}
+
+func (StringEncoder) Encode( buffer []byte, value string ) []byte {
+	return unsafe.Slice( unsafe.StringData(value), len(value) )
+}
+
+func (StringEncoder) Name() string {
+	return "string"
+}
+
+//the fixed width integer types.
+//int, uint and uintptr are left out as their width depends on the platform
+type fixedInteger interface{
+	~int8 | ~int16 | ~int32 | ~int64 | ~uint8 | ~uint16 | ~uint32 | ~uint64
+}
+
+//encodes integers as little endian at their full width,
+//so an int32 is always 4 bytes and a uint64 always 8
+type IntegerEncoder[T fixedInteger] struct{}
+
+func (IntegerEncoder[T]) Encode( buffer []byte, value T ) []byte {
+	width:= int( unsafe.Sizeof(value) )
+	bits:= uint64(value)
+
+	for i := 0; i < width; i++ {
+		buffer = append( buffer, byte( bits >> (8*uint(i)) ) )
+	}
+
+	return buffer
+}
+
+func (IntegerEncoder[T]) EncodeArray( value T ) (encoded [16]byte, length int) {
+	length = int( unsafe.Sizeof(value) )
+	bits:= uint64(value)
+
+	for i := 0; i < length; i++ {
+		encoded[i] = byte( bits >> (8*uint(i)) )
+	}
+
+	return encoded, length
+}
+
+func (IntegerEncoder[T]) Name() string {
+	var value T
+	return fmt.Sprintf( "int%d-le", 8*unsafe.Sizeof(value) )
+}
+
+//encodes 16 byte UUIDs as their raw bytes
+type UUIDEncoder struct{}
+
+func (UUIDEncoder) Encode( buffer []byte, value [16]byte ) []byte {
+	return append( buffer, value[:]... )
+}
+
+func (UUIDEncoder) EncodeArray( value [16]byte ) ([16]byte, int) {
+	return value, 16
+}
+
+func (UUIDEncoder) Name() string {
+	return "uuid"
+}
+
+//encodes values through their MarshalBinary method.
+//
+//a value that fails to marshal can't be looked up at all
+//so it is treated as a programming error and panics
+type BinaryMarshalerEncoder[T encoding.BinaryMarshaler] struct{}
+
+func (BinaryMarshalerEncoder[T]) Encode( buffer []byte, value T ) []byte {
+	marshaled, err:= value.MarshalBinary()
+	if err!=nil{
+		panic( fmt.Sprintf( "bloomFilter: failed to marshal a key: %v", err ) )
+	}
+
+	return append( buffer, marshaled... )
+}
+
+//the name includes the type as the encoding is the type's own
+func (BinaryMarshalerEncoder[T]) Name() string {
+	return "binary:" + reflect.TypeFor[T]().String()
+}
@@ -0,0 +1,189 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bytes"
+	"encoding"
+	"net/netip"
+	"path/filepath"
+	"unsafe"
+
+)
+
+func TestEncoders(t *testing.T) {
+	value:= "a string key"
+	encoded:= StringEncoder{}.Encode( nil, value )
+	if string(encoded) != value || unsafe.SliceData(encoded) != unsafe.StringData(value){
+		t.Error("String encoder copied or changed the string")
+	}
+
+	if !bytes.Equal( IntegerEncoder[uint16]{}.Encode( nil, 0x0102 ), []byte{ 0x02, 0x01 } ){
+		t.Error("uint16 is not encoded little endian")
+	}
+	if !bytes.Equal( IntegerEncoder[int32]{}.Encode( nil, -2 ), []byte{ 0xfe, 0xff, 0xff, 0xff } ){
+		t.Error("int32 is not encoded at full width")
+	}
+	if len( IntegerEncoder[uint64]{}.Encode( nil, 1 ) ) != 8{
+		t.Error("uint64 is not encoded at full width")
+	}
+
+	if (IntegerEncoder[int8]{}).Name() != "int8-le" || (IntegerEncoder[uint64]{}).Name() != "int64-le"{
+		t.Error("Integer encoder names do not describe their width", IntegerEncoder[int8]{}.Name())
+	}
+
+	uuid:= [16]byte{ 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16 }
+	if !bytes.Equal( UUIDEncoder{}.Encode( nil, uuid ), uuid[:] ){
+		t.Error("UUID encoder changed the bytes")
+	}
+
+	//EncodeArray has to give exactly what Encode does
+	for _,aValue:= range []int32{ 0, -2, 0x01020304 } {
+		encoded, length:= IntegerEncoder[int32]{}.EncodeArray(aValue)
+		if !bytes.Equal( encoded[:length], IntegerEncoder[int32]{}.Encode( nil, aValue ) ){
+			t.Error("int32 array encoding differs", aValue)
+		}
+	}
+	if encoded, length:= (IntegerEncoder[uint64]{}).EncodeArray(0x0102); length != 8 || encoded[0] != 0x02 || encoded[1] != 0x01{
+		t.Error("uint64 array encoding differs", encoded, length)
+	}
+	if encoded, length:= (UUIDEncoder{}).EncodeArray(uuid); !bytes.Equal( encoded[:length], uuid[:] ){
+		t.Error("UUID array encoding differs", encoded, length)
+	}
+
+	address:= netip.MustParseAddr("10.0.0.1")
+	marshaled, _:= address.MarshalBinary()
+	if !bytes.Equal( BinaryMarshalerEncoder[netip.Addr]{}.Encode( nil, address ), marshaled ){
+		t.Error("BinaryMarshaler encoder does not use MarshalBinary")
+	}
+	if (BinaryMarshalerEncoder[netip.Addr]{}).Name() != "binary:netip.Addr"{
+		t.Error("BinaryMarshaler encoder is not named after its type", BinaryMarshalerEncoder[netip.Addr]{}.Name())
+	}
+	//the zero value of an interface type has no type of its own to name
+	if name:= (BinaryMarshalerEncoder[encoding.BinaryMarshaler]{}).Name(); name != "binary:encoding.BinaryMarshaler"{
+		t.Error("BinaryMarshaler encoder over an interface is misnamed", name)
+	}
+}
+
+//a typed filter answers exactly like the underlying filter fed encoded keys
+func TestTypedFilter(t *testing.T) {
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	workingFilter.BuildBuckets()
+	typed:= NewFilter[uint32]( &workingFilter, IntegerEncoder[uint32]{} )
+
+	for i := uint32(0); i < 500; i++ {
+		typed.Add(i)
+	}
+
+	for i := uint32(0); i < 500; i++ {
+		if !typed.CheckMembership(i){
+			t.Fatal("Typed filter lost a key", i)
+		}
+		if !workingFilter.CheckMembership( []byte{ byte(i), byte(i>>8), 0, 0 } ){
+			t.Fatal("Typed key was not encoded as fixed width little endian", i)
+		}
+	}
+
+	if typed.AddIfAbsent(1) != true || typed.AddIfAbsent(1000000) != false{
+		t.Error("Typed AddIfAbsent does not match membership")
+	}
+}
+
+//keys from an ArrayEncoder or StringEncoder are encoded without allocating,
+//in every build mode including the race detector
+func TestTypedFilterAllocations(t *testing.T) {
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	workingFilter.BuildBuckets()
+
+	integers:= NewFilter[uint64]( &workingFilter, IntegerEncoder[uint64]{} )
+	uuids:= NewFilter[[16]byte]( &workingFilter, UUIDEncoder{} )
+	strings:= NewFilter[string]( &workingFilter, StringEncoder{} )
+
+	allocations:= testing.AllocsPerRun( 100, func() {
+		integers.Add(7)
+		integers.CheckMembership(7)
+		integers.AddIfAbsent(8)
+		uuids.Add( [16]byte{ 1 } )
+		uuids.CheckMembership( [16]byte{ 1 } )
+		strings.Add("key")
+		strings.CheckMembership("key")
+	})
+	if allocations != 0{
+		t.Error("Typed keys allocated", allocations)
+	}
+}
+
+//anything parseTypedFilter accepts has to be usable without panicking
+func FuzzParseTypedFilter(f *testing.F) {
+	inner:= BloomFilter{HashIterations: 3, DataDepth: 1}
+	inner.BuildBuckets()
+	seed:= NewFilter[string]( &inner, StringEncoder{} )
+	seed.Add("seed")
+	addSerializedSeeds( f, seed.Serialize )
+
+	f.Add( []byte(`{"Encoder":"string","Filter":null}`), false )
+
+	f.Fuzz(func( t *testing.T, data []byte, compressed bool ) {
+		aFilter, err:= parseTypedFilter[string]( data, compressed, StringEncoder{} )
+		if err!=nil{
+			return
+		}
+
+		aFilter.Add( string(data) )
+		if !aFilter.CheckMembership( string(data) ){
+			t.Fatal("Parsed typed filter lost an item")
+		}
+	})
+}
+
+func TestTypedFilterSerialize(t *testing.T) {
+	workingFilter:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	workingFilter.BuildBuckets()
+	typed:= NewFilter[string]( &workingFilter, StringEncoder{} )
+
+	keys:= []string{ "alpha", "beta", "gamma" }
+	for _,aKey:= range keys {
+		typed.Add(aKey)
+	}
+
+	fileName:= filepath.Join( t.TempDir(), "typedFilter.json" )
+	err:= typed.Serialize( fileName, false )
+	if err!=nil{
+		t.Fatal("Failed to serialize the typed filter!", err)
+	}
+
+	retrieved, err:= RetrieveTypedFilter[string]( fileName, false, StringEncoder{} )
+	if err!=nil{
+		t.Fatal("Failed to deserialize the typed filter!", err)
+	}
+	for _,aKey:= range keys {
+		if !retrieved.CheckMembership(aKey){
+			t.Error("Retrieved typed filter lost a key", aKey)
+		}
+	}
+
+	_, err= RetrieveTypedFilter[[16]byte]( fileName, false, UUIDEncoder{} )
+	if err != ErrEncoderMismatch{
+		t.Error("Retrieving with the wrong encoder did not fail", err)
+	}
+
+	//a filter built on a store is written with its buckets
+	stored:= BloomFilter{HashIterations: standardHash, DataDepth:2}
+	stored.BuildOn( NewHeapStore(1 << 16) )
+	typed = NewFilter[string]( &stored, StringEncoder{} )
+	for _,aKey:= range keys {
+		typed.Add(aKey)
+	}
+	if err:= typed.Serialize( fileName, true ); err!=nil{
+		t.Fatal("Failed to serialize the typed filter on a store!", err)
+	}
+	retrieved, err= RetrieveTypedFilter[string]( fileName, true, StringEncoder{} )
+	if err!=nil{
+		t.Fatal("Failed to deserialize the typed filter on a store!", err)
+	}
+	for _,aKey:= range keys {
+		if !retrieved.CheckMembership(aKey){
+			t.Error("Retrieved typed filter on a store lost a key", aKey)
+		}
+	}
+}
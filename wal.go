@@ -0,0 +1,382 @@
+package bloomFilter
+
+import(
+	"bufio" //for replaying the log without reading it all at once
+	"encoding/binary" //for record lengths and checksums
+	"errors" //for the log's own errors
+	"hash/crc32" //for spotting torn and corrupted records
+	"io" //for reading records
+	"os" //for the log file itself
+	"path/filepath" //for syncing the directory after a rename
+	"sync" //for group commit
+)
+
+//returned by every write once the log has been closed
+var ErrClosed = errors.New("bloomFilter: write ahead log is closed")
+
+//returned when a file opened as a log doesn't start with walMagic
+var ErrNotLog = errors.New("bloomFilter: file is not a write ahead log")
+
+//the first bytes of every log, versioned so the format can change
+const walMagic = "goFilterWAL\x00\x00\x00\x00\x01"
+
+//each record is its payload's length, the payload's crc32c and the payload
+const walRecordHeader = 4 + 4
+
+var walTable = crc32.MakeTable(crc32.Castagnoli)
+
+//an append only file of checksummed records, written with group commit.
+//
+//appends only buffer the record. The first caller to wait for a record that
+//isn't durable yet writes and fsyncs everything buffered so far, every other
+//caller waiting meanwhile is covered by that same fsync. Under load one fsync
+//makes many records durable at once rather than each paying for its own.
+type writeAheadLog struct{
+	fileName string
+	file *os.File
+
+	//bytes of complete records in the file, header included
+	size int64
+
+	lock sync.Mutex
+	flushed *sync.Cond
+
+	//records appended but not yet written, the spare is swapped in while
+	//the pending ones are written so appends never wait on the disk
+	pending, spare []byte
+
+	//records appended so far and records known to be durable
+	appended, durable uint64
+
+	//set while one caller owns the file, writing or rewriting it
+	busy bool
+
+	//the first write or sync error. After a failed fsync nothing is known about
+	//what reached the disk, so every later write fails with it too
+	err error
+	closed bool
+}
+
+//opens the log, creating it if needed, and hands every intact record to replay
+//in order. The log ends at its first torn or corrupt record, which is what a
+//crash mid write leaves behind, and it's truncated there so new records follow
+//the last good one.
+//
+//records over MaxSerializedSize are treated as corrupt
+func openWriteAheadLog( fileName string, replay func( []byte ) ) (*writeAheadLog, error) {
+	file, err:= os.OpenFile( fileName, os.O_RDWR|os.O_CREATE, 0664 )
+	if err!=nil{
+		return nil, err
+	}
+
+	size, err:= replayRecords( file, replay )
+	if err == io.EOF{
+		//a new log, or one that crashed before its header was complete
+		size, err = writeLogHeader(file)
+	}
+	if err!=nil{
+		file.Close()
+		return nil, err
+	}
+
+	//drop the torn tail and carry on from the end
+	err = file.Truncate(size)
+	if err == nil{
+		_, err = file.Seek( size, io.SeekStart )
+	}
+	if err!=nil{
+		file.Close()
+		return nil, err
+	}
+
+	aLog:= &writeAheadLog{ fileName: fileName, file: file, size: size }
+	aLog.flushed = sync.NewCond(&aLog.lock)
+
+	return aLog, nil
+}
+
+//writes the header to an empty or headerless file and syncs it
+func writeLogHeader( file *os.File ) (int64, error) {
+	err:= file.Truncate(0)
+	if err!=nil{
+		return 0, err
+	}
+
+	_, err = file.WriteAt( []byte(walMagic), 0 )
+	if err!=nil{
+		return 0, err
+	}
+
+	return int64( len(walMagic) ), file.Sync()
+}
+
+//checks the header then replays records until the first bad one,
+//returning where that one starts. io.EOF means the header itself is missing
+func replayRecords( file *os.File, replay func( []byte ) ) (int64, error) {
+	reader:= bufio.NewReader(file)
+
+	magic:= make( []byte, len(walMagic) )
+	read, err:= io.ReadFull( reader, magic )
+	if err!=nil{
+		//only a header cut short by a crash is forgiven
+		if read == 0 || string(magic[:read]) == walMagic[:read]{
+			return 0, io.EOF
+		}
+		return 0, ErrNotLog
+	}
+	if string(magic) != walMagic{
+		return 0, ErrNotLog
+	}
+
+	size:= int64( len(walMagic) )
+	var header [walRecordHeader]byte
+	var payload []byte
+	for {
+		_, err:= io.ReadFull( reader, header[:] )
+		if err!=nil{
+			return size, nil
+		}
+
+		length:= int64( binary.LittleEndian.Uint32( header[0:] ) )
+		if length > MaxSerializedSize{
+			return size, nil
+		}
+
+		//only grows as far as the file really backs up
+		if int64( cap(payload) ) < length{
+			payload = make( []byte, 0, min( length, 1 << 20 ) )
+		}
+		payload = payload[:0]
+		copied, err:= io.CopyN( (*appendWriter)(&payload), reader, length )
+		if err!=nil || copied != length{
+			return size, nil
+		}
+
+		if crc32.Checksum( payload, walTable ) != binary.LittleEndian.Uint32( header[4:] ){
+			return size, nil
+		}
+
+		replay(payload)
+		size+= walRecordHeader + length
+	}
+}
+
+//an io.Writer appending to a byte slice
+type appendWriter []byte
+
+func (aWriter *appendWriter) Write( data []byte ) (int, error) {
+	*aWriter = append( *aWriter, data... )
+	return len(data), nil
+}
+
+//buffers a record, returning its sequence number for wait.
+//the payload is copied so the caller can reuse it
+func (aLog *writeAheadLog) append( payload []byte ) (uint64, error) {
+	if int64( len(payload) ) > MaxSerializedSize{
+		return 0, ErrTooLarge
+	}
+
+	var header [walRecordHeader]byte
+	binary.LittleEndian.PutUint32( header[0:], uint32( len(payload) ) )
+	binary.LittleEndian.PutUint32( header[4:], crc32.Checksum( payload, walTable ) )
+
+	aLog.lock.Lock()
+	defer aLog.lock.Unlock()
+
+	if aLog.closed{
+		return 0, ErrClosed
+	}
+	if aLog.err!=nil{
+		return 0, aLog.err
+	}
+
+	aLog.pending = append( aLog.pending, header[:]... )
+	aLog.pending = append( aLog.pending, payload... )
+	aLog.appended++
+
+	return aLog.appended, nil
+}
+
+//blocks until the record with the given sequence number is durable,
+//writing and syncing it along with every other buffered record if
+//nobody else already is
+func (aLog *writeAheadLog) wait( sequence uint64 ) error {
+	aLog.lock.Lock()
+	defer aLog.lock.Unlock()
+
+	for aLog.durable < sequence && aLog.err == nil{
+		if aLog.busy{
+			aLog.flushed.Wait()
+			continue
+		}
+
+		aLog.flushPending()
+	}
+
+	if aLog.durable >= sequence{
+		return nil
+	}
+	return aLog.err
+}
+
+//writes and syncs everything buffered so far. Called with the lock held and
+//the log not busy, the lock is released while the disk is busy
+func (aLog *writeAheadLog) flushPending() {
+	batch, upTo:= aLog.pending, aLog.appended
+	aLog.pending, aLog.spare = aLog.spare[:0], nil
+	aLog.busy = true
+	aLog.lock.Unlock()
+
+	_, err:= aLog.file.Write(batch)
+	if err == nil{
+		err = aLog.file.Sync()
+	}
+
+	aLog.lock.Lock()
+	aLog.busy = false
+	aLog.spare = batch[:0]
+	if err!=nil{
+		if aLog.err == nil{
+			aLog.err = err
+		}
+	}else{
+		aLog.size+= int64( len(batch) )
+		aLog.durable = upTo
+	}
+	aLog.flushed.Broadcast()
+}
+
+//the sequence number of the last record appended, 0 before any are
+func (aLog *writeAheadLog) last() uint64 {
+	aLog.lock.Lock()
+	defer aLog.lock.Unlock()
+
+	return aLog.appended
+}
+
+//the end of the records that are durable right now.
+//every record before it was appended before the call
+func (aLog *writeAheadLog) cut() int64 {
+	aLog.lock.Lock()
+	defer aLog.lock.Unlock()
+
+	return aLog.size
+}
+
+//whether the log holds records past its header, durable or not
+func (aLog *writeAheadLog) empty() bool {
+	aLog.lock.Lock()
+	defer aLog.lock.Unlock()
+
+	return aLog.size == int64( len(walMagic) ) && len(aLog.pending) == 0
+}
+
+//drops every record before offset, an earlier cut, once they're in a snapshot.
+//
+//the records after it are copied to a new file which replaces the log by rename,
+//so a crash leaves either the whole old log or the new one. Appends carry on
+//into the buffer meanwhile, only waiting for durability is held up
+func (aLog *writeAheadLog) discardBefore( offset int64 ) error {
+	aLog.lock.Lock()
+	for aLog.busy{
+		aLog.flushed.Wait()
+	}
+	if aLog.closed{
+		aLog.lock.Unlock()
+		return ErrClosed
+	}
+	if aLog.err!=nil{
+		aLog.lock.Unlock()
+		return aLog.err
+	}
+	aLog.busy = true
+	size:= aLog.size
+	aLog.lock.Unlock()
+
+	file, err:= aLog.rewrite( offset, size )
+
+	aLog.lock.Lock()
+	aLog.busy = false
+	//once renamed the old file is gone, appending to it would lose records
+	if file!=nil{
+		aLog.file.Close()
+		aLog.file = file
+		aLog.size = int64( len(walMagic) ) + size - offset
+	}
+	//and if the rename isn't known to be durable a crash may bring the old file
+	//back without anything appended since, so nothing more can be promised
+	if file!=nil && err!=nil && aLog.err == nil{
+		aLog.err = err
+	}
+	aLog.flushed.Broadcast()
+	aLog.lock.Unlock()
+
+	return err
+}
+
+//writes the header and the records between offset and size to a new file,
+//renames it over the log and returns it open for appending. The file is
+//returned along with the error if the rename happened but syncing it failed
+func (aLog *writeAheadLog) rewrite( offset, size int64 ) (*os.File, error) {
+	temporary:= aLog.fileName + ".tmp"
+	file, err:= os.OpenFile( temporary, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0664 )
+	if err!=nil{
+		return nil, err
+	}
+
+	_, err = file.Write( []byte(walMagic) )
+	if err == nil{
+		_, err = io.Copy( file, io.NewSectionReader( aLog.file, offset, size - offset ) )
+	}
+	if err == nil{
+		err = file.Sync()
+	}
+	if err == nil{
+		err = os.Rename( temporary, aLog.fileName )
+	}
+	if err!=nil{
+		file.Close()
+		os.Remove(temporary)
+		return nil, err
+	}
+
+	return file, syncDirectory( aLog.fileName )
+}
+
+//makes everything appended so far durable and closes the file.
+//later appends fail with ErrClosed
+func (aLog *writeAheadLog) close() error {
+	aLog.lock.Lock()
+	last:= aLog.appended
+	aLog.lock.Unlock()
+
+	err:= aLog.wait(last)
+
+	aLog.lock.Lock()
+	defer aLog.lock.Unlock()
+	for aLog.busy{
+		aLog.flushed.Wait()
+	}
+	if aLog.closed{
+		return ErrClosed
+	}
+	aLog.closed = true
+
+	closeErr:= aLog.file.Close()
+	if err!=nil{
+		return err
+	}
+	return closeErr
+}
+
+//fsyncs the directory holding the file so a rename into it survives a crash.
+//a variable so tests can make it fail
+var syncDirectory = func( fileName string ) error {
+	directory, err:= os.Open( filepath.Dir(fileName) )
+	if err!=nil{
+		return err
+	}
+	defer directory.Close()
+
+	return directory.Sync()
+}
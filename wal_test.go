@@ -0,0 +1,233 @@
+package bloomFilter
+
+import (
+
+	"testing"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+
+)
+
+//opens a log, collecting copies of what it replays
+func openTestLog( t *testing.T, fileName string ) (*writeAheadLog, [][]byte) {
+	var replayed [][]byte
+	aLog, err:= openWriteAheadLog( fileName, func( data []byte ) {
+		replayed = append( replayed, bytes.Clone(data) )
+	})
+	if err!=nil{
+		t.Fatal("Failed to open the log", err)
+	}
+
+	return aLog, replayed
+}
+
+//appends each record and waits for it
+func appendAll( t *testing.T, aLog *writeAheadLog, records [][]byte ) {
+	for _,aRecord:= range records {
+		sequence, err:= aLog.append(aRecord)
+		if err == nil{
+			err = aLog.wait(sequence)
+		}
+		if err!=nil{
+			t.Fatal("Failed to append a record", err)
+		}
+	}
+}
+
+func sameRecords( got, expected [][]byte ) bool {
+	if len(got) != len(expected){
+		return false
+	}
+	for i := range got {
+		if !bytes.Equal( got[i], expected[i] ){
+			return false
+		}
+	}
+
+	return true
+}
+
+//whatever a crash leaves at the end of the log is dropped and the log carries on
+func TestWriteAheadLogTornTail(t *testing.T) {
+	randomKeys:= testKeys()
+	fileName:= filepath.Join( t.TempDir(), "filter.wal" )
+
+	records:= [][]byte{ {}, randomKeys.Key(1), randomKeys.Key(100), randomKeys.Key(5000) }
+
+	aLog, replayed:= openTestLog( t, fileName )
+	if len(replayed) != 0{
+		t.Fatal("A new log replayed records")
+	}
+	appendAll( t, aLog, records )
+	if err:= aLog.close(); err!=nil{
+		t.Fatal("Failed to close the log", err)
+	}
+	intact, _:= os.ReadFile(fileName)
+
+	tails:= map[string][]byte{
+		"half a header": { 9, 0, 0 },
+		"half a payload": { 9, 0, 0, 0, 1, 2, 3, 4, 5 },
+		"bad checksum": { 1, 0, 0, 0, 1, 2, 3, 4, 5 },
+		"impossible length": { 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0 },
+	}
+
+	for name,aTail:= range tails {
+		os.WriteFile( fileName, append( bytes.Clone(intact), aTail... ), 0664 )
+
+		aLog, replayed:= openTestLog( t, fileName )
+		if !sameRecords( replayed, records ){
+			t.Fatal("Torn log replayed the wrong records", name, len(replayed))
+		}
+
+		//new records follow straight on from the last good one
+		more:= randomKeys.Key(20)
+		appendAll( t, aLog, [][]byte{ more } )
+		aLog.close()
+
+		_, replayed = openTestLog( t, fileName )
+		if !sameRecords( replayed, append( records, more ) ){
+			t.Fatal("Log didn't carry on after its torn tail", name, len(replayed))
+		}
+	}
+
+	//a record damaged in the middle ends the log there
+	damaged:= bytes.Clone(intact)
+	damaged[ len(walMagic) + walRecordHeader*2 + 1 + walRecordHeader ]^= 1
+	os.WriteFile( fileName, damaged, 0664 )
+	_, replayed = openTestLog( t, fileName )
+	if !sameRecords( replayed, records[:2] ){
+		t.Error("Damaged log replayed past the damage", len(replayed))
+	}
+
+	//a header cut short is a log that never got going, anything else isn't a log
+	os.WriteFile( fileName, []byte(walMagic[:5]), 0664 )
+	_, replayed = openTestLog( t, fileName )
+	if len(replayed) != 0{
+		t.Error("A headerless log replayed records")
+	}
+
+	os.WriteFile( fileName, []byte("{\"HashIterations\":4}"), 0664 )
+	if _, err:= openWriteAheadLog( fileName, func( []byte ) {} ); err != ErrNotLog{
+		t.Error("Opened something that isn't a log", err)
+	}
+}
+
+//many goroutines append at once and every record lands exactly once
+func TestWriteAheadLogGroupCommit(t *testing.T) {
+	fileName:= filepath.Join( t.TempDir(), "filter.wal" )
+	aLog, _:= openTestLog( t, fileName )
+
+	const writers, perWriter = 8, 200
+
+	var group sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		group.Add(1)
+		go func( writer int ) {
+			defer group.Done()
+			for j := 0; j < perWriter; j++ {
+				sequence, err:= aLog.append( []byte{ byte(writer), byte(j) } )
+				if err == nil{
+					err = aLog.wait(sequence)
+				}
+				if err!=nil{
+					t.Error("Concurrent append failed", err)
+					return
+				}
+			}
+		}(i)
+	}
+	group.Wait()
+	aLog.close()
+
+	if _, err:= aLog.append( []byte{ 1 } ); err != ErrClosed{
+		t.Error("Appended to a closed log", err)
+	}
+
+	_, replayed:= openTestLog( t, fileName )
+	if len(replayed) != writers*perWriter{
+		t.Fatal("Log lost records", len(replayed))
+	}
+
+	//each writer's records are in the order it wrote them
+	next:= make( []int, writers )
+	for _,aRecord:= range replayed {
+		if int( aRecord[1] ) != next[ aRecord[0] ]{
+			t.Fatal("Writer's records out of order", aRecord)
+		}
+		next[ aRecord[0] ]++
+	}
+}
+
+//discarding keeps every record after the cut, including ones appended meanwhile
+func TestWriteAheadLogDiscard(t *testing.T) {
+	randomKeys:= testKeys()
+	fileName:= filepath.Join( t.TempDir(), "filter.wal" )
+	aLog, _:= openTestLog( t, fileName )
+
+	before:= [][]byte{ randomKeys.Key(10), randomKeys.Key(10) }
+	after:= [][]byte{ randomKeys.Key(10), randomKeys.Key(10) }
+
+	appendAll( t, aLog, before )
+	cut:= aLog.cut()
+	appendAll( t, aLog, after[:1] )
+
+	//buffered but not yet written when the log is rewritten
+	sequence, _:= aLog.append( after[1] )
+
+	if err:= aLog.discardBefore(cut); err!=nil{
+		t.Fatal("Failed to discard", err)
+	}
+	if err:= aLog.wait(sequence); err!=nil{
+		t.Fatal("Failed to append after discarding", err)
+	}
+	aLog.close()
+
+	_, replayed:= openTestLog( t, fileName )
+	if !sameRecords( replayed, after ){
+		t.Error("Discarding kept the wrong records", len(replayed))
+	}
+	if _, err:= os.Stat( fileName + ".tmp" ); err == nil{
+		t.Error("Discarding left its temporary file behind")
+	}
+}
+
+//a rename that isn't known to be durable leaves the log on the new file, refusing writes
+func TestWriteAheadLogDiscardSyncFails(t *testing.T) {
+	randomKeys:= testKeys()
+	fileName:= filepath.Join( t.TempDir(), "filter.wal" )
+	aLog, _:= openTestLog( t, fileName )
+
+	before:= [][]byte{ randomKeys.Key(10), randomKeys.Key(10) }
+	after:= [][]byte{ randomKeys.Key(10) }
+	appendAll( t, aLog, before )
+	cut:= aLog.cut()
+	appendAll( t, aLog, after )
+
+	failed:= errors.New("directory sync failed")
+	defer func( restore func( string ) error ) { syncDirectory = restore }( syncDirectory )
+	syncDirectory = func( string ) error { return failed }
+
+	if err:= aLog.discardBefore(cut); err != failed{
+		t.Fatal("Discarding hid the failed sync", err)
+	}
+
+	//the renamed file is the one in use, not the unlinked old one
+	inUse, err:= aLog.file.Stat()
+	named, _:= os.Stat(fileName)
+	if err!=nil || !os.SameFile( inUse, named ){
+		t.Fatal("Log kept writing to the file it renamed over", err)
+	}
+
+	if _, err:= aLog.append( randomKeys.Key(10) ); err != failed{
+		t.Error("Log accepted an append it can't make durable", err)
+	}
+	aLog.close()
+
+	_, replayed:= openTestLog( t, fileName )
+	if !sameRecords( replayed, after ){
+		t.Error("Log lost records after a failed sync", len(replayed))
+	}
+}